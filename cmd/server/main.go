@@ -26,22 +26,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/bhaskar/todo-api/internal/config"
-	"github.com/bhaskar/todo-api/internal/handlers"
-	"github.com/bhaskar/todo-api/internal/middleware"
+	"github.com/bhaskar/todo-api/internal/events"
+	"github.com/bhaskar/todo-api/internal/models"
 	"github.com/bhaskar/todo-api/internal/repository"
+	"github.com/bhaskar/todo-api/internal/router"
 	"github.com/bhaskar/todo-api/internal/services"
 	"github.com/bhaskar/todo-api/pkg/database"
-	"github.com/bhaskar/todo-api/pkg/utils"
 	"github.com/gin-gonic/gin"
-
-	// Swagger docs
-	_ "github.com/bhaskar/todo-api/docs"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
 func main() {
@@ -61,87 +57,48 @@ func main() {
 	if err := database.Migrate(db); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
-
-	// Initialize JWT manager
-	jwtManager := utils.NewJWTManager(cfg.JWT.Secret, cfg.JWT.Expiry, cfg.JWT.Issuer)
-
-	// Initialize repositories
-	userRepo := repository.NewUserRepository(db)
-	todoRepo := repository.NewTodoRepository(db)
-
-	// Initialize services
-	authService := services.NewAuthService(userRepo, jwtManager)
-	todoService := services.NewTodoService(todoRepo)
-
-	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(authService)
-	todoHandler := handlers.NewTodoHandler(todoService)
+	if err := database.ApplyExternalIDScope(db, cfg.Todo.ExternalIDScope); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+	if cfg.Security.NormalizeEmails {
+		if err := database.NormalizeEmails(db); err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
+	}
 
 	// Setup Gin
 	if cfg.Server.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	router := gin.New()
-
-	// Global middleware
-	router.Use(gin.Recovery())
-	router.Use(middleware.Logger())
-	router.Use(middleware.RateLimitMiddleware(100, time.Minute)) // 100 requests per minute
-
-	// CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
-		c.Next()
-	})
-
-	// Health check
-	router.GET("/health", handlers.HealthCheck)
-
-	// Swagger docs
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-
-	// API routes
-	api := router.Group("/api")
-	{
-		// Auth routes (public)
-		auth := api.Group("/auth")
-		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
-		}
-
-		// Protected routes
-		protected := api.Group("")
-		protected.Use(middleware.AuthMiddleware(jwtManager))
-		{
-			// Auth profile (protected)
-			protected.GET("/auth/profile", authHandler.GetProfile)
-
-			// Todo routes
-			todos := protected.Group("/todos")
-			{
-				todos.POST("", todoHandler.Create)
-				todos.GET("", todoHandler.List)
-				todos.GET("/stats", todoHandler.GetStats)
-				todos.GET("/:id", todoHandler.GetByID)
-				todos.PUT("/:id", todoHandler.Update)
-				todos.DELETE("/:id", todoHandler.Delete)
-			}
-		}
+	// Until a mailer subscribes, verification and reset tokens are only
+	// logged. They hand over the account, so production logs only the request.
+	bus := events.NewBus()
+	if cfg.Server.Environment != "production" {
+		bus.Subscribe(events.EmailVerificationRequested, func(_ context.Context, event events.Event) {
+			verification := event.Payload.(models.EmailVerification)
+			log.Printf("📧 Verify %s at /api/auth/verify?token=%s (expires %s)", verification.Email, verification.Token, verification.ExpiresAt.Format(time.RFC3339))
+		})
+		bus.Subscribe(events.PasswordResetRequested, func(_ context.Context, event events.Event) {
+			reset := event.Payload.(models.PasswordReset)
+			log.Printf("📧 Password reset token for %s: %s (expires %s)", reset.Email, reset.Token, reset.ExpiresAt.Format(time.RFC3339))
+		})
+	} else {
+		bus.Subscribe(events.EmailVerificationRequested, func(_ context.Context, _ events.Event) {
+			log.Printf("📧 Email verification requested; no mailer is configured to deliver it")
+		})
+		bus.Subscribe(events.PasswordResetRequested, func(_ context.Context, _ events.Event) {
+			log.Printf("📧 Password reset requested; no mailer is configured to deliver it")
+		})
 	}
 
+	var shuttingDown atomic.Bool
+	engine := router.New(cfg, db, router.WithShutdownFlag(&shuttingDown), router.WithEventBus(bus))
+
 	// Create server
 	srv := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
-		Handler:      router,
+		Handler:      engine,
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 	}
@@ -155,12 +112,32 @@ func main() {
 		}
 	}()
 
+	// Dispatch reminders in the background until shutdown
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	workersDone := make(chan struct{})
+	if cfg.Todo.ReminderInterval > 0 {
+		bus.Subscribe(events.TodoReminder, func(_ context.Context, event events.Event) {
+			todo := event.Payload.(models.TodoResponse)
+			log.Printf("⏰ Reminder for user %d: todo %d %q", event.UserID, todo.ID, todo.Title)
+		})
+
+		todoRepo := repository.NewTodoRepository(db, router.TodoRepositoryOptions(cfg)...)
+		worker := services.NewReminderWorker(todoRepo, bus, cfg.Todo.ReminderInterval)
+		go func() {
+			defer close(workersDone)
+			worker.Run(workerCtx)
+		}()
+	} else {
+		close(workersDone)
+	}
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	log.Println("🛑 Shutting down server...")
+	shuttingDown.Store(true)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -169,6 +146,9 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	stopWorkers()
+	<-workersDone
+
 	// Close database connection
 	if err := database.Close(db); err != nil {
 		log.Printf("Error closing database: %v", err)
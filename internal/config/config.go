@@ -1,11 +1,18 @@
 package config
 
 import (
+	"cmp"
+	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/pkg/utils"
 	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Config holds all application configuration
@@ -13,6 +20,10 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Security SecurityConfig
+	Auth     AuthConfig
+	Todo     TodoConfig
+	Features Features
 }
 
 // ServerConfig holds server-specific settings
@@ -21,6 +32,33 @@ type ServerConfig struct {
 	Environment  string
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+
+	// MaxConcurrentRequests caps requests processed at once (0 disables)
+	MaxConcurrentRequests int
+	// ShedRetryAfter is advertised in Retry-After when a request is shed
+	ShedRetryAfter time.Duration
+	// ShutdownRetryAfter is advertised in Retry-After to requests arriving
+	// during graceful shutdown
+	ShutdownRetryAfter time.Duration
+	// MaxQueryLength caps the raw query string in bytes (0 disables)
+	MaxQueryLength int
+	// MaxHeaderCount and MaxHeaderBytes cap request header fields and their total size (0 disables)
+	MaxHeaderCount int
+	MaxHeaderBytes int
+
+	// RequestIDHeader carries request IDs; fallbacks are read when it is absent
+	RequestIDHeader          string
+	RequestIDFallbackHeaders []string
+
+	// EnforceHTTPS sends HSTS and redirects plain-HTTP requests (default on in production)
+	EnforceHTTPS bool
+	HSTSMaxAge   time.Duration
+
+	// EnableSwagger mounts the Swagger UI (default off in production)
+	EnableSwagger bool
+
+	// TimeFormat serializes response times as RFC3339 strings or epoch milliseconds
+	TimeFormat string
 }
 
 // DatabaseConfig holds database connection settings
@@ -31,13 +69,109 @@ type DatabaseConfig struct {
 	Password string
 	DBName   string
 	SSLMode  string
+
+	// CountQueries logs the number of queries each request issued (debugging aid)
+	CountQueries bool
+	// WriteRetries is how many times a write failing with a transient error
+	// (serialization failure, deadlock) is retried
+	WriteRetries int
 }
 
 // JWTConfig holds JWT authentication settings
 type JWTConfig struct {
-	Secret     string
-	Expiry     time.Duration
-	Issuer     string
+	Secret string
+	Expiry time.Duration
+	Issuer string
+	// Algorithm is the only signing algorithm tokens are issued with and accepted in
+	Algorithm string
+	// ClientIDs are the client_id values logins may ask tokens to be scoped
+	// to; with RequireAudience, only tokens scoped to one of them are accepted
+	ClientIDs       []string
+	RequireAudience bool
+}
+
+// SecurityConfig holds password hashing and login lockout settings
+type SecurityConfig struct {
+	BcryptCost int
+	// MaxFailedLogins locks an account after this many consecutive failures (0 disables)
+	MaxFailedLogins int
+	LockoutDuration time.Duration
+	// AdminSigningSecret, when set, requires admin requests to be signed
+	// with it; signatures are valid for AdminSigningWindow either side of now
+	AdminSigningSecret string
+	AdminSigningWindow time.Duration
+	// MaxAPIKeys caps each user's active (unrevoked) API keys (0 disables)
+	MaxAPIKeys int
+	// APIKeyLastUsedInterval is how stale an API key's last-used time may get
+	// before a request refreshes it, so busy keys don't write on every call
+	APIKeyLastUsedInterval time.Duration
+	// TokenRefreshGrace is how long after expiry a token may still be
+	// exchanged for a new one at /api/auth/refresh
+	TokenRefreshGrace time.Duration
+	// RequireEmailVerification blocks logins until the user has followed the
+	// verification link sent on registration, valid for EmailVerificationTTL
+	RequireEmailVerification bool
+	EmailVerificationTTL     time.Duration
+	// PasswordResetTTL is how long a password reset token stays valid
+	PasswordResetTTL time.Duration
+	// NormalizeEmails lowercases emails and applies Unicode NFC normalization
+	// before they are stored or looked up, and to stored emails at startup
+	NormalizeEmails bool
+}
+
+// AuthConfig holds route authentication settings
+type AuthConfig struct {
+	// PublicRoutes bypass auth enforcement; a trailing "*" matches a prefix
+	PublicRoutes []string
+	// RequireActiveUser rejects valid tokens whose user has since been deleted,
+	// at the cost of a user lookup per request
+	RequireActiveUser bool
+}
+
+// TodoConfig holds todo feature settings
+type TodoConfig struct {
+	// ImportMaxItems caps the number of todos accepted by a single import
+	ImportMaxItems int
+	// HardDeleteTodos permanently removes deleted todos instead of soft-deleting them
+	HardDeleteTodos bool
+	// Tombstones remembers permanently deleted todos so fetching one
+	// returns 410 Gone rather than 404
+	Tombstones bool
+	// DefaultPerPage is the list page size when a request omits it, and
+	// MaxPerPage the largest page size a request may ask for
+	DefaultPerPage int
+	MaxPerPage     int
+	// SearchMaxResults caps how many matches a search can page through;
+	// beyond it the list is flagged as truncated (0 disables)
+	SearchMaxResults int
+	// DefaultSort and DefaultOrder apply when a list request omits them
+	DefaultSort  string
+	DefaultOrder string
+	// DuplicateWindow treats an identical create from the same user within
+	// this window as a double submission (0 disables)
+	DuplicateWindow time.Duration
+	// DefaultExpand lists associations single-todo fetches include unless
+	// the request passes ?expand=
+	DefaultExpand []string
+	// ReminderInterval is how often due reminders are dispatched (0 disables)
+	ReminderInterval time.Duration
+	// ExternalIDScope makes external IDs unique per user or across all users
+	// (see models.ExternalIDScopes)
+	ExternalIDScope string
+}
+
+// Page sizes used when TodoConfig leaves them unset
+const (
+	DefaultPerPage    = 10
+	DefaultMaxPerPage = 100
+)
+
+// PageSizes returns the default and maximum list page sizes, falling back to
+// DefaultPerPage and DefaultMaxPerPage when unset
+func (c TodoConfig) PageSizes() (perPage, maxPerPage int) {
+	maxPerPage = cmp.Or(c.MaxPerPage, DefaultMaxPerPage)
+	perPage = min(cmp.Or(c.DefaultPerPage, DefaultPerPage), maxPerPage)
+	return perPage, maxPerPage
 }
 
 // Load initializes configuration from environment variables
@@ -45,12 +179,37 @@ func Load() (*Config, error) {
 	// Load .env file if it exists (ignore error if not found)
 	_ = godotenv.Load()
 
-	return &Config{
+	features, err := getFeaturesEnv("FEATURES")
+	if err != nil {
+		return nil, err
+	}
+
+	environment := getEnv("ENVIRONMENT", "development")
+	production := environment == "production"
+
+	cfg := &Config{
 		Server: ServerConfig{
 			Port:         getEnv("SERVER_PORT", "8080"),
-			Environment:  getEnv("ENVIRONMENT", "development"),
+			Environment:  environment,
 			ReadTimeout:  getDurationEnv("READ_TIMEOUT", 10*time.Second),
 			WriteTimeout: getDurationEnv("WRITE_TIMEOUT", 10*time.Second),
+
+			MaxConcurrentRequests: getIntEnv("MAX_CONCURRENT_REQUESTS", 0),
+			ShedRetryAfter:        getDurationEnv("SHED_RETRY_AFTER", time.Second),
+			ShutdownRetryAfter:    getDurationEnv("SHUTDOWN_RETRY_AFTER", 5*time.Second),
+			MaxQueryLength:        getIntEnv("MAX_QUERY_LENGTH", 2048),
+			MaxHeaderCount:        getIntEnv("MAX_HEADER_COUNT", 100),
+			MaxHeaderBytes:        getIntEnv("MAX_HEADER_BYTES", 16384),
+
+			RequestIDHeader:          getEnv("REQUEST_ID_HEADER", "X-Request-ID"),
+			RequestIDFallbackHeaders: getListEnv("REQUEST_ID_FALLBACK_HEADERS", nil),
+
+			EnforceHTTPS: getBoolEnv("ENFORCE_HTTPS", production),
+			HSTSMaxAge:   getDurationEnv("HSTS_MAX_AGE", 365*24*time.Hour),
+
+			EnableSwagger: getBoolEnv("ENABLE_SWAGGER", !production),
+
+			TimeFormat: strings.ToLower(getEnv("TIME_FORMAT", models.TimeFormatRFC3339)),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -59,13 +218,118 @@ func Load() (*Config, error) {
 			Password: getEnv("DB_PASSWORD", "postgres"),
 			DBName:   getEnv("DB_NAME", "todo_api"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+			CountQueries: getBoolEnv("DB_COUNT_QUERIES", false),
+			WriteRetries: getIntEnv("DB_WRITE_RETRIES", 2),
 		},
 		JWT: JWTConfig{
 			Secret: getEnv("JWT_SECRET", "your-super-secret-key-change-in-production"),
 			Expiry: getDurationEnv("JWT_EXPIRY", 24*time.Hour),
-			Issuer: getEnv("JWT_ISSUER", "todo-api"),
+			Issuer: strings.TrimSpace(getEnv("JWT_ISSUER", "todo-api")),
+
+			Algorithm: getEnv("JWT_ALGORITHM", utils.DefaultJWTAlgorithm),
+
+			ClientIDs:       getListEnv("JWT_CLIENT_IDS", nil),
+			RequireAudience: getBoolEnv("JWT_REQUIRE_AUDIENCE", false),
 		},
-	}, nil
+		Security: SecurityConfig{
+			BcryptCost:      getIntEnv("BCRYPT_COST", bcrypt.DefaultCost),
+			MaxFailedLogins: getIntEnv("MAX_FAILED_LOGINS", 5),
+			LockoutDuration: getDurationEnv("LOCKOUT_DURATION", 15*time.Minute),
+
+			AdminSigningSecret: getEnv("ADMIN_SIGNING_SECRET", ""),
+			AdminSigningWindow: getDurationEnv("ADMIN_SIGNING_WINDOW", 5*time.Minute),
+
+			MaxAPIKeys:             getIntEnv("MAX_API_KEYS", 10),
+			APIKeyLastUsedInterval: getDurationEnv("API_KEY_LAST_USED_INTERVAL", 5*time.Minute),
+
+			TokenRefreshGrace: getDurationEnv("TOKEN_REFRESH_GRACE", 10*time.Minute),
+
+			RequireEmailVerification: getBoolEnv("REQUIRE_EMAIL_VERIFICATION", false),
+			EmailVerificationTTL:     getDurationEnv("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+			PasswordResetTTL:         getDurationEnv("PASSWORD_RESET_TTL", time.Hour),
+			NormalizeEmails:          getBoolEnv("NORMALIZE_EMAILS", true),
+		},
+		Auth: AuthConfig{
+			PublicRoutes: getListEnv("PUBLIC_ROUTES", []string{
+				"/api/auth/register",
+				"/api/auth/login",
+				"/api/auth/refresh",
+				"/api/auth/verify",
+				"/api/auth/forgot-password",
+				"/api/auth/reset-password",
+				"/api/meta",
+				"/health",
+				"/swagger/*",
+				"/api/todos/calendar/*",
+			}),
+			RequireActiveUser: getBoolEnv("REQUIRE_ACTIVE_USER", true),
+		},
+		Todo: TodoConfig{
+			ImportMaxItems:  getIntEnv("TODO_IMPORT_MAX_ITEMS", 1000),
+			HardDeleteTodos: getBoolEnv("HARD_DELETE_TODOS", false),
+			DefaultPerPage:  getIntEnv("TODO_DEFAULT_PER_PAGE", DefaultPerPage),
+			MaxPerPage:      getIntEnv("TODO_MAX_PER_PAGE", DefaultMaxPerPage),
+			DefaultSort:     getEnv("TODO_DEFAULT_SORT", "created_at"),
+			DefaultOrder:    strings.ToLower(getEnv("TODO_DEFAULT_ORDER", "desc")),
+			DuplicateWindow: getDurationEnv("TODO_DUPLICATE_WINDOW", 0),
+			DefaultExpand:   getListEnv("TODO_DEFAULT_EXPAND", nil),
+
+			SearchMaxResults: getIntEnv("TODO_SEARCH_MAX_RESULTS", 1000),
+			Tombstones:       getBoolEnv("TODO_TOMBSTONES", false),
+			ReminderInterval: getDurationEnv("REMINDER_INTERVAL", time.Minute),
+			ExternalIDScope:  strings.ToLower(getEnv("TODO_EXTERNAL_ID_SCOPE", models.ExternalIDScopeUser)),
+		},
+		Features: features,
+	}
+
+	return cfg, cfg.validate()
+}
+
+// validate rejects settings that would otherwise fail on every request
+func (c *Config) validate() error {
+	if !slices.Contains(utils.JWTAlgorithms, c.JWT.Algorithm) {
+		return fmt.Errorf("JWT_ALGORITHM must be one of %s", strings.Join(utils.JWTAlgorithms, ", "))
+	}
+	if c.JWT.RequireAudience && len(c.JWT.ClientIDs) == 0 {
+		return fmt.Errorf("JWT_REQUIRE_AUDIENCE needs at least one JWT_CLIENT_IDS entry")
+	}
+	if !slices.Contains(models.TimeFormats, c.Server.TimeFormat) {
+		return fmt.Errorf("TIME_FORMAT must be one of %s", strings.Join(models.TimeFormats, ", "))
+	}
+	if !slices.Contains(models.TodoSortFields, c.Todo.DefaultSort) {
+		return fmt.Errorf("TODO_DEFAULT_SORT must be one of %s", strings.Join(models.TodoSortFields, ", "))
+	}
+	if c.Security.BcryptCost < bcrypt.MinCost || c.Security.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if c.Security.EmailVerificationTTL <= 0 {
+		return fmt.Errorf("EMAIL_VERIFICATION_TTL must be positive")
+	}
+	if c.Security.PasswordResetTTL <= 0 {
+		return fmt.Errorf("PASSWORD_RESET_TTL must be positive")
+	}
+	if c.Todo.MaxPerPage < 1 {
+		return fmt.Errorf("TODO_MAX_PER_PAGE must be at least 1")
+	}
+	if c.Todo.DefaultPerPage < 1 || c.Todo.DefaultPerPage > c.Todo.MaxPerPage {
+		return fmt.Errorf("TODO_DEFAULT_PER_PAGE must be between 1 and TODO_MAX_PER_PAGE (%d)", c.Todo.MaxPerPage)
+	}
+	if c.Todo.SearchMaxResults < 0 {
+		return fmt.Errorf("TODO_SEARCH_MAX_RESULTS must not be negative")
+	}
+	if c.Todo.DefaultOrder != "asc" && c.Todo.DefaultOrder != "desc" {
+		return fmt.Errorf("TODO_DEFAULT_ORDER must be asc or desc")
+	}
+	if !slices.Contains(models.ExternalIDScopes, c.Todo.ExternalIDScope) {
+		return fmt.Errorf("TODO_EXTERNAL_ID_SCOPE must be one of %s", strings.Join(models.ExternalIDScopes, ", "))
+	}
+	for _, name := range c.Todo.DefaultExpand {
+		if _, ok := models.TodoExpansions[name]; !ok {
+			return fmt.Errorf("TODO_DEFAULT_EXPAND contains unsupported expansion %q", name)
+		}
+	}
+	return nil
 }
 
 // getEnv retrieves an environment variable or returns a default value
@@ -76,6 +340,42 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getListEnv retrieves a comma-separated list from environment or returns default
+func getListEnv(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getBoolEnv retrieves a boolean from environment or returns default
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// getIntEnv retrieves an integer from environment or returns default
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
 // getDurationEnv retrieves a duration from environment or returns default
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
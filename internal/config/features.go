@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Optional features operators can switch off with FEATURES
+const (
+	FeatureAPIKeys  = "api_keys"
+	FeatureCalendar = "calendar"
+	FeatureImport   = "import"
+	FeatureHistory  = "history"
+)
+
+// Features maps feature names to whether they are enabled
+type Features map[string]bool
+
+// DefaultFeatures lists every known feature with its default state
+var DefaultFeatures = Features{
+	FeatureAPIKeys:  true,
+	FeatureCalendar: true,
+	FeatureImport:   true,
+	FeatureHistory:  true,
+}
+
+// Enabled reports whether the named feature is on; unknown features are off
+func (f Features) Enabled(name string) bool {
+	return f[name]
+}
+
+// getFeaturesEnv applies comma-separated name=bool overrides from the
+// environment to the defaults, e.g. FEATURES=calendar=false,history=false
+func getFeaturesEnv(key string) (Features, error) {
+	features := make(Features, len(DefaultFeatures))
+	for name, enabled := range DefaultFeatures {
+		features[name] = enabled
+	}
+
+	for _, item := range getListEnv(key, nil) {
+		name, value, ok := strings.Cut(item, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, known := DefaultFeatures[name]; !known {
+			return nil, fmt.Errorf("%s contains unknown feature %q", key, name)
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if !ok || err != nil {
+			return nil, fmt.Errorf("%s entry %q must be name=true or name=false", key, item)
+		}
+		features[name] = enabled
+	}
+	return features, nil
+}
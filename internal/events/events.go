@@ -0,0 +1,61 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	// TodoReminder is published when a todo's reminder time passes; the
+	// payload is a models.TodoResponse
+	TodoReminder = "todo.reminder"
+	// EmailVerificationRequested is published when a user registers; the
+	// payload is a models.EmailVerification to deliver to them
+	EmailVerificationRequested = "user.email_verification_requested"
+	// PasswordResetRequested is published when a registered email asks for a
+	// password reset; the payload is a models.PasswordReset to deliver to them
+	PasswordResetRequested = "user.password_reset_requested"
+)
+
+// Event is something that happened to a user's data
+type Event struct {
+	Type       string
+	UserID     uint
+	OccurredAt time.Time
+	Payload    interface{}
+}
+
+// Handler receives published events. Handlers run synchronously on the
+// publishing goroutine, so slow work should be handed off.
+type Handler func(ctx context.Context, event Event)
+
+// Bus is an in-process publish/subscribe hub
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// NewBus creates an event bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe registers handler for events of the given type
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+// Publish delivers event to every handler subscribed to its type
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	b.mu.RLock()
+	handlers := b.handlers[event.Type]
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(ctx, event)
+	}
+}
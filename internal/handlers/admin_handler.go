@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bhaskar/todo-api/internal/middleware"
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/internal/services"
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler handles administrative endpoints
+type AdminHandler struct {
+	adminService *services.AdminService
+	routes       func() gin.RoutesInfo
+	publicRoutes middleware.PublicPaths
+}
+
+// NewAdminHandler creates a new admin handler. routes is usually the
+// engine's Routes method, so the listing reflects every registered route.
+func NewAdminHandler(adminService *services.AdminService, routes func() gin.RoutesInfo, publicRoutes middleware.PublicPaths) *AdminHandler {
+	return &AdminHandler{
+		adminService: adminService,
+		routes:       routes,
+		publicRoutes: publicRoutes,
+	}
+}
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	RequiresAuth bool   `json:"requires_auth"`
+}
+
+// ListRoutes godoc
+// @Summary List registered routes
+// @Description List every registered route, its method, and whether it requires authentication (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.APIResponse{data=[]handlers.RouteInfo}
+// @Failure 401 {object} utils.APIResponse
+// @Failure 403 {object} utils.APIResponse
+// @Router /api/routes [get]
+func (h *AdminHandler) ListRoutes(c *gin.Context) {
+	routes := h.routes()
+	result := make([]RouteInfo, len(routes))
+	for i, route := range routes {
+		// Only the /api group is behind the auth middleware
+		result[i] = RouteInfo{
+			Method:       route.Method,
+			Path:         route.Path,
+			RequiresAuth: strings.HasPrefix(route.Path, "/api/") && !h.publicRoutes.Matches(route.Path),
+		}
+	}
+
+	utils.OK(c, "Routes retrieved", result)
+}
+
+// ReassignTodo godoc
+// @Summary Reassign a todo to another user
+// @Description Move a todo and its subtasks to another user (admin only). A subtask moved on its own is detached from its parent. The change is recorded in the audit log. Fails with 409 if the user already has a todo with a moved todo's external ID.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Todo ID"
+// @Param request body models.ReassignTodoRequest true "New owner"
+// @Success 200 {object} utils.APIResponse{data=models.TodoResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 403 {object} utils.APIResponse
+// @Failure 404 {object} utils.APIResponse
+// @Failure 409 {object} utils.APIResponse
+// @Router /api/admin/todos/{id}/owner [put]
+func (h *AdminHandler) ReassignTodo(c *gin.Context) {
+	actorID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	todoID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.BadRequestError(c, "Invalid todo ID")
+		return
+	}
+
+	var req models.ReassignTodoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	todo, err := h.adminService.ReassignTodo(c.Request.Context(), actorID, uint(todoID), req.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTodoNotFound):
+			utils.NotFoundError(c, "Todo")
+		case err.Error() == "user not found":
+			utils.NotFoundError(c, "User")
+		case errors.Is(err, services.ErrExternalIDConflict):
+			utils.ConflictError(c, "The user already has a todo with this external ID")
+		default:
+			internalError(c, "Failed to reassign todo", err)
+		}
+		return
+	}
+
+	utils.OK(c, "Todo reassigned successfully", todo)
+}
+
+// UnlockUser godoc
+// @Summary Unlock a user account
+// @Description Lift a lockout caused by repeated failed logins before it expires (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.APIResponse
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 403 {object} utils.APIResponse
+// @Failure 404 {object} utils.APIResponse
+// @Router /api/admin/users/{id}/unlock [post]
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.BadRequestError(c, "Invalid user ID")
+		return
+	}
+
+	if err := h.adminService.UnlockUser(c.Request.Context(), uint(userID)); err != nil {
+		if err.Error() == "user not found" {
+			utils.NotFoundError(c, "User")
+			return
+		}
+		internalError(c, "Failed to unlock user", err)
+		return
+	}
+
+	utils.OK(c, "User unlocked", nil)
+}
+
+// Export godoc
+// @Summary Export all data
+// @Description Stream every user, each followed by their todos, as newline-delimited JSON for backups and migrations (admin only). Records include password hashes.
+// @Tags admin
+// @Produce application/x-ndjson
+// @Security BearerAuth
+// @Success 200 {object} models.ExportRecord "One record per line"
+// @Failure 401 {object} utils.APIResponse
+// @Failure 403 {object} utils.APIResponse
+// @Router /api/admin/export [get]
+func (h *AdminHandler) Export(c *gin.Context) {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="export.ndjson"`)
+	c.Status(http.StatusOK)
+
+	// Headers are sent by now, so a failure can only cut the stream short
+	encoder := json.NewEncoder(c.Writer)
+	err := h.adminService.Export(c.Request.Context(), func(record models.ExportRecord) error {
+		return encoder.Encode(record)
+	})
+	if err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// Import godoc
+// @Summary Import data
+// @Description Restore users and todos from an NDJSON export (admin only). Imported IDs are kept unless taken. Existing users (by email) and todos (by ID or external ID) are skipped, or overwritten in merge mode. Users may carry a bcrypt password_hash or a plaintext password, which is hashed.
+// @Tags admin
+// @Accept application/x-ndjson
+// @Produce json
+// @Security BearerAuth
+// @Param mode query string false "How to handle existing records" Enums(skip, merge) default(skip)
+// @Success 200 {object} utils.APIResponse{data=models.DataImportResult}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 403 {object} utils.APIResponse
+// @Router /api/admin/import [post]
+func (h *AdminHandler) Import(c *gin.Context) {
+	actorID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	mode := c.DefaultQuery("mode", models.ImportModeSkip)
+	if mode != models.ImportModeSkip && mode != models.ImportModeMerge {
+		utils.BadRequestError(c, "mode must be skip or merge")
+		return
+	}
+
+	result, err := h.adminService.Import(c.Request.Context(), actorID, c.Request.Body, mode == models.ImportModeMerge)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidImport) {
+			utils.Error(c, http.StatusBadRequest, utils.ErrCodeBadRequest, err.Error(), result)
+			return
+		}
+		internalError(c, "Failed to import data", err)
+		return
+	}
+
+	utils.OK(c, "Data imported", result)
+}
+
+// SearchUsers godoc
+// @Summary Search users by email prefix
+// @Description Find users whose email starts with the given prefix, case-insensitively (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param email query string true "Email prefix"
+// @Param limit query int false "Maximum results (1-50)" default(20)
+// @Success 200 {object} utils.APIResponse{data=[]models.UserResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 403 {object} utils.APIResponse
+// @Router /api/admin/users [get]
+func (h *AdminHandler) SearchUsers(c *gin.Context) {
+	prefix := strings.TrimSpace(c.Query("email"))
+	if prefix == "" {
+		utils.BadRequestError(c, "email prefix is required")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(services.DefaultUserSearchLimit)))
+	if err != nil || limit < 1 {
+		utils.BadRequestError(c, "limit must be a positive integer")
+		return
+	}
+
+	users, err := h.adminService.SearchUsers(c.Request.Context(), prefix, limit)
+	if err != nil {
+		internalError(c, "Failed to search users", err)
+		return
+	}
+
+	utils.OK(c, "Users retrieved", users)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/bhaskar/todo-api/internal/middleware"
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/internal/services"
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler handles API key management endpoints
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+// Create godoc
+// @Summary Create an API key
+// @Description Issue a long-lived API key, sent as "Authorization: Bearer <key>". The key is only returned once. Each user may hold a limited number of active keys.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateAPIKeyRequest true "Key name"
+// @Success 201 {object} utils.APIResponse{data=models.CreatedAPIKeyResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 409 {object} utils.APIResponse "Active key limit reached"
+// @Router /api/auth/api-keys [post]
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	key, err := h.apiKeyService.Create(c.Request.Context(), userID, &req)
+	if err != nil {
+		if errors.Is(err, services.ErrAPIKeyLimit) {
+			utils.ConflictError(c, err.Error())
+			return
+		}
+		internalError(c, "Failed to create API key", err)
+		return
+	}
+
+	utils.Created(c, "API key created", key)
+}
+
+// List godoc
+// @Summary List API keys
+// @Description List the active API keys, without the keys themselves
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.APIResponse{data=[]models.APIKeyResponse}
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/auth/api-keys [get]
+func (h *APIKeyHandler) List(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	keys, err := h.apiKeyService.List(c.Request.Context(), userID)
+	if err != nil {
+		internalError(c, "Failed to list API keys", err)
+		return
+	}
+
+	utils.OK(c, "API keys retrieved", keys)
+}
+
+// Revoke godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key; it stops authenticating immediately and no longer counts towards the limit
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} utils.APIResponse
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 404 {object} utils.APIResponse
+// @Router /api/auth/api-keys/{id} [delete]
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	keyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.BadRequestError(c, "Invalid API key ID")
+		return
+	}
+
+	if err := h.apiKeyService.Revoke(c.Request.Context(), userID, uint(keyID)); err != nil {
+		if err.Error() == "API key not found" {
+			utils.NotFoundError(c, "API key")
+			return
+		}
+		internalError(c, "Failed to revoke API key", err)
+		return
+	}
+
+	utils.OK(c, "API key revoked", nil)
+}
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
+	"github.com/bhaskar/todo-api/internal/middleware"
+	"github.com/bhaskar/todo-api/internal/models"
 	"github.com/bhaskar/todo-api/internal/services"
 	"github.com/bhaskar/todo-api/pkg/utils"
 	"github.com/gin-gonic/gin"
@@ -11,11 +15,12 @@ import (
 // AuthHandler handles authentication endpoints
 type AuthHandler struct {
 	authService *services.AuthService
+	todoService *services.TodoService
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(authService *services.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService *services.AuthService, todoService *services.TodoService) *AuthHandler {
+	return &AuthHandler{authService: authService, todoService: todoService}
 }
 
 // Register godoc
@@ -36,13 +41,17 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.Register(&req)
+	response, err := h.authService.Register(c.Request.Context(), &req)
 	if err != nil {
 		if err.Error() == "email already registered" {
 			utils.ConflictError(c, err.Error())
 			return
 		}
-		utils.InternalError(c, "Failed to register user")
+		if errors.Is(err, services.ErrInvalidEmail) || errors.Is(err, services.ErrUnknownClient) {
+			utils.ValidationError(c, err.Error())
+			return
+		}
+		internalError(c, "Failed to register user", err)
 		return
 	}
 
@@ -59,6 +68,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 // @Success 200 {object} utils.APIResponse{data=services.AuthResponse}
 // @Failure 400 {object} utils.APIResponse
 // @Failure 401 {object} utils.APIResponse
+// @Failure 403 {object} utils.APIResponse "Account locked or email not verified"
 // @Router /api/auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req services.LoginRequest
@@ -67,8 +77,20 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.Login(&req)
+	response, err := h.authService.Login(c.Request.Context(), &req)
 	if err != nil {
+		if errors.Is(err, services.ErrAccountLocked) {
+			utils.AccountLockedError(c, err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			utils.ForbiddenError(c, "Verify your email address before logging in")
+			return
+		}
+		if errors.Is(err, services.ErrUnknownClient) {
+			utils.ValidationError(c, err.Error())
+			return
+		}
 		utils.UnauthorizedError(c, err.Error())
 		return
 	}
@@ -76,13 +98,241 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	utils.OK(c, "Login successful", response)
 }
 
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Mark the account a verification token was sent to as verified. Tokens are delivered on registration, work once, and expire after EMAIL_VERIFICATION_TTL.
+// @Tags auth
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} utils.APIResponse{data=models.UserResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Router /api/auth/verify [get]
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	user, err := h.authService.VerifyEmail(c.Request.Context(), c.Query("token"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			utils.BadRequestError(c, "Invalid or expired verification token")
+			return
+		}
+		internalError(c, "Failed to verify email", err)
+		return
+	}
+
+	utils.OK(c, "Email verified", user)
+}
+
+// Refresh godoc
+// @Summary Refresh token
+// @Description Exchange the current token, sent as "Authorization: Bearer <token>", for a new one. Tokens that expired within the refresh grace window are still accepted. The exchanged token is revoked.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.APIResponse{data=services.AuthResponse}
+// @Failure 401 {object} utils.APIResponse
+// @Failure 403 {object} utils.APIResponse "Account locked"
+// @Router /api/auth/refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	scheme, token, ok := middleware.ExtractCredential(c.GetHeader("Authorization"))
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		utils.UnauthorizedError(c, "Invalid authorization format. Use: Bearer <token>")
+		return
+	}
+
+	response, err := h.authService.Refresh(c.Request.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidToken):
+			utils.UnauthorizedError(c, "Invalid or expired token")
+		case errors.Is(err, services.ErrAccountLocked):
+			utils.AccountLockedError(c, err.Error())
+		default:
+			internalError(c, "Failed to refresh token", err)
+		}
+		return
+	}
+
+	utils.OK(c, "Token refreshed", response)
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Revoke the JWT the request was made with, so it is rejected from now on. API keys are revoked through /api/auth/api-keys instead.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.APIResponse
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	_, token, ok := middleware.ExtractCredential(c.GetHeader("Authorization"))
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	if err := h.authService.Logout(c.Request.Context(), token); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidToken), errors.Is(err, utils.ErrTokenNotRevocable):
+			utils.BadRequestError(c, "Only JWTs issued by this server can be logged out")
+		default:
+			internalError(c, "Failed to logout", err)
+		}
+		return
+	}
+
+	utils.OK(c, "Logged out", nil)
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Replace the authenticated user's password; the current password must be given. Tokens issued before the change are revoked.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body services.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} utils.APIResponse
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse "Missing token or wrong current password"
+// @Router /api/auth/password [put]
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	var req services.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	err := h.authService.ChangePassword(c.Request.Context(), userID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrIncorrectPassword):
+			utils.UnauthorizedError(c, err.Error())
+		case err.Error() == "user not found":
+			utils.NotFoundError(c, "User")
+		default:
+			internalError(c, "Failed to change password", err)
+		}
+		return
+	}
+
+	utils.OK(c, "Password changed", nil)
+}
+
+// DeleteAccount godoc
+// @Summary Delete account
+// @Description Delete the authenticated user's account and all their todos. The password must be given to confirm. Tokens issued to the account are revoked.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body services.DeleteAccountRequest true "Current password"
+// @Success 200 {object} utils.APIResponse
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse "Missing token or wrong password"
+// @Router /api/auth/account [delete]
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	var req services.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	err := h.authService.DeleteAccount(c.Request.Context(), userID, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrIncorrectPassword):
+			utils.UnauthorizedError(c, "Password is incorrect")
+		case err.Error() == "user not found":
+			utils.NotFoundError(c, "User")
+		default:
+			internalError(c, "Failed to delete account", err)
+		}
+		return
+	}
+
+	utils.OK(c, "Account deleted", nil)
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Send a password reset token, valid for PASSWORD_RESET_TTL, to the given email. The response is the same whether or not the email is registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body services.ForgotPasswordRequest true "Account email"
+// @Success 200 {object} utils.APIResponse
+// @Failure 400 {object} utils.APIResponse
+// @Router /api/auth/forgot-password [post]
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req services.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	if err := h.authService.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		if errors.Is(err, services.ErrInvalidEmail) {
+			utils.ValidationError(c, err.Error())
+			return
+		}
+		internalError(c, "Failed to request password reset", err)
+		return
+	}
+
+	utils.OK(c, "If the email is registered, a password reset token has been sent to it", nil)
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Replace a password using the token from /api/auth/forgot-password. Each token works once. JWTs issued before the reset are revoked.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body services.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} utils.APIResponse
+// @Failure 400 {object} utils.APIResponse "Invalid password, or unknown or expired token"
+// @Router /api/auth/reset-password [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req services.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	if err := h.authService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			utils.BadRequestError(c, "Invalid or expired reset token")
+			return
+		}
+		internalError(c, "Failed to reset password", err)
+		return
+	}
+
+	utils.OK(c, "Password reset", nil)
+}
+
 // GetProfile godoc
 // @Summary Get current user profile
-// @Description Get the authenticated user's profile
+// @Description Get the authenticated user's profile, optionally embedding todo stats
 // @Tags auth
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {object} utils.APIResponse{data=models.UserResponse}
+// @Param include query string false "Comma-separated extras to embed" Enums(stats)
+// @Success 200 {object} utils.APIResponse{data=models.ProfileResponse}
+// @Failure 400 {object} utils.APIResponse
 // @Failure 401 {object} utils.APIResponse
 // @Router /api/auth/profile [get]
 func (h *AuthHandler) GetProfile(c *gin.Context) {
@@ -92,9 +342,22 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authService.GetUserByID(userID.(uint))
+	includeStats := false
+	if include := c.Query("include"); include != "" {
+		for _, part := range strings.Split(include, ",") {
+			switch strings.TrimSpace(part) {
+			case "stats":
+				includeStats = true
+			default:
+				utils.BadRequestError(c, "Unsupported include value: "+part)
+				return
+			}
+		}
+	}
+
+	user, err := h.authService.GetUserByID(c.Request.Context(), userID.(uint))
 	if err != nil {
-		utils.InternalError(c, "Failed to fetch profile")
+		internalError(c, "Failed to fetch profile", err)
 		return
 	}
 	if user == nil {
@@ -102,7 +365,157 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	utils.OK(c, "Profile retrieved", user.ToResponse())
+	profile := models.ProfileResponse{UserResponse: user.ToResponse()}
+	if includeStats {
+		profile.Stats, err = h.todoService.GetStats(c.Request.Context(), user.ID, nil, false)
+		if err != nil {
+			internalError(c, "Failed to fetch stats", err)
+			return
+		}
+	}
+
+	utils.OK(c, "Profile retrieved", profile)
+}
+
+// GetUsage godoc
+// @Summary Get storage usage
+// @Description Count the user's active and deleted todos and the bytes their text takes, for quota checks
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.APIResponse{data=models.UsageResponse}
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/auth/usage [get]
+func (h *AuthHandler) GetUsage(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	usage, err := h.todoService.Usage(c.Request.Context(), userID)
+	if err != nil {
+		internalError(c, "Failed to compute usage", err)
+		return
+	}
+
+	utils.OK(c, "Usage retrieved", usage)
+}
+
+// GenerateFeedToken godoc
+// @Summary Generate a calendar feed token
+// @Description Issue a token for the read-only calendar feed, replacing any previous one. The token is only returned once.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 201 {object} utils.APIResponse{data=models.FeedTokenResponse}
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/auth/feed-token [post]
+func (h *AuthHandler) GenerateFeedToken(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	token, err := h.authService.GenerateFeedToken(c.Request.Context(), userID)
+	if err != nil {
+		internalError(c, "Failed to generate feed token", err)
+		return
+	}
+
+	utils.Created(c, "Feed token generated", token)
+}
+
+// RevokeFeedToken godoc
+// @Summary Revoke the calendar feed token
+// @Description Disable the read-only calendar feed token
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/auth/feed-token [delete]
+func (h *AuthHandler) RevokeFeedToken(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	if err := h.authService.RevokeFeedToken(c.Request.Context(), userID); err != nil {
+		internalError(c, "Failed to revoke feed token", err)
+		return
+	}
+
+	utils.OK(c, "Feed token revoked", nil)
+}
+
+// GetPreferences godoc
+// @Summary Get preferences
+// @Description Get the authenticated user's preferences
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.APIResponse{data=models.PreferencesResponse}
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/auth/preferences [get]
+func (h *AuthHandler) GetPreferences(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	prefs, err := h.authService.GetPreferences(c.Request.Context(), userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			utils.NotFoundError(c, "User")
+			return
+		}
+		internalError(c, "Failed to fetch preferences", err)
+		return
+	}
+
+	utils.OK(c, "Preferences retrieved", prefs)
+}
+
+// UpdatePreferences godoc
+// @Summary Update preferences
+// @Description Update the authenticated user's preferences. due_soon_threshold is in seconds (0 disables the due_soon flag).
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.UpdatePreferencesRequest true "Preferences to change"
+// @Success 200 {object} utils.APIResponse{data=models.PreferencesResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/auth/preferences [put]
+func (h *AuthHandler) UpdatePreferences(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	var req models.UpdatePreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	prefs, err := h.authService.UpdatePreferences(c.Request.Context(), userID, &req)
+	if err != nil {
+		if err.Error() == "user not found" {
+			utils.NotFoundError(c, "User")
+			return
+		}
+		internalError(c, "Failed to update preferences", err)
+		return
+	}
+
+	utils.OK(c, "Preferences updated", prefs)
 }
 
 // HealthCheck godoc
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"github.com/bhaskar/todo-api/internal/middleware"
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// internalError logs err with the request's logger, so it can be correlated
+// by request ID, and sends a generic 500 that doesn't leak it
+func internalError(c *gin.Context, message string, err error) {
+	middleware.GetLogger(c).Printf("ERROR: %s: %v", message, err)
+	utils.InternalError(c, message)
+}
@@ -1,23 +1,35 @@
 package handlers
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/bhaskar/todo-api/internal/config"
 	"github.com/bhaskar/todo-api/internal/middleware"
 	"github.com/bhaskar/todo-api/internal/models"
 	"github.com/bhaskar/todo-api/internal/services"
 	"github.com/bhaskar/todo-api/pkg/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // TodoHandler handles todo endpoints
 type TodoHandler struct {
 	todoService *services.TodoService
+	config      config.TodoConfig
 }
 
 // NewTodoHandler creates a new todo handler
-func NewTodoHandler(todoService *services.TodoService) *TodoHandler {
-	return &TodoHandler{todoService: todoService}
+func NewTodoHandler(todoService *services.TodoService, cfg config.TodoConfig) *TodoHandler {
+	return &TodoHandler{
+		todoService: todoService,
+		config:      cfg,
+	}
 }
 
 // Create godoc
@@ -29,8 +41,10 @@ func NewTodoHandler(todoService *services.TodoService) *TodoHandler {
 // @Security BearerAuth
 // @Param request body models.CreateTodoRequest true "Todo data"
 // @Success 201 {object} utils.APIResponse{data=models.TodoResponse}
+// @Header 201 {string} X-Applied-Defaults "Comma-separated fields filled in by the server"
 // @Failure 400 {object} utils.APIResponse
 // @Failure 401 {object} utils.APIResponse
+// @Failure 409 {object} utils.APIResponse
 // @Router /api/todos [post]
 func (h *TodoHandler) Create(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
@@ -45,15 +59,90 @@ func (h *TodoHandler) Create(c *gin.Context) {
 		return
 	}
 
-	todo, err := h.todoService.Create(userID, &req)
+	// Let the client know which fields the server filled in
+	applied := req.ApplyDefaults()
+
+	todo, err := h.todoService.Create(c.Request.Context(), userID, &req)
 	if err != nil {
-		utils.InternalError(c, "Failed to create todo")
+		if errors.Is(err, services.ErrExternalIDConflict) {
+			utils.ConflictError(c, "A todo with this external ID already exists")
+			return
+		}
+		if errors.Is(err, services.ErrInvalidParent) {
+			utils.BadRequestError(c, "Parent todo not found")
+			return
+		}
+		if errors.Is(err, services.ErrInvalidReminder) {
+			utils.ValidationError(c, err.Error())
+			return
+		}
+		internalError(c, "Failed to create todo", err)
 		return
 	}
 
+	c.Header("X-Applied-Defaults", strings.Join(applied, ","))
 	utils.Created(c, "Todo created successfully", todo)
 }
 
+// Import godoc
+// @Summary Import todos
+// @Description Create todos from a JSON array. The array is decoded as a stream and rejected as soon as it exceeds the configured item limit.
+// @Tags todos
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body []models.CreateTodoRequest true "Todos to import"
+// @Success 201 {object} utils.APIResponse{data=models.TodoImportResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 409 {object} utils.APIResponse
+// @Failure 413 {object} utils.APIResponse
+// @Router /api/todos/import [post]
+func (h *TodoHandler) Import(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	var reqs []models.CreateTodoRequest
+	err := utils.DecodeJSONArray(c.Request.Body, h.config.ImportMaxItems, func(i int, req models.CreateTodoRequest) error {
+		if err := binding.Validator.ValidateStruct(&req); err != nil {
+			return fmt.Errorf("item %d: %w", i, err)
+		}
+		reqs = append(reqs, req)
+		return nil
+	})
+	if errors.Is(err, utils.ErrTooManyItems) {
+		utils.PayloadTooLargeError(c, fmt.Sprintf("Import is limited to %d todos", h.config.ImportMaxItems))
+		return
+	}
+	if err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	result, err := h.todoService.Import(c.Request.Context(), userID, reqs)
+	if err != nil {
+		if errors.Is(err, services.ErrExternalIDConflict) {
+			utils.ConflictError(c, "Import contains an external ID that is already in use")
+			return
+		}
+		if errors.Is(err, services.ErrInvalidParent) {
+			utils.BadRequestError(c, "Import references a parent todo that does not exist")
+			return
+		}
+		if errors.Is(err, services.ErrInvalidReminder) {
+			utils.ValidationError(c, err.Error())
+			return
+		}
+		internalError(c, "Failed to import todos", err)
+		return
+	}
+
+	utils.Created(c, "Todos imported successfully", result)
+}
+
 // List godoc
 // @Summary List todos
 // @Description Get paginated list of todos for the authenticated user
@@ -61,9 +150,22 @@ func (h *TodoHandler) Create(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Param page query int false "Page number" default(1)
-// @Param per_page query int false "Items per page" default(10)
-// @Param completed query bool false "Filter by completed status"
+// @Param per_page query int false "Items per page (default and maximum set by TODO_DEFAULT_PER_PAGE and TODO_MAX_PER_PAGE)" default(10)
+// @Param offset query int false "Todos to skip, instead of page (not combinable with page/per_page)"
+// @Param limit query int false "Todos to return with offset (1 to TODO_MAX_PER_PAGE)" default(10)
+// @Param completed query bool false "Filter by completed status" example(false)
+// @Param color query string false "Filter by color label (named color or hex code)" example(green)
+// @Param search query string false "Case-insensitive text to find in the title or description" example(groceries)
+// @Param tag query string false "Only todos with this tag (case-insensitive)" example(work)
+// @Param due_after query string false "Only todos due at or after this RFC3339 time" example(2024-01-01T00:00:00Z)
+// @Param due_before query string false "Only todos due at or before this RFC3339 time" example(2024-01-07T23:59:59Z)
+// @Param sort query string false "Sort field (default set by TODO_DEFAULT_SORT)" Enums(created_at, updated_at, due_date, priority, title) default(created_at)
+// @Param sort_by query string false "Alias of sort" Enums(created_at, updated_at, due_date, priority, title)
+// @Param order query string false "Sort direction (default set by TODO_DEFAULT_ORDER)" Enums(asc, desc) default(desc)
+// @Param include_summary query bool false "Add completed/pending/overdue counts across all matching todos"
+// @Param include_archived query bool false "Include archived todos"
 // @Success 200 {object} utils.APIResponse{data=models.TodoListResponse}
+// @Failure 400 {object} utils.APIResponse
 // @Failure 401 {object} utils.APIResponse
 // @Router /api/todos [get]
 func (h *TodoHandler) List(c *gin.Context) {
@@ -73,9 +175,43 @@ func (h *TodoHandler) List(c *gin.Context) {
 		return
 	}
 
-	// Parse query parameters
+	// Parse query parameters; offset/limit is an alternative to page/per_page
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "10"))
+	perPage, _ := strconv.Atoi(c.Query("per_page"))
+
+	var offset *int
+	_, hasOffset := c.GetQuery("offset")
+	_, hasLimit := c.GetQuery("limit")
+	if hasOffset || hasLimit {
+		_, hasPage := c.GetQuery("page")
+		_, hasPerPage := c.GetQuery("per_page")
+		if hasPage || hasPerPage {
+			utils.BadRequestError(c, "Use either offset/limit or page/per_page, not both")
+			return
+		}
+
+		value, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil {
+			utils.BadRequestError(c, "offset must be an integer")
+			return
+		}
+		defaultLimit, _ := h.config.PageSizes()
+		if perPage, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit))); err != nil {
+			utils.BadRequestError(c, "limit must be an integer")
+			return
+		}
+		offset = &value
+	}
+
+	// sort_by is accepted as an alias of sort
+	sort := c.Query("sort")
+	if sortBy := c.Query("sort_by"); sortBy != "" {
+		if sort != "" && sort != sortBy {
+			utils.BadRequestError(c, "Use either sort or sort_by, not both")
+			return
+		}
+		sort = sortBy
+	}
 
 	var completed *bool
 	if c.Query("completed") != "" {
@@ -83,15 +219,80 @@ func (h *TodoHandler) List(c *gin.Context) {
 		completed = &val
 	}
 
-	todos, err := h.todoService.List(userID, page, perPage, completed)
+	dueAfter, err := parseTimeQuery(c, "due_after")
 	if err != nil {
-		utils.InternalError(c, "Failed to fetch todos")
+		utils.BadRequestError(c, err.Error())
+		return
+	}
+	dueBefore, err := parseTimeQuery(c, "due_before")
+	if err != nil {
+		utils.BadRequestError(c, err.Error())
+		return
+	}
+
+	opts := models.TodoListOptions{
+		Page:      page,
+		PerPage:   perPage,
+		Offset:    offset,
+		Completed: completed,
+		Color:     c.Query("color"),
+		Search:    c.Query("search"),
+		Tag:       c.Query("tag"),
+		DueAfter:  dueAfter,
+		DueBefore: dueBefore,
+		Sort:      sort,
+		Order:     strings.ToLower(c.Query("order")),
+
+		IncludeSummary:  c.Query("include_summary") == "true",
+		IncludeArchived: c.Query("include_archived") == "true",
+	}
+
+	todos, err := h.todoService.List(c.Request.Context(), userID, opts)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidListOptions) {
+			utils.BadRequestError(c, err.Error())
+			return
+		}
+		internalError(c, "Failed to fetch todos", err)
 		return
 	}
 
 	utils.OK(c, "Todos retrieved", todos)
 }
 
+// Tree godoc
+// @Summary Get todos as a tree
+// @Description Get all todos with subtasks nested under their parents. Todos with subtasks below the depth cap are marked truncated.
+// @Tags todos
+// @Produce json
+// @Security BearerAuth
+// @Param depth query int false "Levels to return, counting top-level todos (1-5)" default(5)
+// @Success 200 {object} utils.APIResponse{data=[]models.TodoTreeNode}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/todos/tree [get]
+func (h *TodoHandler) Tree(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	depth, err := strconv.Atoi(c.DefaultQuery("depth", strconv.Itoa(services.MaxTreeDepth)))
+	if err != nil || depth < 1 || depth > services.MaxTreeDepth {
+		utils.BadRequestError(c, fmt.Sprintf("depth must be between 1 and %d", services.MaxTreeDepth))
+		return
+	}
+
+	tree, err := h.todoService.Tree(c.Request.Context(), userID, depth)
+	if err != nil {
+		internalError(c, "Failed to fetch todos", err)
+		return
+	}
+
+	utils.OK(c, "Todo tree retrieved", tree)
+}
+
 // GetByID godoc
 // @Summary Get a todo by ID
 // @Description Get a specific todo item by ID
@@ -99,9 +300,13 @@ func (h *TodoHandler) List(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "Todo ID"
+// @Param expand query string false "Comma-separated associations to include, or none (default set by TODO_DEFAULT_EXPAND)" Enums(subtasks, none)
 // @Success 200 {object} utils.APIResponse{data=models.TodoResponse}
+// @Header 200 {string} Last-Modified "Time the todo was last updated"
+// @Failure 400 {object} utils.APIResponse
 // @Failure 401 {object} utils.APIResponse
 // @Failure 404 {object} utils.APIResponse
+// @Failure 410 {object} utils.APIResponse
 // @Router /api/todos/{id} [get]
 func (h *TodoHandler) GetByID(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
@@ -116,15 +321,124 @@ func (h *TodoHandler) GetByID(c *gin.Context) {
 		return
 	}
 
-	todo, err := h.todoService.GetByID(uint(todoID), userID)
+	expand := h.config.DefaultExpand
+	if value, ok := c.GetQuery("expand"); ok {
+		expand = nil
+		if value != "none" {
+			for _, part := range strings.Split(value, ",") {
+				part = strings.TrimSpace(part)
+				if _, ok := models.TodoExpansions[part]; !ok {
+					utils.BadRequestError(c, "Unsupported expand value: "+part)
+					return
+				}
+				expand = append(expand, part)
+			}
+		}
+	}
+
+	todo, err := h.todoService.GetByID(c.Request.Context(), uint(todoID), userID, expand...)
+	if err != nil {
+		if errors.Is(err, services.ErrTodoGone) {
+			utils.GoneError(c, "Todo")
+			return
+		}
+		if errors.Is(err, services.ErrTodoNotFound) {
+			utils.NotFoundError(c, "Todo")
+			return
+		}
+		internalError(c, "Failed to retrieve todo", err)
+		return
+	}
+
+	setLastModified(c, todo)
+	utils.OK(c, "Todo retrieved", todo)
+}
+
+// GetByExternalID godoc
+// @Summary Get a todo by external ID
+// @Description Get a todo by the client-provided external ID it was created with
+// @Tags todos
+// @Produce json
+// @Security BearerAuth
+// @Param externalID path string true "External ID"
+// @Success 200 {object} utils.APIResponse{data=models.TodoResponse}
+// @Header 200 {string} Last-Modified "Time the todo was last updated"
+// @Failure 401 {object} utils.APIResponse
+// @Failure 404 {object} utils.APIResponse
+// @Router /api/todos/external/{externalID} [get]
+func (h *TodoHandler) GetByExternalID(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	todo, err := h.todoService.GetByExternalID(c.Request.Context(), c.Param("externalID"), userID)
 	if err != nil {
-		utils.NotFoundError(c, "Todo")
+		if errors.Is(err, services.ErrTodoNotFound) {
+			utils.NotFoundError(c, "Todo")
+			return
+		}
+		internalError(c, "Failed to retrieve todo", err)
 		return
 	}
 
+	setLastModified(c, todo)
 	utils.OK(c, "Todo retrieved", todo)
 }
 
+// UpsertByExternalID godoc
+// @Summary Create or replace a todo by external ID
+// @Description Replace the todo with the given external ID, or create it if none exists, so integrations can push changes idempotently
+// @Tags todos
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param externalID path string true "External ID"
+// @Param request body models.UpsertTodoRequest true "Todo data"
+// @Success 200 {object} utils.APIResponse{data=models.TodoResponse}
+// @Success 201 {object} utils.APIResponse{data=models.TodoResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 409 {object} utils.APIResponse "External ID held by another user (global scope)"
+// @Router /api/todos/external/{externalID} [put]
+func (h *TodoHandler) UpsertByExternalID(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	externalID := c.Param("externalID")
+	if len(externalID) > 255 {
+		utils.BadRequestError(c, "External ID must be at most 255 characters")
+		return
+	}
+
+	var req models.UpsertTodoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	todo, created, err := h.todoService.UpsertByExternalID(c.Request.Context(), userID, externalID, &req)
+	if err != nil {
+		if errors.Is(err, services.ErrExternalIDConflict) {
+			utils.ConflictError(c, "This external ID is already in use")
+			return
+		}
+		internalError(c, "Failed to save todo", err)
+		return
+	}
+
+	setLastModified(c, todo)
+	if created {
+		utils.Created(c, "Todo created successfully", todo)
+		return
+	}
+	utils.OK(c, "Todo updated successfully", todo)
+}
+
 // Update godoc
 // @Summary Update a todo
 // @Description Update a specific todo item
@@ -134,10 +448,13 @@ func (h *TodoHandler) GetByID(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path int true "Todo ID"
 // @Param request body models.UpdateTodoRequest true "Update data"
+// @Param If-Unmodified-Since header string false "Reject the update if the todo changed after this HTTP date"
 // @Success 200 {object} utils.APIResponse{data=models.TodoResponse}
+// @Header 200 {string} Last-Modified "Time the todo was last updated"
 // @Failure 400 {object} utils.APIResponse
 // @Failure 401 {object} utils.APIResponse
 // @Failure 404 {object} utils.APIResponse
+// @Failure 412 {object} utils.APIResponse
 // @Router /api/todos/{id} [put]
 func (h *TodoHandler) Update(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
@@ -158,27 +475,247 @@ func (h *TodoHandler) Update(c *gin.Context) {
 		return
 	}
 
-	todo, err := h.todoService.Update(uint(todoID), userID, &req)
+	// Invalid dates are ignored, as required for If-Unmodified-Since
+	var unmodifiedSince *time.Time
+	if header := c.GetHeader("If-Unmodified-Since"); header != "" {
+		if t, err := http.ParseTime(header); err == nil {
+			unmodifiedSince = &t
+		}
+	}
+
+	todo, err := h.todoService.Update(c.Request.Context(), uint(todoID), userID, &req, unmodifiedSince)
 	if err != nil {
-		if err.Error() == "todo not found" {
+		if errors.Is(err, services.ErrTodoNotFound) {
 			utils.NotFoundError(c, "Todo")
 			return
 		}
-		utils.InternalError(c, "Failed to update todo")
+		if errors.Is(err, services.ErrTodoModified) {
+			utils.PreconditionFailedError(c, "Todo has been modified since "+c.GetHeader("If-Unmodified-Since"))
+			return
+		}
+		if errors.Is(err, services.ErrInvalidReminder) || errors.Is(err, services.ErrInvalidTodo) {
+			utils.ValidationError(c, err.Error())
+			return
+		}
+		internalError(c, "Failed to update todo", err)
 		return
 	}
 
+	setLastModified(c, todo)
 	utils.OK(c, "Todo updated successfully", todo)
 }
 
+// History godoc
+// @Summary Get a todo's history
+// @Description Get every recorded version of a todo, oldest first. Each create, update, restore, owner change and admin import records one.
+// @Tags todos
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Todo ID"
+// @Success 200 {object} utils.APIResponse{data=[]models.TodoHistoryEntry}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 404 {object} utils.APIResponse
+// @Router /api/todos/{id}/history [get]
+func (h *TodoHandler) History(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	todoID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.BadRequestError(c, "Invalid todo ID")
+		return
+	}
+
+	history, err := h.todoService.History(c.Request.Context(), uint(todoID), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrTodoNotFound) {
+			utils.NotFoundError(c, "Todo")
+			return
+		}
+		internalError(c, "Failed to retrieve todo history", err)
+		return
+	}
+
+	utils.OK(c, "Todo history retrieved", history)
+}
+
+// HistoryDiff godoc
+// @Summary Diff two versions of a todo
+// @Description Get the fields that changed between two recorded versions of a todo, identified by the IDs from its history
+// @Tags todos
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Todo ID"
+// @Param from query int true "History entry ID of the older version"
+// @Param to query int true "History entry ID of the newer version"
+// @Success 200 {object} utils.APIResponse{data=models.TodoVersionDiff}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 404 {object} utils.APIResponse
+// @Router /api/todos/{id}/history/diff [get]
+func (h *TodoHandler) HistoryDiff(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	todoID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.BadRequestError(c, "Invalid todo ID")
+		return
+	}
+	fromID, err := strconv.ParseUint(c.Query("from"), 10, 32)
+	if err != nil {
+		utils.BadRequestError(c, "from must be a history entry ID")
+		return
+	}
+	toID, err := strconv.ParseUint(c.Query("to"), 10, 32)
+	if err != nil {
+		utils.BadRequestError(c, "to must be a history entry ID")
+		return
+	}
+
+	diff, err := h.todoService.VersionDiff(c.Request.Context(), uint(todoID), userID, uint(fromID), uint(toID))
+	if err != nil {
+		if errors.Is(err, services.ErrTodoNotFound) {
+			utils.NotFoundError(c, "Todo")
+			return
+		}
+		if errors.Is(err, services.ErrVersionNotFound) {
+			utils.NotFoundError(c, "Version")
+			return
+		}
+		internalError(c, "Failed to diff todo versions", err)
+		return
+	}
+
+	utils.OK(c, "Todo versions compared", diff)
+}
+
+// Restore godoc
+// @Summary Restore a deleted todo
+// @Description Bring back a soft-deleted todo. Todos that aren't deleted, or were deleted permanently, are not found. A todo whose external ID was reused since it was deleted conflicts.
+// @Tags todos
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Todo ID"
+// @Success 200 {object} utils.APIResponse{data=models.TodoResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 404 {object} utils.APIResponse
+// @Failure 409 {object} utils.APIResponse
+// @Router /api/todos/{id}/restore [post]
+func (h *TodoHandler) Restore(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	todoID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.BadRequestError(c, "Invalid todo ID")
+		return
+	}
+
+	todo, err := h.todoService.Restore(c.Request.Context(), uint(todoID), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrTodoNotFound) {
+			utils.NotFoundError(c, "Todo")
+			return
+		}
+		if errors.Is(err, services.ErrExternalIDConflict) {
+			utils.ConflictError(c, "Another todo now has this todo's external ID")
+			return
+		}
+		internalError(c, "Failed to restore todo", err)
+		return
+	}
+
+	setLastModified(c, todo)
+	utils.OK(c, "Todo restored", todo)
+}
+
+// Archive godoc
+// @Summary Archive a todo
+// @Description Hide a todo from lists without deleting it. Archiving an archived todo changes nothing.
+// @Tags todos
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Todo ID"
+// @Success 200 {object} utils.APIResponse{data=models.TodoResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 404 {object} utils.APIResponse
+// @Router /api/todos/{id}/archive [post]
+func (h *TodoHandler) Archive(c *gin.Context) {
+	h.setArchived(c, true)
+}
+
+// Unarchive godoc
+// @Summary Unarchive a todo
+// @Description Return an archived todo to lists. Unarchiving a todo that isn't archived changes nothing.
+// @Tags todos
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Todo ID"
+// @Success 200 {object} utils.APIResponse{data=models.TodoResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 404 {object} utils.APIResponse
+// @Router /api/todos/{id}/unarchive [post]
+func (h *TodoHandler) Unarchive(c *gin.Context) {
+	h.setArchived(c, false)
+}
+
+// setArchived handles the archive and unarchive endpoints
+func (h *TodoHandler) setArchived(c *gin.Context, archived bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	todoID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.BadRequestError(c, "Invalid todo ID")
+		return
+	}
+
+	todo, err := h.todoService.SetArchived(c.Request.Context(), uint(todoID), userID, archived)
+	if err != nil {
+		if errors.Is(err, services.ErrTodoNotFound) {
+			utils.NotFoundError(c, "Todo")
+			return
+		}
+		internalError(c, "Failed to update todo", err)
+		return
+	}
+
+	setLastModified(c, todo)
+	if archived {
+		utils.OK(c, "Todo archived", todo)
+	} else {
+		utils.OK(c, "Todo unarchived", todo)
+	}
+}
+
 // Delete godoc
 // @Summary Delete a todo
-// @Description Delete a specific todo item
+// @Description Delete a specific todo item. Responds 204 unless return=true asks for a count body like the bulk deletes.
 // @Tags todos
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "Todo ID"
+// @Param return query bool false "Respond 200 with the number of deleted todos instead of 204"
+// @Success 200 {object} utils.APIResponse{data=models.BulkDeleteResponse}
 // @Success 204 "No Content"
+// @Failure 400 {object} utils.APIResponse
 // @Failure 401 {object} utils.APIResponse
 // @Failure 404 {object} utils.APIResponse
 // @Router /api/todos/{id} [delete]
@@ -195,26 +732,107 @@ func (h *TodoHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	err = h.todoService.Delete(uint(todoID), userID)
+	returnCount := false
+	if raw := c.Query("return"); raw != "" {
+		returnCount, err = strconv.ParseBool(raw)
+		if err != nil {
+			utils.BadRequestError(c, "return must be true or false")
+			return
+		}
+	}
+
+	err = h.todoService.Delete(c.Request.Context(), uint(todoID), userID)
 	if err != nil {
-		if err.Error() == "todo not found" {
+		if errors.Is(err, services.ErrTodoNotFound) {
 			utils.NotFoundError(c, "Todo")
 			return
 		}
-		utils.InternalError(c, "Failed to delete todo")
+		internalError(c, "Failed to delete todo", err)
 		return
 	}
 
+	if returnCount {
+		respondDeleted(c, &models.BulkDeleteResponse{Deleted: 1})
+		return
+	}
 	utils.NoContent(c)
 }
 
+// ClearCompleted godoc
+// @Summary Delete completed todos
+// @Description Delete all of the user's completed todos and report how many were removed
+// @Tags todos
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.APIResponse{data=models.BulkDeleteResponse}
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/todos/completed [delete]
+func (h *TodoHandler) ClearCompleted(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	result, err := h.todoService.ClearCompleted(c.Request.Context(), userID)
+	if err != nil {
+		internalError(c, "Failed to delete completed todos", err)
+		return
+	}
+
+	respondDeleted(c, result)
+}
+
+// BulkDelete godoc
+// @Summary Delete several todos
+// @Description Delete a batch of todo IDs (1-100) in a single statement and report how many were removed. IDs not owned by the user are skipped.
+// @Tags todos
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.BulkDeleteRequest true "Todo IDs"
+// @Success 200 {object} utils.APIResponse{data=models.BulkDeleteResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/todos/bulk [delete]
+func (h *TodoHandler) BulkDelete(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	var req models.BulkDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	result, err := h.todoService.BulkDelete(c.Request.Context(), userID, req.IDs)
+	if err != nil {
+		internalError(c, "Failed to delete todos", err)
+		return
+	}
+
+	respondDeleted(c, result)
+}
+
+// respondDeleted reports a delete's count. Every delete that returns a body
+// uses it, so single and bulk deletes share one response shape.
+func respondDeleted(c *gin.Context, result *models.BulkDeleteResponse) {
+	utils.OK(c, "Todos deleted", result)
+}
+
 // GetStats godoc
 // @Summary Get todo statistics
-// @Description Get todo statistics for the authenticated user
+// @Description Get todo statistics for the authenticated user, including the average time to complete as an ISO 8601 duration
 // @Tags todos
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {object} utils.APIResponse{data=map[string]int64}
+// @Param metrics query string false "Comma-separated metrics to compute (default all): total, completed, pending, overdue, average_completion_time, by_priority" example(total,completed,pending)
+// @Param include_deleted query bool false "Count deleted todos too, for lifetime stats"
+// @Success 200 {object} utils.APIResponse{data=models.TodoStats}
+// @Failure 400 {object} utils.APIResponse
 // @Failure 401 {object} utils.APIResponse
 // @Router /api/todos/stats [get]
 func (h *TodoHandler) GetStats(c *gin.Context) {
@@ -224,11 +842,303 @@ func (h *TodoHandler) GetStats(c *gin.Context) {
 		return
 	}
 
-	stats, err := h.todoService.GetStats(userID)
+	var metrics []string
+	if param := c.Query("metrics"); param != "" {
+		for _, metric := range strings.Split(param, ",") {
+			metrics = append(metrics, strings.TrimSpace(metric))
+		}
+	}
+
+	includeDeleted := c.Query("include_deleted") == "true"
+	stats, err := h.todoService.GetStats(c.Request.Context(), userID, metrics, includeDeleted)
 	if err != nil {
-		utils.InternalError(c, "Failed to fetch statistics")
+		if errors.Is(err, services.ErrInvalidStatsMetrics) {
+			utils.BadRequestError(c, err.Error())
+			return
+		}
+		internalError(c, "Failed to fetch statistics", err)
 		return
 	}
 
 	utils.OK(c, "Statistics retrieved", stats)
 }
+
+// Calendar godoc
+// @Summary Get todos as an iCalendar feed
+// @Description Get every todo with a due date as a VEVENT, with completion status in CATEGORIES
+// @Tags todos
+// @Produce text/calendar
+// @Security BearerAuth
+// @Success 200 {string} string "iCalendar feed"
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/todos/calendar.ics [get]
+func (h *TodoHandler) Calendar(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	events, err := h.todoService.Calendar(c.Request.Context(), userID)
+	if err != nil {
+		internalError(c, "Failed to build calendar", err)
+		return
+	}
+
+	writeCalendar(c, events)
+}
+
+// CalendarFeed godoc
+// @Summary Get todos as an iCalendar feed using a feed token
+// @Description Same feed as /api/todos/calendar.ics, authenticated by the token in the path for calendar clients that cannot send headers
+// @Tags todos
+// @Produce text/calendar
+// @Param token path string true "Feed token followed by .ics"
+// @Success 200 {string} string "iCalendar feed"
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/todos/calendar/{token} [get]
+func (h *TodoHandler) CalendarFeed(c *gin.Context) {
+	token, ok := strings.CutSuffix(c.Param("token"), ".ics")
+	if !ok || token == "" {
+		utils.NotFoundError(c, "Calendar")
+		return
+	}
+
+	events, err := h.todoService.CalendarForFeedToken(c.Request.Context(), token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidFeedToken) {
+			utils.UnauthorizedError(c, "Invalid feed token")
+			return
+		}
+		internalError(c, "Failed to build calendar", err)
+		return
+	}
+
+	writeCalendar(c, events)
+}
+
+// writeCalendar renders events as an iCalendar document
+func writeCalendar(c *gin.Context, events []utils.ICalEvent) {
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := utils.WriteICalendar(c.Writer, "-//todo-api//Todos//EN", "Todos", events); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// GetVelocity godoc
+// @Summary Get completion velocity
+// @Description Get the average todos completed per day over a window and a projection for clearing pending todos
+// @Tags todos
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "Window size in days (1-365)" default(14)
+// @Success 200 {object} utils.APIResponse{data=models.VelocityResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/todos/velocity [get]
+func (h *TodoHandler) GetVelocity(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "14"))
+	if err != nil || days < 1 || days > 365 {
+		utils.BadRequestError(c, "days must be between 1 and 365")
+		return
+	}
+
+	velocity, err := h.todoService.GetVelocity(c.Request.Context(), userID, days)
+	if err != nil {
+		internalError(c, "Failed to compute velocity", err)
+		return
+	}
+
+	utils.OK(c, "Velocity retrieved", velocity)
+}
+
+// CompletedToday godoc
+// @Summary Get todos completed today
+// @Description Get the todos completed since midnight in the given IANA timezone, in completion order, for end-of-day reviews
+// @Tags todos
+// @Produce json
+// @Security BearerAuth
+// @Param tz query string false "IANA timezone, e.g. Europe/Berlin" default(UTC)
+// @Success 200 {object} utils.APIResponse{data=models.CompletedTodayResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/todos/completed-today [get]
+func (h *TodoHandler) CompletedToday(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	// LoadLocation treats "Local" as the server's zone, which clients can't know
+	tz := c.DefaultQuery("tz", "UTC")
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "Local" {
+		utils.BadRequestError(c, "tz must be an IANA timezone name")
+		return
+	}
+
+	result, err := h.todoService.CompletedOnDay(c.Request.Context(), userID, time.Now().In(loc))
+	if err != nil {
+		internalError(c, "Failed to retrieve completed todos", err)
+		return
+	}
+
+	utils.OK(c, "Completed todos retrieved", result)
+}
+
+// Exists godoc
+// @Summary Check which todos still exist
+// @Description Check a batch of client-known todo IDs (max 500) and report which still exist and which were deleted
+// @Tags todos
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.TodoExistsRequest true "Todo IDs to check"
+// @Success 200 {object} utils.APIResponse{data=models.TodoExistsResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/todos/exists [post]
+func (h *TodoHandler) Exists(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	var req models.TodoExistsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	result, err := h.todoService.Exists(c.Request.Context(), userID, req.IDs)
+	if err != nil {
+		internalError(c, "Failed to check todos", err)
+		return
+	}
+
+	utils.OK(c, "Todos checked", result)
+}
+
+// BulkComplete godoc
+// @Summary Complete several todos
+// @Description Mark a batch of todo IDs (max 500) completed or not completed in a single transaction, recording a version for each todo that changes. IDs not owned by the user, and todos already in the requested state, are not counted.
+// @Tags todos
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.BulkCompleteRequest true "Todo IDs and completed state"
+// @Success 200 {object} utils.APIResponse{data=models.BulkUpdateResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/todos/bulk [patch]
+func (h *TodoHandler) BulkComplete(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	var req models.BulkCompleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	result, err := h.todoService.BulkUpdateCompleted(c.Request.Context(), userID, req.IDs, *req.Completed)
+	if err != nil {
+		internalError(c, "Failed to update todos", err)
+		return
+	}
+
+	utils.OK(c, "Todos updated", result)
+}
+
+// BulkSetPriority godoc
+// @Summary Set priority on several todos
+// @Description Set one priority on a batch of todo IDs (max 500) in a single transaction. IDs not owned by the user, and todos that already have the priority, are not counted.
+// @Tags todos
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.BulkPriorityRequest true "Todo IDs and priority"
+// @Success 200 {object} utils.APIResponse{data=models.BulkUpdateResponse}
+// @Failure 400 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Router /api/todos/bulk/priority [post]
+func (h *TodoHandler) BulkSetPriority(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedError(c, "")
+		return
+	}
+
+	var req models.BulkPriorityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	result, err := h.todoService.SetPriority(c.Request.Context(), userID, &req)
+	if err != nil {
+		internalError(c, "Failed to update todos", err)
+		return
+	}
+
+	utils.OK(c, "Todos updated", result)
+}
+
+// setLastModified exposes a todo's update time for conditional requests
+func setLastModified(c *gin.Context, todo *models.TodoResponse) {
+	c.Header("Last-Modified", todo.UpdatedAt.UTC().Format(http.TimeFormat))
+}
+
+// parseTimeQuery parses an optional RFC3339 query parameter, returning nil
+// when it is absent
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC3339 time", name)
+	}
+	return &t, nil
+}
+
+// Meta godoc
+// @Summary Get server limits
+// @Description Get the configured list page sizes, request size limits and accepted values for todo fields. No authentication required.
+// @Tags meta
+// @Produce json
+// @Success 200 {object} utils.APIResponse{data=models.MetaResponse}
+// @Router /api/meta [get]
+func (h *TodoHandler) Meta(c *gin.Context) {
+	perPage, maxPerPage := h.config.PageSizes()
+	utils.OK(c, "Server metadata", models.MetaResponse{
+		DefaultPerPage:       perPage,
+		MaxPerPage:           maxPerPage,
+		MaxBulkUpdateIDs:     models.MaxBulkUpdateIDs,
+		MaxBulkDeleteIDs:     models.MaxBulkDeleteIDs,
+		MaxImportItems:       h.config.ImportMaxItems,
+		MaxTitleLength:       models.MaxTitleLength,
+		MaxDescriptionLength: models.MaxDescriptionLength,
+		MaxTagsPerTodo:       models.MaxTagsPerTodo,
+		Priorities:           models.TodoPriorities,
+		DefaultPriority:      models.DefaultPriority,
+		SortFields:           models.TodoSortFields,
+		DefaultSort:          cmp.Or(h.config.DefaultSort, "created_at"),
+		DefaultOrder:         cmp.Or(h.config.DefaultOrder, "desc"),
+		Colors:               models.TodoColors,
+		Recurrences:          models.Recurrences,
+	})
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminChecker reports whether a user has administrative privileges
+type AdminChecker interface {
+	IsAdmin(ctx context.Context, userID uint) (bool, error)
+}
+
+// RequireAdmin restricts a route to administrators. It must run after
+// AuthMiddleware so the user ID is available in context.
+func RequireAdmin(checker AdminChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := GetUserID(c)
+		if !ok {
+			utils.UnauthorizedError(c, "")
+			c.Abort()
+			return
+		}
+
+		isAdmin, err := checker.IsAdmin(c.Request.Context(), userID)
+		if err != nil {
+			utils.InternalError(c, "Failed to verify permissions")
+			c.Abort()
+			return
+		}
+		if !isAdmin {
+			utils.ForbiddenError(c, "Admin access required")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
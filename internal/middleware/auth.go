@@ -1,47 +1,131 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"strings"
 
+	"github.com/bhaskar/todo-api/internal/models"
 	"github.com/bhaskar/todo-api/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
 
+// APIKeyAuthenticator resolves an API key to its owner, returning nil when
+// the key is unknown or revoked
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*models.User, error)
+}
+
 // AuthMiddleware creates JWT authentication middleware
 func AuthMiddleware(jwtManager *utils.JWTManager) gin.HandlerFunc {
+	return AuthMiddlewareWithPublicPaths(jwtManager, nil)
+}
+
+// AuthMiddlewareWithPublicPaths creates JWT authentication middleware that
+// does not enforce authentication on public paths. A valid token sent to a
+// public path still populates the user context.
+func AuthMiddlewareWithPublicPaths(jwtManager *utils.JWTManager, public PublicPaths) gin.HandlerFunc {
+	return AuthMiddlewareWithAPIKeys(jwtManager, public, nil)
+}
+
+// AuthMiddlewareWithAPIKeys is AuthMiddlewareWithPublicPaths that also
+// accepts API keys (bearer credentials starting with models.APIKeyPrefix)
+// when keys is non-nil
+func AuthMiddlewareWithAPIKeys(jwtManager *utils.JWTManager, public PublicPaths, keys APIKeyAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			utils.UnauthorizedError(c, "Authorization header required")
-			c.Abort()
+		if public.Matches(c.Request.URL.Path) || public.Matches(c.FullPath()) {
+			if c.GetHeader("Authorization") != "" {
+				authenticate(c, jwtManager, keys)
+			}
+			c.Next()
 			return
 		}
 
-		// Check Bearer prefix
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			utils.UnauthorizedError(c, "Invalid authorization format. Use: Bearer <token>")
+		if message, ok := authenticate(c, jwtManager, keys); !ok {
+			utils.UnauthorizedError(c, message)
 			c.Abort()
 			return
 		}
 
-		tokenString := parts[1]
+		c.Next()
+	}
+}
 
-		// Validate token
-		claims, err := jwtManager.ValidateToken(tokenString)
-		if err != nil {
-			utils.UnauthorizedError(c, "Invalid or expired token")
-			c.Abort()
-			return
+// authenticate validates the bearer token or API key and stores user info in
+// context. On failure it returns a message suitable for the client.
+func authenticate(c *gin.Context, jwtManager *utils.JWTManager, keys APIKeyAuthenticator) (string, bool) {
+	// Get Authorization header
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		return "Authorization header required", false
+	}
+
+	// Check Bearer prefix
+	scheme, tokenString, ok := ExtractCredential(authHeader)
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "Invalid authorization format. Use: Bearer <token>", false
+	}
+
+	if keys != nil && strings.HasPrefix(tokenString, models.APIKeyPrefix) {
+		user, err := keys.AuthenticateAPIKey(c.Request.Context(), tokenString)
+		if err != nil || user == nil {
+			return "Invalid or revoked API key", false
 		}
+		c.Set("user_id", user.ID)
+		c.Set("user_email", user.Email)
+		return "", true
+	}
+
+	// Validate token
+	claims, err := jwtManager.ValidateToken(tokenString)
+	if errors.Is(err, utils.ErrIssuerMismatch) {
+		return "Token was not issued by this server", false
+	}
+	if errors.Is(err, utils.ErrAudienceMismatch) {
+		return "Token is not scoped to a client this server accepts", false
+	}
+	if err != nil {
+		return "Invalid or expired token", false
+	}
 
-		// Store user info in context
-		c.Set("user_id", claims.UserID)
-		c.Set("user_email", claims.Email)
+	// Store user info in context
+	c.Set("user_id", claims.UserID)
+	c.Set("user_email", claims.Email)
 
-		c.Next()
+	return "", true
+}
+
+// PublicPaths lists paths that bypass authentication. Entries match exactly,
+// or as a prefix when they end in "*". Route patterns such as
+// "/api/todos/:id" are matched against the registered route.
+type PublicPaths []string
+
+// Matches reports whether path is public
+func (p PublicPaths) Matches(path string) bool {
+	if path == "" {
+		return false
+	}
+	for _, public := range p {
+		if prefix, ok := strings.CutSuffix(public, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == public {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractCredential splits an Authorization header into its scheme and
+// credential. Surrounding and separating whitespace is tolerated; callers
+// should compare the scheme case-insensitively.
+func ExtractCredential(header string) (scheme, value string, ok bool) {
+	fields := strings.Fields(header)
+	if len(fields) != 2 {
+		return "", "", false
 	}
+	return fields[0], fields[1], true
 }
 
 // GetUserID extracts user ID from context
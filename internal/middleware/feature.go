@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireFeature hides routes behind the named feature flag: while it is
+// disabled they respond 404 as if they had never been registered
+func RequireFeature(features map[string]bool, name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !features[name] {
+			utils.NotFoundError(c, "Route")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// HTTPSMiddleware enforces TLS for deployments behind a TLS-terminating proxy.
+// Every response carries Strict-Transport-Security; requests the proxy reports
+// as plain HTTP via X-Forwarded-Proto are redirected to HTTPS when safe to
+// replay (GET/HEAD) and rejected otherwise, since their body was already sent
+// in the clear.
+func HTTPSMiddleware(hstsMaxAge time.Duration) gin.HandlerFunc {
+	hsts := "max-age=" + strconv.Itoa(int(hstsMaxAge.Seconds())) + "; includeSubDomains"
+
+	return func(c *gin.Context) {
+		c.Header("Strict-Transport-Security", hsts)
+
+		if !strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "http") {
+			c.Next()
+			return
+		}
+
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Redirect(http.StatusMovedPermanently, "https://"+c.Request.Host+c.Request.URL.RequestURI())
+			c.Abort()
+			return
+		}
+
+		utils.BadRequestError(c, "HTTPS is required")
+		c.Abort()
+	}
+}
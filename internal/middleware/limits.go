@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// MaxHeadersMiddleware rejects requests carrying more than maxCount header
+// fields or more than maxBytes of header names and values with 431 Request
+// Header Fields Too Large. A limit of 0 disables that check.
+func MaxHeadersMiddleware(maxCount, maxBytes int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, size := 0, 0
+		for name, values := range c.Request.Header {
+			for _, value := range values {
+				count++
+				size += len(name) + len(value)
+			}
+		}
+
+		switch {
+		case maxCount > 0 && count > maxCount:
+			utils.HeadersTooLargeError(c, fmt.Sprintf("Request has more than %d header fields", maxCount))
+		case maxBytes > 0 && size > maxBytes:
+			utils.HeadersTooLargeError(c, fmt.Sprintf("Request headers exceed %d bytes", maxBytes))
+		default:
+			c.Next()
+			return
+		}
+		c.Abort()
+	}
+}
+
+// MaxQueryLengthMiddleware rejects requests whose raw query string exceeds
+// maxLength bytes with 414 URI Too Long, before any handler parses it
+func MaxQueryLengthMiddleware(maxLength int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(c.Request.URL.RawQuery) > maxLength {
+			utils.URITooLongError(c, fmt.Sprintf("Query string exceeds %d bytes", maxLength))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ConcurrencyLimitMiddleware caps the number of requests processed at once.
+// Requests arriving while all slots are busy are shed with a 503 instead of
+// queuing, which keeps the database from being overwhelmed during spikes.
+func ConcurrencyLimitMiddleware(maxConcurrent int, retryAfter time.Duration) gin.HandlerFunc {
+	slots := make(chan struct{}, maxConcurrent)
+	retrySeconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+
+	return func(c *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			c.Next()
+		default:
+			c.Header("Retry-After", retrySeconds)
+			utils.ServiceUnavailableError(c, "Server is busy. Please try again later.")
+			c.Abort()
+		}
+	}
+}
@@ -1,25 +1,59 @@
 package middleware
 
 import (
+	"fmt"
 	"log"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/bhaskar/todo-api/pkg/database"
+	"github.com/bhaskar/todo-api/pkg/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// DefaultRequestIDHeader is the header used to carry request IDs
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// LoggerConfig configures the Logger middleware
+type LoggerConfig struct {
+	// RequestIDHeader is read from requests and echoed on responses
+	RequestIDHeader string
+	// FallbackRequestIDHeaders are read, in order, when RequestIDHeader is absent
+	FallbackRequestIDHeaders []string
+}
+
 // Logger creates a structured logging middleware
 func Logger() gin.HandlerFunc {
+	return LoggerWithConfig(LoggerConfig{RequestIDHeader: DefaultRequestIDHeader})
+}
+
+// LoggerWithConfig creates a structured logging middleware that reuses a
+// request ID supplied by an upstream proxy, or generates one
+func LoggerWithConfig(cfg LoggerConfig) gin.HandlerFunc {
+	if cfg.RequestIDHeader == "" {
+		cfg.RequestIDHeader = DefaultRequestIDHeader
+	}
+	headers := append([]string{cfg.RequestIDHeader}, cfg.FallbackRequestIDHeaders...)
+
 	return func(c *gin.Context) {
-		// Generate request ID
-		requestID := uuid.New().String()
+		// Reuse an incoming request ID, or generate one
+		requestID := incomingRequestID(c, headers)
+		if requestID == "" {
+			requestID = uuid.New().String()
+		}
 		c.Set("request_id", requestID)
-		c.Header("X-Request-ID", requestID)
+		c.Header(cfg.RequestIDHeader, requestID)
+
+		// Bind the request ID to a logger handlers and services can share
+		logger := log.New(log.Writer(), "["+shortID(requestID)+"] ", log.Flags()|log.Lmsgprefix)
+		c.Request = c.Request.WithContext(utils.WithLogger(c.Request.Context(), logger))
 
 		// Start timer
 		start := time.Now()
 		path := c.Request.URL.Path
-		query := c.Request.URL.RawQuery
+		query := redactQuery(c.Request.URL.RawQuery)
 
 		// Process request
 		c.Next()
@@ -34,8 +68,8 @@ func Logger() gin.HandlerFunc {
 		clientIP := c.ClientIP()
 
 		// Log format
-		log.Printf("[%s] %d | %s | %s | %s %s | %v",
-			requestID[:8],
+		line := fmt.Sprintf("[%s] %d | %s | %s | %s %s | %v",
+			shortID(requestID),
 			statusCode,
 			clientIP,
 			c.Request.Method,
@@ -44,15 +78,90 @@ func Logger() gin.HandlerFunc {
 			latency,
 		)
 
+		// Include the query count when QueryCount is enabled
+		if counter := database.QueryCounterFromContext(c.Request.Context()); counter != nil {
+			line += fmt.Sprintf(" | %d queries", counter.Count())
+		}
+
+		log.Print(line)
+
 		// Log errors if any
 		if len(c.Errors) > 0 {
 			for _, err := range c.Errors {
-				log.Printf("[%s] ERROR: %s", requestID[:8], err.Error())
+				log.Printf("[%s] ERROR: %s", shortID(requestID), err.Error())
 			}
 		}
 	}
 }
 
+// redactedParams are query parameters carrying secrets, such as email
+// verification tokens, that must not reach the access log
+var redactedParams = []string{"token"}
+
+// redactQuery masks the values of redactedParams in a raw query string,
+// leaving the rest as sent
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if slices.Contains(redactedParams, name) {
+			params[i] = name + "=REDACTED"
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// GetLogger returns the request's logger, which prefixes lines with the
+// request ID. Outside the Logger middleware it returns the standard logger.
+func GetLogger(c *gin.Context) *log.Logger {
+	return utils.LoggerFromContext(c.Request.Context())
+}
+
+// incomingRequestID returns the first acceptable request ID found in headers
+func incomingRequestID(c *gin.Context, headers []string) string {
+	for _, header := range headers {
+		if id := c.GetHeader(header); validRequestID(id) {
+			return id
+		}
+	}
+	return ""
+}
+
+// validRequestID guards against log injection through client-supplied IDs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// shortID abbreviates a request ID for log lines
+func shortID(requestID string) string {
+	if len(requestID) > 8 {
+		return requestID[:8]
+	}
+	return requestID
+}
+
+// QueryCount attaches a database query counter to each request so Logger
+// can report how many queries it issued. Useful for spotting N+1 queries;
+// requires the database to be connected with CountQueries enabled.
+func QueryCount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, _ := database.WithQueryCounter(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
 // GetRequestID extracts request ID from context
 func GetRequestID(c *gin.Context) string {
 	requestID, exists := c.Get("request_id")
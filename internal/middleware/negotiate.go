@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Media types the API can respond with
+const (
+	MIMEJSON     = "application/json"
+	MIMECSV      = "text/csv"
+	MIMENDJSON   = "application/x-ndjson"
+	MIMECalendar = "text/calendar"
+)
+
+// Negotiate picks the best of offers, in order of preference, for the
+// request's Accept header and stores it for handlers (see NegotiatedType).
+// A missing Accept header gets the first offer; when the client accepts none
+// of them the request is rejected with 406.
+func Negotiate(offers ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chosen := negotiate(c.GetHeader("Accept"), offers)
+		if chosen == "" {
+			utils.NotAcceptableError(c, "Supported types: "+strings.Join(offers, ", "))
+			c.Abort()
+			return
+		}
+		c.Set("content_type", chosen)
+		c.Next()
+	}
+}
+
+// NegotiatedType returns the media type chosen by Negotiate, or "" if the
+// route doesn't negotiate
+func NegotiatedType(c *gin.Context) string {
+	return c.GetString("content_type")
+}
+
+// mediaRange is one entry of an Accept header
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// negotiate returns the offer with the highest quality in accept, preferring
+// earlier offers on ties, or "" if none is acceptable
+func negotiate(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" && len(offers) > 0 {
+		return offers[0]
+	}
+	ranges := parseAccept(accept)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := quality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// quality returns the q-value of the most specific range matching offer
+func quality(ranges []mediaRange, offer string) float64 {
+	typ, subtype, _ := strings.Cut(offer, "/")
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		var s int
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+// parseAccept splits an Accept header into media ranges, skipping malformed
+// entries. Parameters other than q are ignored.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, entry := range strings.Split(accept, ",") {
+		params := strings.Split(entry, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || typ == "" || subtype == "" {
+			continue
+		}
+
+		r := mediaRange{typ: typ, subtype: subtype, q: 1}
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil && q >= 0 && q <= 1 {
+					r.q = q
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
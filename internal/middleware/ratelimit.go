@@ -1,110 +1,144 @@
 package middleware
 
 import (
-	"net/http"
+	"math"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/bhaskar/todo-api/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
 
-// RateLimiter implements a simple in-memory rate limiter
+// RateLimiter implements an in-memory rate limiter with a token bucket per
+// key. Each bucket holds up to limit tokens and refills at limit per window.
 type RateLimiter struct {
-	requests map[string][]time.Time
-	mu       sync.RWMutex
-	limit    int
-	window   time.Duration
+	buckets map[string]*bucket
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	now     func() time.Time
+}
+
+// bucket is one key's token bucket, as of its last refill
+type bucket struct {
+	tokens float64
+	last   time.Time
 }
 
 // NewRateLimiter creates a new rate limiter
 func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
 	rl := &RateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
+		buckets: make(map[string]*bucket),
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
 	}
-	
+
 	// Start cleanup goroutine
 	go rl.cleanup()
-	
+
 	return rl
 }
 
-// Allow checks if a request should be allowed
-func (rl *RateLimiter) Allow(key string) bool {
+// UseClock makes the limiter read the time from now instead of the wall clock
+func (rl *RateLimiter) UseClock(now func() time.Time) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
+	rl.now = now
+}
 
-	now := time.Now()
-	windowStart := now.Add(-rl.window)
-
-	// Get existing requests for this key
-	requests := rl.requests[key]
+// Allow checks if a request should be allowed, spending one of key's tokens
+func (rl *RateLimiter) Allow(key string) bool {
+	allowed, _, _ := rl.Take(key)
+	return allowed
+}
 
-	// Filter out old requests
-	var validRequests []time.Time
-	for _, t := range requests {
-		if t.After(windowStart) {
-			validRequests = append(validRequests, t)
-		}
-	}
+// Take is Allow that also reports how many requests key has left and, when
+// the request is refused, how long until the next one is allowed
+func (rl *RateLimiter) Take(key string) (allowed bool, remaining int, retryAfter time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
 
-	// Check if limit exceeded
-	if len(validRequests) >= rl.limit {
-		rl.requests[key] = validRequests
-		return false
+	now := rl.now()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rl.limit), last: now}
+		rl.buckets[key] = b
 	}
 
-	// Add current request
-	validRequests = append(validRequests, now)
-	rl.requests[key] = validRequests
+	// Refill for the time since the last request, up to the limit
+	perSecond := float64(rl.limit) / rl.window.Seconds()
+	b.tokens = min(float64(rl.limit), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
 
-	return true
+	if b.tokens < 1 {
+		return false, 0, time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return true, int(b.tokens), 0
 }
 
-// cleanup periodically removes old entries
+// cleanup periodically removes idle keys. A key idle for a whole window has
+// a full bucket again, the same as a key seen for the first time.
 func (rl *RateLimiter) cleanup() {
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 
 	for range ticker.C {
 		rl.mu.Lock()
-		now := time.Now()
-		windowStart := now.Add(-rl.window)
-
-		for key, requests := range rl.requests {
-			var validRequests []time.Time
-			for _, t := range requests {
-				if t.After(windowStart) {
-					validRequests = append(validRequests, t)
-				}
-			}
-			if len(validRequests) == 0 {
-				delete(rl.requests, key)
-			} else {
-				rl.requests[key] = validRequests
+		idleSince := rl.now().Add(-rl.window)
+		for key, b := range rl.buckets {
+			if b.last.Before(idleSince) {
+				delete(rl.buckets, key)
 			}
 		}
 		rl.mu.Unlock()
 	}
 }
 
-// RateLimitMiddleware creates rate limiting middleware
+// RateLimitMiddleware creates rate limiting middleware allowing limit
+// requests per window to each client IP. It belongs in the global chain,
+// ahead of authentication, so failed logins and bad credentials are limited
+// too. Responses report the limit and what is left of it in
+// X-RateLimit-Limit and X-RateLimit-Remaining; refused requests also get
+// Retry-After.
 func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
-	limiter := NewRateLimiter(limit, window)
+	return rateLimitMiddleware(NewRateLimiter(limit, window), func(c *gin.Context) (string, bool) {
+		return c.ClientIP(), true
+	})
+}
+
+// UserRateLimitMiddleware creates rate limiting middleware allowing limit
+// requests per window to each authenticated user, whichever IPs they come
+// from. It must run after authentication; anonymous requests pass through
+// and are left to the per-IP limit.
+func UserRateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
+	return rateLimitMiddleware(NewRateLimiter(limit, window), func(c *gin.Context) (string, bool) {
+		userID, ok := GetUserID(c)
+		return strconv.FormatUint(uint64(userID), 10), ok
+	})
+}
+
+// rateLimitMiddleware throttles requests by the key keyFor picks for them,
+// skipping requests it has no key for
+func rateLimitMiddleware(limiter *RateLimiter, keyFor func(c *gin.Context) (string, bool)) gin.HandlerFunc {
+	limitHeader := strconv.Itoa(limiter.limit)
 
 	return func(c *gin.Context) {
-		// Use client IP as rate limit key
-		key := c.ClientIP()
-
-		if !limiter.Allow(key) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"success": false,
-				"error": gin.H{
-					"code":    "RATE_LIMIT_EXCEEDED",
-					"message": "Too many requests. Please try again later.",
-				},
-			})
+		key, ok := keyFor(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		allowed, remaining, retryAfter := limiter.Take(key)
+		c.Header("X-RateLimit-Limit", limitHeader)
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			utils.TooManyRequestsError(c, "Too many requests. Please try again later.")
 			c.Abort()
 			return
 		}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery creates a panic recovery middleware that responds with the
+// standard JSON error envelope. The stack trace is only ever logged; when
+// exposeDetails is true (development) the panic value is echoed back.
+func Recovery(exposeDetails bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[%s] PANIC: %v\n%s", shortID(GetRequestID(c)), r, debug.Stack())
+
+				var details interface{}
+				if exposeDetails {
+					details = fmt.Sprint(r)
+				}
+				utils.Error(c, http.StatusInternalServerError, utils.ErrCodeInternal, "An internal error occurred", details)
+				c.Abort()
+			}
+		}()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ShutdownMiddleware turns new requests away with a 503 and Retry-After once
+// shuttingDown is set, so clients retry against another instance instead of
+// seeing a reset connection. Requests already past it finish normally.
+func ShutdownMiddleware(shuttingDown *atomic.Bool, retryAfter time.Duration) gin.HandlerFunc {
+	retrySeconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+
+	return func(c *gin.Context) {
+		if shuttingDown.Load() {
+			c.Header("Retry-After", retrySeconds)
+			c.Header("Connection", "close")
+			utils.ServiceUnavailableError(c, "Server is shutting down. Please try again later.")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
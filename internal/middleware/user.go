@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// UserLoader looks up a user by ID, returning nil when none exists
+type UserLoader interface {
+	GetUserByID(ctx context.Context, id uint) (*models.User, error)
+}
+
+// LoadUser loads the authenticated user and rejects the request with 401
+// when the account no longer exists, e.g. was deleted after the token was
+// issued. It must run after the auth middleware; requests without a user
+// (public routes) pass through untouched.
+func LoadUser(loader UserLoader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := GetUserID(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		user, err := loader.GetUserByID(c.Request.Context(), userID)
+		if err != nil {
+			utils.InternalError(c, "Failed to load user")
+			c.Abort()
+			return
+		}
+		if user == nil {
+			utils.UnauthorizedError(c, "Account no longer exists")
+			c.Abort()
+			return
+		}
+
+		c.Set("user", user)
+		c.Next()
+	}
+}
+
+// GetUser returns the user loaded by LoadUser
+func GetUser(c *gin.Context) (*models.User, bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		return nil, false
+	}
+	u, ok := user.(*models.User)
+	return u, ok
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// APIKeyPrefix starts every API key, so keys are recognizable in config
+// files and secret scanners
+const APIKeyPrefix = "tk_"
+
+// APIKey is a long-lived credential a user can create for scripts and
+// integrations. Only its SHA-256 hash is stored.
+type APIKey struct {
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	UserID  uint   `gorm:"not null;index" json:"user_id"`
+	Name    string `gorm:"not null;size:100" json:"name"`
+	Prefix  string `gorm:"not null;size:16" json:"prefix"` // leading characters of the key, to tell keys apart
+	KeyHash string `gorm:"not null;size:64;uniqueIndex" json:"-"`
+
+	// RevokedAt is set once the key is revoked; revoked keys no longer authenticate
+	RevokedAt *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	// LastUsedAt is when the key last authenticated a request, refreshed at
+	// most once per configured interval
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for APIKey model
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// CreateAPIKeyRequest represents the request body for creating an API key
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=100" example:"CI sync"`
+}
+
+// APIKeyResponse describes an API key without the key itself
+type APIKeyResponse struct {
+	ID         uint       `json:"id" example:"3"`
+	Name       string     `json:"name" example:"CI sync"`
+	Prefix     string     `json:"prefix" example:"tk_1a2b3c4d"`
+	LastUsedAt *Timestamp `json:"last_used_at,omitempty" swaggertype:"string" example:"2024-01-20T09:00:00Z"`
+	CreatedAt  Timestamp  `json:"created_at" swaggertype:"string"`
+}
+
+// ToResponse converts APIKey to APIKeyResponse
+func (k *APIKey) ToResponse() APIKeyResponse {
+	return APIKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		LastUsedAt: NewTimestampPtr(k.LastUsedAt),
+		CreatedAt:  NewTimestamp(k.CreatedAt),
+	}
+}
+
+// CreatedAPIKeyResponse returns a newly created API key. The key is only
+// shown once; it is stored hashed.
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key" example:"tk_1a2b3c4d..."`
+}
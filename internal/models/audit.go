@@ -0,0 +1,85 @@
+package models
+
+import "time"
+
+// Audit actions
+const (
+	AuditActionTodoReassigned = "todo.reassigned"
+	// Todo versions; Details holds the TodoVersion after the change
+	AuditActionTodoCreated = "todo.created"
+	AuditActionTodoUpdated = "todo.updated"
+)
+
+// TodoVersionActions lists the audit actions that record a todo version
+var TodoVersionActions = []string{AuditActionTodoCreated, AuditActionTodoUpdated}
+
+// AuditLog records an administrative action or a change to a todo
+type AuditLog struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ActorID    uint      `gorm:"not null;index" json:"actor_id"`
+	Action     string    `gorm:"not null;size:50;index" json:"action"`
+	EntityType string    `gorm:"not null;size:50" json:"entity_type"`
+	EntityID   uint      `gorm:"not null" json:"entity_id"`
+	Details    string    `gorm:"type:text" json:"details"` // JSON-encoded
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for AuditLog model
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+// TodoVersion is the user-editable state of a todo, as recorded in the
+// audit log after each change
+type TodoVersion struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	Priority    string     `json:"priority"`
+	Color       string     `json:"color"`
+	DueDate     *time.Time `json:"due_date"`
+	RemindAt    *time.Time `json:"remind_at"`
+	ParentID    *uint      `json:"parent_id"`
+	Recurrence  string     `json:"recurrence,omitempty"` // omitted when empty, matching versions recorded before recurrence
+	Archived    bool       `json:"archived,omitempty"`   // likewise omitted when false
+}
+
+// Version returns the todo's current state for the audit log
+func (t *Todo) Version() TodoVersion {
+	return TodoVersion{
+		Title:       t.Title,
+		Description: t.Description,
+		Completed:   t.Completed,
+		Priority:    t.Priority,
+		Color:       t.Color,
+		DueDate:     t.DueDate,
+		RemindAt:    t.RemindAt,
+		ParentID:    t.ParentID,
+		Recurrence:  t.Recurrence,
+		Archived:    t.Archived,
+	}
+}
+
+// TodoHistoryEntry is one recorded version of a todo
+type TodoHistoryEntry struct {
+	ID        uint        `json:"id" example:"12"` // audit entry ID, used to diff versions
+	Action    string      `json:"action" example:"todo.updated"`
+	ActorID   uint        `json:"actor_id" example:"3"`
+	State     TodoVersion `json:"state"`
+	CreatedAt Timestamp   `json:"created_at" swaggertype:"string"`
+}
+
+// FieldChange is one field that differs between two todo versions
+type FieldChange struct {
+	Field string      `json:"field" example:"priority"`
+	From  interface{} `json:"from" swaggertype:"string" example:"low"`
+	To    interface{} `json:"to" swaggertype:"string" example:"high"`
+}
+
+// TodoVersionDiff lists the fields changed between two versions of a todo
+type TodoVersionDiff struct {
+	TodoID  uint          `json:"todo_id" example:"42"`
+	From    uint          `json:"from" example:"12"`
+	To      uint          `json:"to" example:"15"`
+	Changes []FieldChange `json:"changes"`
+}
@@ -0,0 +1,122 @@
+package models
+
+import "time"
+
+// Export record types
+const (
+	ExportTypeUser = "user"
+	ExportTypeTodo = "todo"
+)
+
+// ExportRecord is one line of an NDJSON data export. Each user record is
+// followed by that user's todos.
+type ExportRecord struct {
+	Type string      `json:"type"`
+	User *ExportUser `json:"user,omitempty"`
+	Todo *ExportTodo `json:"todo,omitempty"`
+}
+
+// ExportUser is a user as written to an export, including the password hash
+// so accounts survive a restore. Password is only read on import, for
+// hand-written records without a hash.
+type ExportUser struct {
+	ID               uint      `json:"id"`
+	Email            string    `json:"email"`
+	PasswordHash     string    `json:"password_hash,omitempty"`
+	Password         string    `json:"password,omitempty"`
+	Role             string    `json:"role"`
+	EmailVerified    bool      `json:"email_verified"`
+	DueSoonThreshold int       `json:"due_soon_threshold"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// ExportTodo is a todo as written to an export
+type ExportTodo struct {
+	ID          uint       `json:"id"`
+	UserID      uint       `json:"user_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	Archived    bool       `json:"archived"`
+	Priority    string     `json:"priority"`
+	Color       string     `json:"color,omitempty"`
+	DueDate     *time.Time `json:"due_date,omitempty"`
+	RemindAt    *time.Time `json:"remind_at,omitempty"`
+	RemindedAt  *time.Time `json:"reminded_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExternalID  *string    `json:"external_id,omitempty"`
+	ParentID    *uint      `json:"parent_id,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ToExport converts a User for a data export
+func (u *User) ToExport() *ExportUser {
+	return &ExportUser{
+		ID:               u.ID,
+		Email:            u.Email,
+		PasswordHash:     u.Password,
+		Role:             u.Role,
+		EmailVerified:    u.EmailVerified,
+		DueSoonThreshold: u.DueSoonThreshold,
+		CreatedAt:        u.CreatedAt,
+		UpdatedAt:        u.UpdatedAt,
+	}
+}
+
+// ToExport converts a Todo, with its tags loaded, for a data export
+func (t *Todo) ToExport() *ExportTodo {
+	var tags []string
+	for _, tag := range t.Tags {
+		tags = append(tags, tag.Name)
+	}
+	return &ExportTodo{
+		ID:          t.ID,
+		UserID:      t.UserID,
+		Title:       t.Title,
+		Description: t.Description,
+		Completed:   t.Completed,
+		Archived:    t.Archived,
+		Priority:    t.Priority,
+		Color:       t.Color,
+		DueDate:     t.DueDate,
+		RemindAt:    t.RemindAt,
+		RemindedAt:  t.RemindedAt,
+		CompletedAt: t.CompletedAt,
+		ExternalID:  t.ExternalID,
+		ParentID:    t.ParentID,
+		Recurrence:  t.Recurrence,
+		Tags:        tags,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}
+}
+
+// Data import modes, for records that already exist
+const (
+	ImportModeSkip  = "skip"
+	ImportModeMerge = "merge"
+)
+
+// DataImportResult counts what a data import did with each record
+type DataImportResult struct {
+	UsersCreated int `json:"users_created"`
+	UsersMerged  int `json:"users_merged"`
+	UsersSkipped int `json:"users_skipped"`
+	TodosCreated int `json:"todos_created"`
+	TodosMerged  int `json:"todos_merged"`
+	TodosSkipped int `json:"todos_skipped"`
+}
+
+// Add accumulates another result into r
+func (r *DataImportResult) Add(other DataImportResult) {
+	r.UsersCreated += other.UsersCreated
+	r.UsersMerged += other.UsersMerged
+	r.UsersSkipped += other.UsersSkipped
+	r.TodosCreated += other.TodosCreated
+	r.TodosMerged += other.TodosMerged
+	r.TodosSkipped += other.TodosSkipped
+}
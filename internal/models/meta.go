@@ -0,0 +1,32 @@
+package models
+
+// Request limits; the binding tags on the request types must match them
+const (
+	MaxTitleLength       = 255
+	MaxDescriptionLength = 1000
+	MaxBulkUpdateIDs     = 500
+	MaxBulkDeleteIDs     = 100
+)
+
+// TodoPriorities lists the priorities a todo can have
+var TodoPriorities = []string{"low", "medium", "high"}
+
+// MetaResponse describes the server's limits and accepted values, so
+// clients can discover them without reading the docs
+type MetaResponse struct {
+	DefaultPerPage       int      `json:"default_per_page" example:"10"`
+	MaxPerPage           int      `json:"max_per_page" example:"100"`
+	MaxBulkUpdateIDs     int      `json:"max_bulk_update_ids" example:"500"`
+	MaxBulkDeleteIDs     int      `json:"max_bulk_delete_ids" example:"100"`
+	MaxImportItems       int      `json:"max_import_items" example:"1000"`
+	MaxTitleLength       int      `json:"max_title_length" example:"255"`
+	MaxDescriptionLength int      `json:"max_description_length" example:"1000"`
+	MaxTagsPerTodo       int      `json:"max_tags_per_todo" example:"20"`
+	Priorities           []string `json:"priorities" example:"low,medium,high"`
+	DefaultPriority      string   `json:"default_priority" example:"medium"`
+	SortFields           []string `json:"sort_fields" example:"created_at,updated_at,due_date,priority,title"`
+	DefaultSort          string   `json:"default_sort" example:"created_at"`
+	DefaultOrder         string   `json:"default_order" example:"desc"`
+	Colors               []string `json:"colors" example:"red,green,blue"`
+	Recurrences          []string `json:"recurrences" example:"daily,weekly,monthly"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaxTagsPerTodo caps how many tags a todo can carry
+const MaxTagsPerTodo = 20
+
+// Tag is a free-form label, such as "work" or "home", owned by a user and
+// shared by any of their todos. Names are stored normalized.
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_tags_user_name,priority:1" json:"user_id"`
+	Name      string    `gorm:"not null;size:50;uniqueIndex:idx_tags_user_name,priority:2" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for Tag model
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// TodoTag joins todos to their tags. It is indexed by tag so filtering
+// todos by tag doesn't scan the table.
+type TodoTag struct {
+	TodoID uint `gorm:"primaryKey"`
+	TagID  uint `gorm:"primaryKey;index"`
+}
+
+// TableName specifies the table name for TodoTag model
+func (TodoTag) TableName() string {
+	return "todo_tags"
+}
+
+// NormalizeTag trims and lowercases a tag name, so "Work " and "work" are
+// the same tag
+func NormalizeTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// NormalizeTags normalizes tag names, dropping blanks and duplicates, and
+// returns them sorted
+func NormalizeTags(names []string) []string {
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = NormalizeTag(name); name != "" {
+			normalized = append(normalized, name)
+		}
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// NewTags builds unsaved tags for a user from normalized names
+func NewTags(userID uint, names []string) []Tag {
+	tags := make([]Tag, len(names))
+	for i, name := range names {
+		tags[i] = Tag{UserID: userID, Name: name}
+	}
+	return tags
+}
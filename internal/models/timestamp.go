@@ -0,0 +1,71 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Supported JSON time formats for API responses
+const (
+	TimeFormatRFC3339     = "rfc3339"
+	TimeFormatEpochMillis = "epoch_millis"
+)
+
+// TimeFormats lists the values accepted by SetTimeFormat
+var TimeFormats = []string{TimeFormatRFC3339, TimeFormatEpochMillis}
+
+var epochMillis atomic.Bool
+
+// SetTimeFormat selects how Timestamp values are serialized. It is set once
+// at startup from configuration; unknown formats fall back to RFC3339.
+func SetTimeFormat(format string) {
+	epochMillis.Store(format == TimeFormatEpochMillis)
+}
+
+// Timestamp is a time in an API response, serialized as RFC3339 or as epoch
+// milliseconds depending on the configured time format
+type Timestamp struct {
+	time.Time
+}
+
+// NewTimestamp wraps t for a response
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{Time: t}
+}
+
+// NewTimestampPtr wraps an optional time for a response
+func NewTimestampPtr(t *time.Time) *Timestamp {
+	if t == nil {
+		return nil
+	}
+	return &Timestamp{Time: *t}
+}
+
+// MarshalJSON writes the timestamp in the configured format
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if epochMillis.Load() {
+		return strconv.AppendInt(nil, t.UnixMilli(), 10), nil
+	}
+	return t.Time.MarshalJSON()
+}
+
+// UnmarshalJSON accepts either format, so clients can round-trip responses
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return t.Time.UnmarshalJSON(data)
+	}
+
+	var millis int64
+	if err := json.Unmarshal(data, &millis); err != nil {
+		return fmt.Errorf("timestamp must be an RFC3339 string or epoch milliseconds: %w", err)
+	}
+	t.Time = time.UnixMilli(millis).UTC()
+	return nil
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -12,12 +15,111 @@ type Todo struct {
 	Title       string         `gorm:"not null;size:255" json:"title"`
 	Description string         `gorm:"size:1000" json:"description"`
 	Completed   bool           `gorm:"default:false" json:"completed"`
+	Archived    bool           `gorm:"default:false;index" json:"archived"`      // hidden from lists by default
 	Priority    string         `gorm:"size:20;default:'medium'" json:"priority"` // low, medium, high
+	Color       string         `gorm:"size:20;index" json:"color,omitempty"`     // a TodoColors name or hex code
 	DueDate     *time.Time     `json:"due_date,omitempty"`
+	RemindAt    *time.Time     `gorm:"index" json:"remind_at,omitempty"` // no later than DueDate
+	RemindedAt  *time.Time     `json:"-"`                                // set once the reminder is dispatched
+	CompletedAt *time.Time     `gorm:"index" json:"completed_at,omitempty"`
+	ExternalID  *string        `gorm:"size:255" json:"external_id,omitempty"` // client-provided, unique per user among undeleted todos
+	ParentID    *uint          `gorm:"index" json:"parent_id,omitempty"`      // set on subtasks
+	Recurrence  string         `gorm:"size:20" json:"recurrence,omitempty"`   // a Recurrences interval, empty for one-off todos
 	UserID      uint           `gorm:"not null;index" json:"user_id"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Subtasks is only loaded when expanded
+	Subtasks []Todo `gorm:"foreignKey:ParentID" json:"subtasks,omitempty"`
+	// Tags is replaced as a whole whenever the todo is saved with it set
+	Tags []Tag `gorm:"many2many:todo_tags" json:"-"`
+}
+
+// ValidReminder reports whether the reminder, if any, is no later than the
+// due date
+func (t *Todo) ValidReminder() bool {
+	return t.RemindAt == nil || t.DueDate == nil || !t.RemindAt.After(*t.DueDate)
+}
+
+// Recurrence intervals: completing a recurring todo creates its next occurrence
+const (
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+)
+
+// Recurrences lists the supported recurrence intervals
+var Recurrences = []string{RecurrenceDaily, RecurrenceWeekly, RecurrenceMonthly}
+
+// NextOccurrence returns a fresh, incomplete copy of a recurring todo with its
+// due date and reminder advanced by one interval, or nil if it doesn't recur.
+// The external ID isn't carried over, as it identifies the original.
+func (t *Todo) NextOccurrence() *Todo {
+	if t.Recurrence == "" {
+		return nil
+	}
+
+	next := &Todo{
+		Title:       t.Title,
+		Description: t.Description,
+		Priority:    t.Priority,
+		Color:       t.Color,
+		DueDate:     advance(t.DueDate, t.Recurrence),
+		RemindAt:    advance(t.RemindAt, t.Recurrence),
+		ParentID:    t.ParentID,
+		Recurrence:  t.Recurrence,
+		UserID:      t.UserID,
+	}
+	if len(t.Tags) > 0 {
+		names := make([]string, len(t.Tags))
+		for i, tag := range t.Tags {
+			names[i] = tag.Name
+		}
+		next.Tags = NewTags(t.UserID, names)
+	}
+	return next
+}
+
+// advance moves a time forward by one recurrence interval. Monthly
+// recurrences stay within the following month, so the 31st of January is
+// followed by the last day of February.
+func advance(t *time.Time, recurrence string) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	var next time.Time
+	switch recurrence {
+	case RecurrenceDaily:
+		next = t.AddDate(0, 0, 1)
+	case RecurrenceWeekly:
+		next = t.AddDate(0, 0, 7)
+	case RecurrenceMonthly:
+		next = t.AddDate(0, 1, 0)
+		if next.Day() != t.Day() {
+			// Overflowed into the month after; step back to the end of the target month
+			next = next.AddDate(0, 0, -next.Day())
+		}
+	default:
+		return t
+	}
+	return &next
+}
+
+// External ID uniqueness scopes: unique per user, or across all users
+const (
+	ExternalIDScopeUser   = "user"
+	ExternalIDScopeGlobal = "global"
+)
+
+// ExternalIDScopes lists the supported external ID uniqueness scopes
+var ExternalIDScopes = []string{ExternalIDScopeUser, ExternalIDScopeGlobal}
+
+// TodoExpansions maps the associations a single-todo fetch can expand to
+// the fields preloaded for them
+var TodoExpansions = map[string]string{
+	"subtasks": "Subtasks",
 }
 
 // TableName specifies the table name for Todo model
@@ -25,14 +127,58 @@ func (Todo) TableName() string {
 	return "todos"
 }
 
+// TodoTombstone records that a todo was permanently deleted, so lookups can
+// tell it apart from an ID that never existed
+type TodoTombstone struct {
+	TodoID    uint      `gorm:"primaryKey;autoIncrement:false"`
+	UserID    uint      `gorm:"not null;index"`
+	DeletedAt time.Time `gorm:"not null"`
+}
+
+// TableName specifies the table name for TodoTombstone model
+func (TodoTombstone) TableName() string {
+	return "todo_tombstones"
+}
+
 // CreateTodoRequest represents the request body for creating a todo
 type CreateTodoRequest struct {
+	Title       string     `json:"title" binding:"required,min=1,max=255" example:"Buy groceries"`
+	Description string     `json:"description" binding:"max=1000" example:"Milk, eggs and bread"`
+	Priority    string     `json:"priority" binding:"omitempty,oneof=low medium high" example:"high"`
+	DueDate     *time.Time `json:"due_date" example:"2024-01-20T17:00:00Z"`
+	RemindAt    *time.Time `json:"remind_at" example:"2024-01-20T09:00:00Z"` // no later than due_date
+	ExternalID  *string    `json:"external_id" binding:"omitempty,min=1,max=255" example:"jira-1234"`
+	ParentID    *uint      `json:"parent_id" binding:"omitempty,min=1" example:"7"`
+	Color       string     `json:"color" binding:"omitempty,hexcolor|oneof=red orange yellow green blue purple pink gray" example:"green"`
+	Tags        []string   `json:"tags" binding:"omitempty,max=20,dive,max=50" example:"work,urgent"`
+	Recurrence  string     `json:"recurrence" binding:"omitempty,oneof=daily weekly monthly" example:"weekly"`
+}
+
+// UpsertTodoRequest is the full state of a todo pushed by an integration.
+// It replaces the todo's fields when one exists for the external ID.
+type UpsertTodoRequest struct {
 	Title       string     `json:"title" binding:"required,min=1,max=255"`
 	Description string     `json:"description" binding:"max=1000"`
+	Completed   bool       `json:"completed"`
 	Priority    string     `json:"priority" binding:"omitempty,oneof=low medium high"`
 	DueDate     *time.Time `json:"due_date"`
 }
 
+// DefaultPriority is applied when a todo is created without a priority
+const DefaultPriority = "medium"
+
+// ApplyDefaults fills in server-side defaults for omitted fields and returns
+// the names of the fields the server assigned. Completion status cannot be
+// supplied on create, so "completed" is always reported.
+func (r *CreateTodoRequest) ApplyDefaults() []string {
+	var applied []string
+	if r.Priority == "" {
+		r.Priority = DefaultPriority
+		applied = append(applied, "priority")
+	}
+	return append(applied, "completed")
+}
+
 // UpdateTodoRequest represents the request body for updating a todo
 type UpdateTodoRequest struct {
 	Title       *string    `json:"title" binding:"omitempty,min=1,max=255"`
@@ -40,39 +186,241 @@ type UpdateTodoRequest struct {
 	Completed   *bool      `json:"completed"`
 	Priority    *string    `json:"priority" binding:"omitempty,oneof=low medium high"`
 	DueDate     *time.Time `json:"due_date"`
+	RemindAt    *time.Time `json:"remind_at"`                                                                                  // no later than due_date
+	Color       *string    `json:"color" binding:"omitempty,eq=|hexcolor|oneof=red orange yellow green blue purple pink gray"` // "" clears it
+	Tags        *[]string  `json:"tags" binding:"omitempty,max=20,dive,max=50"`                                                // replaces all tags; [] removes them
+	Recurrence  *string    `json:"recurrence" binding:"omitempty,eq=|oneof=daily weekly monthly"`                              // "" stops recurring
+}
+
+// TodoColors lists the named colors a todo can be labelled with; hex codes
+// (#rgb, #rgba, #rrggbb or #rrggbbaa) are also accepted
+var TodoColors = []string{"red", "orange", "yellow", "green", "blue", "purple", "pink", "gray"}
+
+var hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// ValidColor reports whether color is a named color or hex code, matching
+// the validation applied to request bodies
+func ValidColor(color string) bool {
+	return slices.Contains(TodoColors, color) || hexColorPattern.MatchString(color)
 }
 
-// TodoResponse represents the API response for a todo
+// NormalizeColor lowercases hex codes so they compare consistently
+func NormalizeColor(color string) string {
+	return strings.ToLower(color)
+}
+
+// TodoResponse represents the API response for a todo.
+// Description is always present: an unset description is "" rather than null.
+// Times are serialized in the configured time format; due dates and
+// reminders are always UTC.
 type TodoResponse struct {
-	ID          uint       `json:"id"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	Completed   bool       `json:"completed"`
-	Priority    string     `json:"priority"`
-	DueDate     *time.Time `json:"due_date,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID          uint       `json:"id" example:"42"`
+	Title       string     `json:"title" example:"Buy groceries"`
+	Description string     `json:"description" example:"Milk, eggs and bread"`
+	Completed   bool       `json:"completed" example:"false"`
+	Archived    bool       `json:"archived" example:"false"`
+	Priority    string     `json:"priority" example:"high"`
+	Color       string     `json:"color,omitempty" example:"green"`
+	DueDate     *Timestamp `json:"due_date,omitempty" swaggertype:"string" example:"2024-01-20T17:00:00Z"`
+	RemindAt    *Timestamp `json:"remind_at,omitempty" swaggertype:"string" example:"2024-01-20T09:00:00Z"`
+	CompletedAt *Timestamp `json:"completed_at,omitempty" swaggertype:"string" example:"2024-01-19T18:30:00Z"`
+	ExternalID  *string    `json:"external_id,omitempty" example:"jira-1234"`
+	ParentID    *uint      `json:"parent_id,omitempty" example:"7"`
+	Recurrence  string     `json:"recurrence,omitempty" example:"weekly"`
+	Tags        []string   `json:"tags,omitempty" example:"urgent,work"`
+	DueSoon     bool       `json:"due_soon" example:"true"`
+	CreatedAt   Timestamp  `json:"created_at" swaggertype:"string" example:"2024-01-15T10:30:00Z"`
+	UpdatedAt   Timestamp  `json:"updated_at" swaggertype:"string" example:"2024-01-15T10:30:00Z"`
+
+	// Subtasks is only present when expanded
+	Subtasks []TodoResponse `json:"subtasks,omitempty"`
+}
+
+// MarkDueSoon flags an incomplete todo whose due date falls within threshold
+// of now. Overdue todos are not due soon.
+func (r *TodoResponse) MarkDueSoon(threshold time.Duration, now time.Time) {
+	r.DueSoon = !r.Completed && r.DueDate != nil &&
+		r.DueDate.After(now) && r.DueDate.Sub(now) <= threshold
+	for i := range r.Subtasks {
+		r.Subtasks[i].MarkDueSoon(threshold, now)
+	}
 }
 
 // ToResponse converts Todo to TodoResponse
 func (t *Todo) ToResponse() TodoResponse {
-	return TodoResponse{
+	response := TodoResponse{
 		ID:          t.ID,
 		Title:       t.Title,
 		Description: t.Description,
 		Completed:   t.Completed,
+		Archived:    t.Archived,
 		Priority:    t.Priority,
-		DueDate:     t.DueDate,
-		CreatedAt:   t.CreatedAt,
-		UpdatedAt:   t.UpdatedAt,
+		Color:       t.Color,
+		DueDate:     NewTimestampPtr(t.DueDate),
+		RemindAt:    NewTimestampPtr(t.RemindAt),
+		CompletedAt: NewTimestampPtr(t.CompletedAt),
+		ExternalID:  t.ExternalID,
+		ParentID:    t.ParentID,
+		Recurrence:  t.Recurrence,
+		CreatedAt:   NewTimestamp(t.CreatedAt),
+		UpdatedAt:   NewTimestamp(t.UpdatedAt),
+	}
+	if response.DueDate != nil {
+		response.DueDate.Time = response.DueDate.UTC()
+	}
+	if response.RemindAt != nil {
+		response.RemindAt.Time = response.RemindAt.UTC()
 	}
+	for _, tag := range t.Tags {
+		response.Tags = append(response.Tags, tag.Name)
+	}
+	slices.Sort(response.Tags)
+	for _, subtask := range t.Subtasks {
+		response.Subtasks = append(response.Subtasks, subtask.ToResponse())
+	}
+	return response
+}
+
+// TodoTreeNode is a todo with its subtasks nested beneath it, replacing the
+// flat expansion. Truncated is set when the todo has subtasks deeper than the
+// requested depth.
+type TodoTreeNode struct {
+	TodoResponse
+	Subtasks  []TodoTreeNode `json:"subtasks"`
+	Truncated bool           `json:"truncated,omitempty"`
+}
+
+// TodoListOptions holds pagination, filtering and sorting for todo listings
+type TodoListOptions struct {
+	Page    int
+	PerPage int
+	// Offset, when set, replaces Page for offset/limit pagination; the
+	// service fills it in from Page otherwise
+	Offset *int
+
+	Completed *bool
+	Color     string // exact color label, empty for any
+	Search    string // case-insensitive substring of title or description
+	Tag       string // normalized tag name, empty for any
+	// IncludeArchived lists archived todos alongside the rest
+	IncludeArchived bool
+	// MaxResults caps the result window: matches past it can't be paged to
+	// and the response is flagged as truncated (0 for no cap)
+	MaxResults int
+	// DueAfter and DueBefore bound the due date inclusively; either one
+	// excludes todos without a due date
+	DueAfter  *time.Time
+	DueBefore *time.Time
+	Sort      string // one of TodoSortFields
+	Order     string // "asc" or "desc"
+
+	// IncludeSummary adds counts across the whole filtered set
+	IncludeSummary bool
 }
 
+// StatsMetrics lists the statistics the stats endpoint can compute
+var StatsMetrics = []string{"total", "completed", "pending", "overdue", "average_completion_time", "by_priority"}
+
+// TodoSortFields lists the fields todos can be sorted by
+var TodoSortFields = []string{"created_at", "updated_at", "due_date", "priority", "title"}
+
 // TodoListResponse represents paginated list of todos
 type TodoListResponse struct {
 	Todos      []TodoResponse `json:"todos"`
-	Total      int64          `json:"total"`
-	Page       int            `json:"page"`
-	PerPage    int            `json:"per_page"`
-	TotalPages int            `json:"total_pages"`
+	Total      int64          `json:"total" example:"25"`
+	Page       int            `json:"page" example:"1"`
+	PerPage    int            `json:"per_page" example:"10"`
+	TotalPages int            `json:"total_pages" example:"3"`
+	Summary    *TodoSummary   `json:"summary,omitempty"`
+	// Truncated is set when more todos matched than the result window holds;
+	// Total then counts only the window
+	Truncated bool   `json:"truncated,omitempty" example:"false"`
+	Warning   string `json:"warning,omitempty"`
+}
+
+// TodoSummary aggregates a filtered set of todos, independent of pagination
+type TodoSummary struct {
+	Completed int64 `json:"completed" example:"18"`
+	Pending   int64 `json:"pending" example:"7"`
+	Overdue   int64 `json:"overdue" example:"2"`
+}
+
+// TodoStats documents the stats endpoint's response. Only the requested
+// metrics are present; average_completion_time is an ISO 8601 duration, or
+// null when nothing has been completed. by_priority counts todos of each
+// priority, including priorities with none.
+type TodoStats struct {
+	Total                 int64   `json:"total,omitempty" example:"25"`
+	Completed             int64   `json:"completed,omitempty" example:"18"`
+	Pending               int64   `json:"pending,omitempty" example:"7"`
+	Overdue               int64   `json:"overdue,omitempty" example:"2"`
+	AverageCompletionTime *string `json:"average_completion_time,omitempty" example:"P1DT4H30M"`
+
+	ByPriority map[string]int64 `json:"by_priority,omitempty"`
+}
+
+// VelocityResponse represents completion velocity over a time window
+type VelocityResponse struct {
+	Days                 int      `json:"days"`
+	Completed            int64    `json:"completed"`
+	AveragePerDay        float64  `json:"average_per_day"`
+	Pending              int64    `json:"pending"`
+	ProjectedDaysToClear *float64 `json:"projected_days_to_clear"`
+}
+
+// CompletedTodayResponse lists the todos completed on one calendar day in the
+// requested timezone
+type CompletedTodayResponse struct {
+	Date     string         `json:"date" example:"2024-01-15"`
+	Timezone string         `json:"timezone" example:"Europe/Berlin"`
+	Todos    []TodoResponse `json:"todos"`
+}
+
+// TodoExistsRequest represents a batch check of client-known todo IDs
+type TodoExistsRequest struct {
+	IDs []uint `json:"ids" binding:"required,min=1,max=500,dive,min=1"`
+}
+
+// TodoExistsResponse splits the checked IDs into those that still exist and
+// those that were deleted (or never belonged to the user)
+type TodoExistsResponse struct {
+	Existing []uint `json:"existing"`
+	Missing  []uint `json:"missing"`
+}
+
+// BulkPriorityRequest sets one priority on a batch of todos
+type BulkPriorityRequest struct {
+	IDs      []uint `json:"ids" binding:"required,min=1,max=500,dive,min=1"`
+	Priority string `json:"priority" binding:"required,oneof=low medium high"`
+}
+
+// BulkCompleteRequest marks a batch of todos completed or not completed
+type BulkCompleteRequest struct {
+	IDs       []uint `json:"ids" binding:"required,min=1,max=500,dive,min=1"`
+	Completed *bool  `json:"completed" binding:"required" example:"true"`
+}
+
+// BulkDeleteRequest deletes a batch of todos
+type BulkDeleteRequest struct {
+	IDs []uint `json:"ids" binding:"required,min=1,max=100,dive,min=1"`
+}
+
+// BulkUpdateResponse reports how many todos a bulk operation changed
+type BulkUpdateResponse struct {
+	Updated int64 `json:"updated"`
+}
+
+// BulkDeleteResponse reports how many todos a delete removed
+type BulkDeleteResponse struct {
+	Deleted int64 `json:"deleted" example:"3"`
+}
+
+// ReassignTodoRequest moves a todo to another user
+type ReassignTodoRequest struct {
+	UserID uint `json:"user_id" binding:"required,min=1"`
+}
+
+// TodoImportResponse reports the result of a bulk import
+type TodoImportResponse struct {
+	Imported int `json:"imported"`
 }
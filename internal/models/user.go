@@ -1,22 +1,69 @@
 package models
 
 import (
+	"strings"
 	"time"
 
+	"golang.org/x/text/unicode/norm"
 	"gorm.io/gorm"
 )
 
 // User represents a registered user in the system
 type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Email     string         `gorm:"uniqueIndex;not null;size:255" json:"email"`
-	Password  string         `gorm:"not null" json:"-"` // Never expose password in JSON
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Email    string `gorm:"uniqueIndex;not null;size:255" json:"email"`
+	Password string `gorm:"not null" json:"-"` // Never expose password in JSON
+	Role     string `gorm:"size:20;not null;default:'user'" json:"role"`
+
+	// DueSoonThreshold is how far ahead, in seconds, incomplete todos are flagged as due soon (0 disables)
+	DueSoonThreshold int `gorm:"not null;default:86400" json:"due_soon_threshold"`
+
+	// FeedTokenHash authenticates the read-only calendar feed (SHA-256, nil when revoked)
+	FeedTokenHash *string `gorm:"size:64;uniqueIndex" json:"-"`
+
+	// EmailVerified is set once the user follows the link sent on registration;
+	// until then VerificationTokenHash (SHA-256) identifies the link, which
+	// stops working at VerificationExpiresAt
+	EmailVerified         bool       `gorm:"not null;default:false" json:"email_verified"`
+	VerificationTokenHash *string    `gorm:"size:64;uniqueIndex" json:"-"`
+	VerificationExpiresAt *time.Time `json:"-"`
+
+	// ResetTokenHash (SHA-256) identifies a pending password reset until
+	// ResetExpiresAt; both are cleared once the password is reset
+	ResetTokenHash *string    `gorm:"size:64;uniqueIndex" json:"-"`
+	ResetExpiresAt *time.Time `json:"-"`
+
+	// FailedLogins counts consecutive failed logins; LockedUntil blocks logins once it hits the limit
+	FailedLogins int        `gorm:"not null;default:0" json:"-"`
+	LockedUntil  *time.Time `json:"-"`
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 	Todos     []Todo         `gorm:"foreignKey:UserID" json:"todos,omitempty"`
 }
 
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// DueSoonWindow returns the user's due-soon threshold as a duration
+func (u *User) DueSoonWindow() time.Duration {
+	return time.Duration(u.DueSoonThreshold) * time.Second
+}
+
+// IsLocked reports whether logins are blocked at the given time
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// IsAdmin reports whether the user has administrative privileges
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
 // TableName specifies the table name for User model
 func (User) TableName() string {
 	return "users"
@@ -26,7 +73,10 @@ func (User) TableName() string {
 type UserResponse struct {
 	ID        uint      `json:"id"`
 	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
+	Role      string    `json:"role"`
+	CreatedAt Timestamp `json:"created_at" swaggertype:"string"`
+
+	EmailVerified bool `json:"email_verified"`
 }
 
 // ToResponse converts User to UserResponse
@@ -34,6 +84,64 @@ func (u *User) ToResponse() UserResponse {
 	return UserResponse{
 		ID:        u.ID,
 		Email:     u.Email,
-		CreatedAt: u.CreatedAt,
+		Role:      u.Role,
+		CreatedAt: NewTimestamp(u.CreatedAt),
+
+		EmailVerified: u.EmailVerified,
 	}
 }
+
+// PasswordReset is the payload of an events.PasswordResetRequested event:
+// the token to deliver to a user who forgot their password
+type PasswordReset struct {
+	Email     string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// EmailVerification is the payload of an events.EmailVerificationRequested
+// event: the token to deliver to a newly registered user
+type EmailVerification struct {
+	Email     string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// ProfileResponse is the user profile, optionally embedding todo stats
+type ProfileResponse struct {
+	UserResponse
+	Stats map[string]interface{} `json:"stats,omitempty"`
+}
+
+// UsageResponse reports what a user stores, for quota checks. Deleted todos
+// count until they are purged; archived todos are part of the active count.
+type UsageResponse struct {
+	ActiveTodos   int64 `json:"active_todos" example:"42"`
+	ArchivedTodos int64 `json:"archived_todos" example:"5"`
+	DeletedTodos  int64 `json:"deleted_todos" example:"3"`
+	// TextBytes is the size of all titles and descriptions, deleted included
+	TextBytes int64 `json:"text_bytes" example:"5120"`
+}
+
+// PreferencesResponse holds a user's preferences
+type PreferencesResponse struct {
+	DueSoonThreshold int `json:"due_soon_threshold"` // seconds
+}
+
+// UpdatePreferencesRequest changes a user's preferences; omitted fields are kept
+type UpdatePreferencesRequest struct {
+	DueSoonThreshold *int `json:"due_soon_threshold" binding:"omitempty,min=0,max=2592000"` // seconds, up to 30 days
+}
+
+// FeedTokenResponse returns a newly generated calendar feed token. The token
+// is only shown once; it is stored hashed.
+type FeedTokenResponse struct {
+	Token string `json:"token"`
+	Path  string `json:"path"`
+}
+
+// NormalizeEmail lowercases an email in Unicode NFC form, so variants of one
+// address compare equal
+func NormalizeEmail(email string) string {
+	return strings.ToLower(norm.NFC.String(email))
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bhaskar/todo-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// APIKeyRepository handles API key data operations
+type APIKeyRepository struct {
+	db   *gorm.DB
+	opts options
+}
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *gorm.DB, opts ...Option) *APIKeyRepository {
+	return &APIKeyRepository{db: db, opts: newOptions(opts)}
+}
+
+// CreateWithinLimit inserts key unless its user already has limit active
+// keys (0 means no limit). Reports whether the key was created.
+func (r *APIKeyRepository) CreateWithinLimit(ctx context.Context, key *models.APIKey, limit int) (bool, error) {
+	var created bool
+	err := r.opts.withRetry(ctx, func() error {
+		created = false
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if limit > 0 {
+				// Lock the owner so concurrent creates see each other's keys
+				err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, key.UserID).Error
+				if err != nil {
+					return err
+				}
+
+				var active int64
+				err = tx.Model(&models.APIKey{}).
+					Where("user_id = ? AND revoked_at IS NULL", key.UserID).
+					Count(&active).Error
+				if err != nil || active >= int64(limit) {
+					return err
+				}
+			}
+
+			key.ID = 0
+			if err := tx.Create(key).Error; err != nil {
+				return err
+			}
+			created = true
+			return nil
+		})
+	})
+	return created, err
+}
+
+// ListActiveByUserID retrieves a user's unrevoked API keys, oldest first
+func (r *APIKeyRepository) ListActiveByUserID(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("id ASC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// FindActiveByHash retrieves the unrevoked API key with the given hash
+func (r *APIKeyRepository) FindActiveByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.WithContext(ctx).Where("key_hash = ? AND revoked_at IS NULL", hash).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &key, err
+}
+
+// Revoke revokes a user's active API key, reporting false if the user has
+// no such key
+func (r *APIKeyRepository) Revoke(ctx context.Context, id, userID uint, at time.Time) (bool, error) {
+	var revoked bool
+	err := r.opts.withRetry(ctx, func() error {
+		result := r.db.WithContext(ctx).Model(&models.APIKey{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+			Update("revoked_at", at)
+		revoked = result.RowsAffected == 1
+		return result.Error
+	})
+	return revoked, err
+}
+
+// TouchLastUsed sets a key's last-used time to at, unless it was already
+// used after staleBefore. Reports whether the row was written.
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id uint, at, staleBefore time.Time) (bool, error) {
+	var touched bool
+	err := r.opts.withRetry(ctx, func() error {
+		result := r.db.WithContext(ctx).Model(&models.APIKey{}).
+			Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, staleBefore).
+			Update("last_used_at", at)
+		touched = result.RowsAffected == 1
+		return result.Error
+	})
+	return touched, err
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// retryBackoff is the delay before the first retry; it doubles each attempt
+const retryBackoff = 50 * time.Millisecond
+
+// retryableSQLStates are Postgres errors that succeed when the transaction is
+// simply run again: serialization_failure and deadlock_detected
+var retryableSQLStates = map[string]bool{
+	"40001": true,
+	"40P01": true,
+}
+
+// Option configures a repository
+type Option func(*options)
+
+type options struct {
+	writeRetries int
+	tombstones   bool
+}
+
+// WithWriteRetries retries write operations that fail with a transient error
+// up to n more times, with exponential backoff
+func WithWriteRetries(n int) Option {
+	return func(o *options) {
+		o.writeRetries = n
+	}
+}
+
+// WithTombstones records a tombstone for each permanently deleted todo
+func WithTombstones() Option {
+	return func(o *options) {
+		o.tombstones = true
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// isRetryable reports whether err is a transient database error. Drivers
+// expose the SQLSTATE through a SQLState method (e.g. pgconn.PgError).
+func isRetryable(err error) bool {
+	var sqlErr interface{ SQLState() string }
+	return errors.As(err, &sqlErr) && retryableSQLStates[sqlErr.SQLState()]
+}
+
+// withRetry runs fn, retrying it while it fails with a transient error. fn
+// must be safe to run again, e.g. a single statement or a whole transaction.
+func (o options) withRetry(ctx context.Context, fn func() error) error {
+	err := fn()
+	backoff := retryBackoff
+	for attempt := 0; attempt < o.writeRetries && isRetryable(err); attempt++ {
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		err = fn()
+	}
+	return err
+}
@@ -1,119 +1,800 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math"
+	"strings"
+	"time"
 
 	"github.com/bhaskar/todo-api/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // TodoRepository handles todo data operations
 type TodoRepository struct {
-	db *gorm.DB
+	db   *gorm.DB
+	opts options
 }
 
 // NewTodoRepository creates a new todo repository
-func NewTodoRepository(db *gorm.DB) *TodoRepository {
-	return &TodoRepository{db: db}
+func NewTodoRepository(db *gorm.DB, opts ...Option) *TodoRepository {
+	return &TodoRepository{db: db, opts: newOptions(opts)}
+}
+
+// Unscoped returns a repository whose queries include soft-deleted todos
+func (r *TodoRepository) Unscoped() *TodoRepository {
+	return &TodoRepository{db: r.db.Unscoped(), opts: r.opts}
 }
 
 // Create inserts a new todo into the database
-func (r *TodoRepository) Create(todo *models.Todo) error {
-	return r.db.Create(todo).Error
+func (r *TodoRepository) Create(ctx context.Context, todo *models.Todo) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(todo).Error
+	})
+}
+
+// CreateBatch inserts several todos, with their tags, atomically, recording
+// entries[i] as the audit entry for todos[i]
+func (r *TodoRepository) CreateBatch(ctx context.Context, todos []models.Todo, entries []*models.AuditLog) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Omit(clause.Associations).Create(&todos).Error; err != nil {
+				return err
+			}
+			for i := range todos {
+				if todos[i].Tags != nil {
+					if err := replaceTags(tx, &todos[i]); err != nil {
+						return err
+					}
+				}
+				entries[i].ID = 0
+				entries[i].EntityID = todos[i].ID
+			}
+			return tx.Create(entries).Error
+		})
+	})
 }
 
 // FindByID retrieves a todo by ID
-func (r *TodoRepository) FindByID(id uint) (*models.Todo, error) {
+func (r *TodoRepository) FindByID(ctx context.Context, id uint) (*models.Todo, error) {
+	var todo models.Todo
+	err := r.db.WithContext(ctx).First(&todo, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &todo, err
+}
+
+// FindByIDAndUserID retrieves a todo by ID and user ID (ownership check),
+// preloading the named associations oldest first
+func (r *TodoRepository) FindByIDAndUserID(ctx context.Context, id, userID uint, preloads ...string) (*models.Todo, error) {
 	var todo models.Todo
-	err := r.db.First(&todo, id).Error
+	query := r.db.WithContext(ctx)
+	for _, preload := range preloads {
+		query = query.Preload(preload, func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC, id ASC")
+		})
+	}
+	err := query.Where("id = ? AND user_id = ?", id, userID).First(&todo).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
 	return &todo, err
 }
 
-// FindByIDAndUserID retrieves a todo by ID and user ID (ownership check)
-func (r *TodoRepository) FindByIDAndUserID(id, userID uint) (*models.Todo, error) {
+// FindByExternalIDAndUserID retrieves a user's todo by its external ID
+func (r *TodoRepository) FindByExternalIDAndUserID(ctx context.Context, externalID string, userID uint) (*models.Todo, error) {
 	var todo models.Todo
-	err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&todo).Error
+	err := r.db.WithContext(ctx).Where("external_id = ? AND user_id = ?", externalID, userID).First(&todo).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
 	return &todo, err
 }
 
-// ListByUserID retrieves paginated todos for a user
-func (r *TodoRepository) ListByUserID(userID uint, page, perPage int, completed *bool) (*models.TodoListResponse, error) {
+// FindRecentDuplicate returns the user's most recent todo created at or after
+// since with the same title and description, or nil
+func (r *TodoRepository) FindRecentDuplicate(ctx context.Context, userID uint, title, description string, since time.Time) (*models.Todo, error) {
+	var todo models.Todo
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND title = ? AND description = ? AND created_at >= ?", userID, title, description, since).
+		Order("created_at DESC").
+		First(&todo).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &todo, err
+}
+
+// ListByIDsAndUserID retrieves the user's todos among ids, in ID order. IDs
+// the user doesn't own are skipped.
+func (r *TodoRepository) ListByIDsAndUserID(ctx context.Context, userID uint, ids []uint) ([]models.Todo, error) {
 	var todos []models.Todo
-	var total int64
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND id IN ?", userID, ids).
+		Order("id ASC").
+		Find(&todos).Error
+	return todos, err
+}
 
-	query := r.db.Model(&models.Todo{}).Where("user_id = ?", userID)
+// UpsertByExternalID applies fn to the user's todo with the given external ID
+// and saves it, creating the todo if none exists, in a single transaction.
+// fn receives a zero todo on the create path, or the existing one with its
+// tags, and returns the writes to make: the todo with its audit entry first,
+// then any todos created alongside it. If a concurrent request creates the
+// todo first, the unique index rejects our insert and the upsert is retried
+// as an update. Reports whether the todo was created.
+func (r *TodoRepository) UpsertByExternalID(ctx context.Context, userID uint, externalID string, fn func(todo *models.Todo, created bool) ([]TodoWrite, error)) (*models.Todo, bool, error) {
+	var todo models.Todo
+	var created bool
+	upsert := func(tx *gorm.DB) error {
+		todo = models.Todo{}
+		err := tx.Preload("Tags").Where("external_id = ? AND user_id = ?", externalID, userID).First(&todo).Error
+		created = errors.Is(err, gorm.ErrRecordNotFound)
+		if err != nil && !created {
+			return err
+		}
 
-	// Filter by completed status if provided
-	if completed != nil {
-		query = query.Where("completed = ?", *completed)
+		todo.UserID = userID
+		todo.ExternalID = &externalID
+		writes, err := fn(&todo, created)
+		if err != nil {
+			return err
+		}
+		for _, write := range writes {
+			if err := saveWithAudit(tx, write.Todo, write.Entry); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	// Get total count
-	if err := query.Count(&total).Error; err != nil {
-		return nil, err
+	run := func() error {
+		return r.db.WithContext(ctx).Transaction(upsert)
+	}
+	err := r.opts.withRetry(ctx, run)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		err = r.opts.withRetry(ctx, run)
 	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &todo, created, nil
+}
 
-	// Calculate offset
-	offset := (page - 1) * perPage
+// ListByUserID retrieves paginated todos for a user. opts.Sort and
+// opts.Order must already be validated against models.TodoSortFields, and
+// opts.Offset must be set.
+func (r *TodoRepository) ListByUserID(ctx context.Context, userID uint, opts models.TodoListOptions) (*models.TodoListResponse, error) {
+	var todos []models.Todo
+	var total int64
 
-	// Get paginated results
-	if err := query.Offset(offset).Limit(perPage).Order("created_at DESC").Find(&todos).Error; err != nil {
+	query := r.filterByUserID(ctx, userID, opts)
+
+	// Get total count. With a result window, count at most one match past
+	// it, which is enough to tell whether it overflowed.
+	truncated := false
+	limit := opts.PerPage
+	if opts.MaxResults > 0 {
+		window := r.filterByUserID(ctx, userID, opts).Select("id").Limit(opts.MaxResults + 1)
+		if err := r.db.WithContext(ctx).Table("(?) AS result_window", window).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		if total > int64(opts.MaxResults) {
+			total = int64(opts.MaxResults)
+			truncated = true
+		}
+		limit = min(limit, opts.MaxResults-*opts.Offset)
+	} else if err := query.Count(&total).Error; err != nil {
 		return nil, err
 	}
 
+	// Get paginated results
+	if limit > 0 {
+		if err := query.Preload("Tags").Offset(*opts.Offset).Limit(limit).Order(orderClause(opts.Sort, opts.Order)).Find(&todos).Error; err != nil {
+			return nil, err
+		}
+	}
+
 	// Convert to response
 	todoResponses := make([]models.TodoResponse, len(todos))
 	for i, todo := range todos {
 		todoResponses[i] = todo.ToResponse()
 	}
 
-	totalPages := int(math.Ceil(float64(total) / float64(perPage)))
+	totalPages := int(math.Ceil(float64(total) / float64(opts.PerPage)))
 
-	return &models.TodoListResponse{
+	response := &models.TodoListResponse{
 		Todos:      todoResponses,
 		Total:      total,
-		Page:       page,
-		PerPage:    perPage,
+		Page:       opts.Page,
+		PerPage:    opts.PerPage,
 		TotalPages: totalPages,
+	}
+	if truncated {
+		response.Truncated = true
+		response.Warning = fmt.Sprintf("More than %d todos matched; only the first %d can be listed. Narrow the search to see the rest.", opts.MaxResults, opts.MaxResults)
+	}
+
+	if opts.IncludeSummary {
+		summary, err := r.summarize(ctx, userID, opts, total)
+		if err != nil {
+			return nil, err
+		}
+		response.Summary = summary
+	}
+
+	return response, nil
+}
+
+// ListAllByUserID retrieves all of a user's todos, oldest first
+func (r *TodoRepository) ListAllByUserID(ctx context.Context, userID uint) ([]models.Todo, error) {
+	var todos []models.Todo
+	err := r.db.WithContext(ctx).
+		Preload("Tags").
+		Where("user_id = ?", userID).
+		Order("created_at ASC, id ASC").
+		Find(&todos).Error
+	return todos, err
+}
+
+// ListByUserIDAfterID retrieves up to limit of a user's todos with IDs above
+// afterID, in ID order, with their tags
+func (r *TodoRepository) ListByUserIDAfterID(ctx context.Context, userID, afterID uint, limit int) ([]models.Todo, error) {
+	var todos []models.Todo
+	err := r.db.WithContext(ctx).
+		Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("name ASC") }).
+		Where("user_id = ? AND id > ?", userID, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&todos).Error
+	return todos, err
+}
+
+// ListWithDueDateByUserID retrieves all of a user's todos that have a due date
+func (r *TodoRepository) ListWithDueDateByUserID(ctx context.Context, userID uint) ([]models.Todo, error) {
+	var todos []models.Todo
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND due_date IS NOT NULL", userID).
+		Order("due_date ASC").
+		Find(&todos).Error
+	return todos, err
+}
+
+// filterByUserID scopes a query to a user's todos matching the list filters
+func (r *TodoRepository) filterByUserID(ctx context.Context, userID uint, opts models.TodoListOptions) *gorm.DB {
+	query := r.db.WithContext(ctx).Model(&models.Todo{}).Where("user_id = ?", userID)
+
+	// Filter by completed status if provided
+	if opts.Completed != nil {
+		query = query.Where("completed = ?", *opts.Completed)
+	}
+	if !opts.IncludeArchived {
+		query = query.Where("archived = ?", false)
+	}
+	if opts.Color != "" {
+		query = query.Where("color = ?", opts.Color)
+	}
+	if opts.DueAfter != nil {
+		query = query.Where("due_date IS NOT NULL AND due_date >= ?", *opts.DueAfter)
+	}
+	if opts.DueBefore != nil {
+		query = query.Where("due_date IS NOT NULL AND due_date <= ?", *opts.DueBefore)
+	}
+	if opts.Tag != "" {
+		tagged := r.db.Model(&models.TodoTag{}).
+			Select("todo_tags.todo_id").
+			Joins("JOIN tags ON tags.id = todo_tags.tag_id").
+			Where("tags.user_id = ? AND tags.name = ?", userID, opts.Tag)
+		query = query.Where("id IN (?)", tagged)
+	}
+	if opts.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(opts.Search)) + "%"
+		query = query.Where(`(LOWER(title) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+
+	return query
+}
+
+// summarize counts completed, pending and overdue todos across the whole
+// filtered set in a single aggregate query
+func (r *TodoRepository) summarize(ctx context.Context, userID uint, opts models.TodoListOptions, total int64) (*models.TodoSummary, error) {
+	var counts struct {
+		Completed int64
+		Overdue   int64
+	}
+	err := r.filterByUserID(ctx, userID, opts).
+		Select("COUNT(CASE WHEN completed = ? THEN 1 END) AS completed, "+
+			"COUNT(CASE WHEN completed = ? AND due_date < ? THEN 1 END) AS overdue",
+			true, false, time.Now()).
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TodoSummary{
+		Completed: counts.Completed,
+		Pending:   total - counts.Completed,
+		Overdue:   counts.Overdue,
 	}, nil
 }
 
+// priorityRank maps priorities to their logical order, since sorting the
+// column alphabetically would give high < low < medium
+const priorityRank = "CASE priority WHEN 'low' THEN 1 WHEN 'medium' THEN 2 WHEN 'high' THEN 3 ELSE 0 END"
+
+// orderClause builds the ORDER BY clause for a validated sort field and
+// direction. Todos without a due date always sort last, which SQLite and
+// Postgres would otherwise disagree on. Ties are broken by ID so equal
+// values keep one order across pages.
+func orderClause(sort, order string) string {
+	direction := "DESC"
+	if order == "asc" {
+		direction = "ASC"
+	}
+
+	switch sort {
+	case "priority":
+		return priorityRank + " " + direction + ", id ASC"
+	case "due_date":
+		return "due_date IS NULL, due_date " + direction + ", id ASC"
+	default:
+		return sort + " " + direction + ", id ASC"
+	}
+}
+
 // Update updates a todo record
-func (r *TodoRepository) Update(todo *models.Todo) error {
-	return r.db.Save(todo).Error
+func (r *TodoRepository) Update(ctx context.Context, todo *models.Todo) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Save(todo).Error
+	})
+}
+
+// SaveWithAudit creates or updates a todo and records the audit entry in the
+// same transaction, pointing the entry at the saved todo
+func (r *TodoRepository) SaveWithAudit(ctx context.Context, todo *models.Todo, entry *models.AuditLog) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return saveWithAudit(tx, todo, entry)
+		})
+	})
+}
+
+// TodoWrite is a todo to save along with the audit entry recording it
+type TodoWrite struct {
+	Todo  *models.Todo
+	Entry *models.AuditLog
+}
+
+// SaveAllWithAudit saves several todos and their audit entries in one
+// transaction. Todos without an ID are created.
+func (r *TodoRepository) SaveAllWithAudit(ctx context.Context, writes []TodoWrite) error {
+	if len(writes) == 0 {
+		return nil
+	}
+	created := make([]bool, len(writes))
+	for i, write := range writes {
+		created[i] = write.Todo.ID == 0
+	}
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for i, write := range writes {
+				// A failed attempt may have assigned the new todos IDs
+				if created[i] {
+					write.Todo.ID = 0
+				}
+				if err := saveWithAudit(tx, write.Todo, write.Entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// saveWithAudit saves a todo, with its tags when set, and records the audit
+// entry for it
+func saveWithAudit(tx *gorm.DB, todo *models.Todo, entry *models.AuditLog) error {
+	if err := tx.Omit(clause.Associations).Save(todo).Error; err != nil {
+		return err
+	}
+	if todo.Tags != nil {
+		if err := replaceTags(tx, todo); err != nil {
+			return err
+		}
+	}
+	return createAudit(tx, todo, entry)
+}
+
+// createAudit records an audit entry for a todo that was just written
+func createAudit(tx *gorm.DB, todo *models.Todo, entry *models.AuditLog) error {
+	entry.ID = 0
+	entry.EntityID = todo.ID
+	return tx.Create(entry).Error
+}
+
+// replaceTags makes todo.Tags the todo's complete set of tags, creating
+// tags the user doesn't have yet
+func replaceTags(tx *gorm.DB, todo *models.Todo) error {
+	if len(todo.Tags) == 0 {
+		return tx.Where("todo_id = ?", todo.ID).Delete(&models.TodoTag{}).Error
+	}
+
+	names := make([]string, len(todo.Tags))
+	for i, tag := range todo.Tags {
+		names[i] = tag.Name
+	}
+	newTags := models.NewTags(todo.UserID, names)
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&newTags).Error; err != nil {
+		return err
+	}
+	var tags []models.Tag
+	if err := tx.Where("user_id = ? AND name IN ?", todo.UserID, names).Order("name ASC").Find(&tags).Error; err != nil {
+		return err
+	}
+	todo.Tags = tags
+	return tx.Model(todo).Omit("Tags.*").Association("Tags").Replace(tags)
+}
+
+// ListTags retrieves a todo's tags, ordered by name
+func (r *TodoRepository) ListTags(ctx context.Context, todoID uint) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	err := r.db.WithContext(ctx).
+		Joins("JOIN todo_tags ON todo_tags.tag_id = tags.id").
+		Where("todo_tags.todo_id = ?", todoID).
+		Order("tags.name ASC").
+		Find(&tags).Error
+	return tags, err
+}
+
+// ListVersions retrieves the audit entries recording a todo's versions, oldest first
+func (r *TodoRepository) ListVersions(ctx context.Context, todoID uint) ([]models.AuditLog, error) {
+	var entries []models.AuditLog
+	err := r.versions(ctx, todoID).Order("id ASC").Find(&entries).Error
+	return entries, err
+}
+
+// FindVersion retrieves the audit entry with the given ID if it records a
+// version of the todo
+func (r *TodoRepository) FindVersion(ctx context.Context, todoID, auditID uint) (*models.AuditLog, error) {
+	var entry models.AuditLog
+	err := r.versions(ctx, todoID).Where("id = ?", auditID).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &entry, err
+}
+
+// versions scopes a query to the audit entries recording a todo's versions
+func (r *TodoRepository) versions(ctx context.Context, todoID uint) *gorm.DB {
+	return r.db.WithContext(ctx).Model(&models.AuditLog{}).
+		Where("entity_type = ? AND entity_id = ? AND action IN ?", "todo", todoID, models.TodoVersionActions)
+}
+
+// Reassign moves a todo and its subtasks, at any depth and deleted or not,
+// to another owner. The audit entry and each moved todo's new version, built
+// by version, are recorded in the same transaction, so an ownership change is
+// never left unaudited. A subtask moved on its own is detached from its
+// parent, which stays behind. Tags move to the new owner's tags of the same
+// names, which are created if needed.
+func (r *TodoRepository) Reassign(ctx context.Context, todo *models.Todo, userID uint, entry *models.AuditLog, version func(todo *models.Todo) (*models.AuditLog, error)) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			moved := []*models.Todo{todo}
+			seen := map[uint]bool{todo.ID: true}
+			for parentIDs := []uint{todo.ID}; len(parentIDs) > 0; {
+				var children []models.Todo
+				if err := tx.Unscoped().Where("parent_id IN ?", parentIDs).Find(&children).Error; err != nil {
+					return err
+				}
+				parentIDs = nil
+				for i := range children {
+					if !seen[children[i].ID] {
+						seen[children[i].ID] = true
+						moved = append(moved, &children[i])
+						parentIDs = append(parentIDs, children[i].ID)
+					}
+				}
+			}
+
+			todo.ParentID = nil
+			for _, moving := range moved {
+				var names []string
+				err := tx.Model(&models.Tag{}).
+					Joins("JOIN todo_tags ON todo_tags.tag_id = tags.id").
+					Where("todo_tags.todo_id = ?", moving.ID).
+					Pluck("tags.name", &names).Error
+				if err != nil {
+					return err
+				}
+				err = tx.Unscoped().Model(moving).Updates(map[string]interface{}{"user_id": userID, "parent_id": moving.ParentID}).Error
+				if err != nil {
+					return err
+				}
+				moving.UserID = userID
+				moving.Tags = models.NewTags(userID, names)
+				if err := replaceTags(tx, moving); err != nil {
+					return err
+				}
+
+				versionLog, err := version(moving)
+				if err != nil {
+					return err
+				}
+				if err := createAudit(tx, moving, versionLog); err != nil {
+					return err
+				}
+			}
+
+			entry.ID = 0
+			return tx.Create(entry).Error
+		})
+	})
 }
 
 // Delete soft-deletes a todo
-func (r *TodoRepository) Delete(id uint) error {
-	return r.db.Delete(&models.Todo{}, id).Error
+func (r *TodoRepository) Delete(ctx context.Context, id uint) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Delete(&models.Todo{}, id).Error
+	})
+}
+
+// HardDelete permanently removes a todo and its tag links
+func (r *TodoRepository) HardDelete(ctx context.Context, id uint) error {
+	_, err := r.deleteWhere(ctx, true, "id = ?", id)
+	return err
+}
+
+// FindTombstone retrieves the tombstone left by permanently deleting one of
+// the user's todos
+func (r *TodoRepository) FindTombstone(ctx context.Context, todoID, userID uint) (*models.TodoTombstone, error) {
+	var tombstone models.TodoTombstone
+	err := r.db.WithContext(ctx).Where("todo_id = ? AND user_id = ?", todoID, userID).First(&tombstone).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &tombstone, err
+}
+
+// UsageByUserID totals a user's active and soft-deleted todos and the bytes
+// their text takes, in a single aggregate query
+func (r *TodoRepository) UsageByUserID(ctx context.Context, userID uint) (*models.UsageResponse, error) {
+	var usage models.UsageResponse
+	err := r.db.WithContext(ctx).Unscoped().Model(&models.Todo{}).
+		Select("COUNT(CASE WHEN deleted_at IS NULL THEN 1 END) AS active_todos, "+
+			"COUNT(CASE WHEN deleted_at IS NULL AND archived = ? THEN 1 END) AS archived_todos, "+
+			"COUNT(deleted_at) AS deleted_todos, "+
+			"COALESCE(SUM(OCTET_LENGTH(title) + OCTET_LENGTH(COALESCE(description, ''))), 0) AS text_bytes", true).
+		Where("user_id = ?", userID).
+		Scan(&usage).Error
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// DeleteCompletedByUserID deletes a user's completed todos, permanently
+// when hard is set, and returns how many were removed
+func (r *TodoRepository) DeleteCompletedByUserID(ctx context.Context, userID uint, hard bool) (int64, error) {
+	return r.deleteWhere(ctx, hard, "user_id = ? AND completed = ?", userID, true)
+}
+
+// DeleteByIDsAndUserID deletes the given todos the user owns in one
+// statement, permanently when hard is set, and returns how many were removed.
+// IDs the user doesn't own are skipped.
+func (r *TodoRepository) DeleteByIDsAndUserID(ctx context.Context, userID uint, ids []uint, hard bool) (int64, error) {
+	return r.deleteWhere(ctx, hard, "user_id = ? AND id IN ?", userID, ids)
+}
+
+// deleteWhere deletes the todos matching the condition, removing their tag
+// links too on hard deletes and, when configured, leaving tombstones
+func (r *TodoRepository) deleteWhere(ctx context.Context, hard bool, query string, args ...interface{}) (int64, error) {
+	var deleted int64
+	err := r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if hard {
+				matching := tx.Model(&models.Todo{}).Select("id").Where(query, args...)
+				err := tx.Where("todo_id IN (?)", matching).Delete(&models.TodoTag{}).Error
+				if err != nil {
+					return err
+				}
+				tx = tx.Unscoped()
+				if r.opts.tombstones {
+					err := tx.Exec("INSERT INTO todo_tombstones (todo_id, user_id, deleted_at) "+
+						"SELECT id, user_id, ? FROM todos WHERE "+query, append([]interface{}{time.Now()}, args...)...).Error
+					if err != nil {
+						return err
+					}
+				}
+			}
+			result := tx.Where(query, args...).Delete(&models.Todo{})
+			deleted = result.RowsAffected
+			return result.Error
+		})
+	})
+	return deleted, err
 }
 
 // DeleteByIDAndUserID deletes a todo by ID only if owned by user
-func (r *TodoRepository) DeleteByIDAndUserID(id, userID uint) error {
-	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Todo{})
+func (r *TodoRepository) DeleteByIDAndUserID(ctx context.Context, id, userID uint) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.Todo{})
 	if result.RowsAffected == 0 {
 		return gorm.ErrRecordNotFound
 	}
 	return result.Error
 }
 
+// Restore undeletes a soft-deleted todo owned by the user and records the
+// audit entry in the same transaction. Returns gorm.ErrRecordNotFound if no
+// such deleted todo exists.
+func (r *TodoRepository) Restore(ctx context.Context, id, userID uint, entry *models.AuditLog) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Unscoped().Model(&models.Todo{}).
+				Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, userID).
+				Update("deleted_at", nil)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			entry.ID = 0
+			entry.EntityID = id
+			return tx.Create(entry).Error
+		})
+	})
+}
+
 // CountByUserID counts todos for a user
-func (r *TodoRepository) CountByUserID(userID uint) (int64, error) {
+func (r *TodoRepository) CountByUserID(ctx context.Context, userID uint) (int64, error) {
 	var count int64
-	err := r.db.Model(&models.Todo{}).Where("user_id = ?", userID).Count(&count).Error
+	err := r.db.WithContext(ctx).Model(&models.Todo{}).Where("user_id = ?", userID).Count(&count).Error
 	return count, err
 }
 
 // CountCompletedByUserID counts completed todos for a user
-func (r *TodoRepository) CountCompletedByUserID(userID uint) (int64, error) {
+func (r *TodoRepository) CountCompletedByUserID(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Todo{}).Where("user_id = ? AND completed = ?", userID, true).Count(&count).Error
+	return count, err
+}
+
+// CountOverdueByUserID counts incomplete todos whose due date is before now
+func (r *TodoRepository) CountOverdueByUserID(ctx context.Context, userID uint, now time.Time) (int64, error) {
 	var count int64
-	err := r.db.Model(&models.Todo{}).Where("user_id = ? AND completed = ?", userID, true).Count(&count).Error
+	err := r.db.WithContext(ctx).Model(&models.Todo{}).
+		Where("user_id = ? AND completed = ? AND due_date < ?", userID, false, now).
+		Count(&count).Error
 	return count, err
 }
+
+// CountByPriorityByUserID counts a user's todos per priority, with a zero
+// count for priorities no todo has
+func (r *TodoRepository) CountByPriorityByUserID(ctx context.Context, userID uint) (map[string]int64, error) {
+	var rows []struct {
+		Priority string
+		Count    int64
+	}
+	err := r.db.WithContext(ctx).Model(&models.Todo{}).
+		Select("priority, COUNT(*) AS count").
+		Where("user_id = ?", userID).
+		Group("priority").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(models.TodoPriorities))
+	for _, priority := range models.TodoPriorities {
+		counts[priority] = 0
+	}
+	for _, row := range rows {
+		counts[row.Priority] = row.Count
+	}
+	return counts, nil
+}
+
+// CountCompletedSinceByUserID counts todos a user completed at or after the given time
+func (r *TodoRepository) CountCompletedSinceByUserID(ctx context.Context, userID uint, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Todo{}).
+		Where("user_id = ? AND completed = ? AND completed_at >= ?", userID, true, since).
+		Count(&count).Error
+	return count, err
+}
+
+// ListCompletedBetweenByUserID retrieves todos a user completed in [from, to),
+// in completion order
+func (r *TodoRepository) ListCompletedBetweenByUserID(ctx context.Context, userID uint, from, to time.Time) ([]models.Todo, error) {
+	var todos []models.Todo
+	err := r.db.WithContext(ctx).
+		Preload("Tags").
+		Where("user_id = ? AND completed = ? AND completed_at >= ? AND completed_at < ?", userID, true, from, to).
+		Order("completed_at ASC, id ASC").
+		Find(&todos).Error
+	return todos, err
+}
+
+// ListDueReminders retrieves up to limit incomplete todos, across all users,
+// whose reminder time is at or before now and has not been dispatched
+func (r *TodoRepository) ListDueReminders(ctx context.Context, now time.Time, limit int) ([]models.Todo, error) {
+	var todos []models.Todo
+	err := r.db.WithContext(ctx).
+		Where("completed = ? AND remind_at <= ? AND reminded_at IS NULL", false, now).
+		Order("remind_at ASC, id ASC").
+		Limit(limit).
+		Find(&todos).Error
+	return todos, err
+}
+
+// MarkReminded records that a todo's reminder was dispatched at the given
+// time. It reports false if the reminder had already been claimed, so
+// concurrent dispatchers send each reminder once.
+func (r *TodoRepository) MarkReminded(ctx context.Context, id uint, at time.Time) (bool, error) {
+	var claimed bool
+	err := r.opts.withRetry(ctx, func() error {
+		result := r.db.WithContext(ctx).Model(&models.Todo{}).
+			Where("id = ? AND reminded_at IS NULL", id).
+			Update("reminded_at", at)
+		claimed = result.RowsAffected == 1
+		return result.Error
+	})
+	return claimed, err
+}
+
+// FindExistingIDsByUserID returns which of the given IDs exist for a user
+func (r *TodoRepository) FindExistingIDsByUserID(ctx context.Context, userID uint, ids []uint) ([]uint, error) {
+	var existing []uint
+	err := r.db.WithContext(ctx).Model(&models.Todo{}).
+		Where("user_id = ? AND id IN ?", userID, ids).
+		Pluck("id", &existing).Error
+	return existing, err
+}
+
+// AverageCompletionSecondsByUserID returns the mean number of seconds between
+// creation and completion of a user's completed todos, or nil if none have
+// been completed. The average is computed in the database where the dialect
+// is known, otherwise in application code.
+func (r *TodoRepository) AverageCompletionSecondsByUserID(ctx context.Context, userID uint) (*float64, error) {
+	var expr string
+	switch r.db.Dialector.Name() {
+	case "sqlite":
+		expr = "AVG((julianday(completed_at) - julianday(created_at)) * 86400)"
+	case "postgres":
+		expr = "AVG(EXTRACT(EPOCH FROM (completed_at - created_at)))"
+	default:
+		return r.averageCompletionSecondsInApp(ctx, userID)
+	}
+
+	var avg *float64
+	err := r.completedWithTimestamp(ctx, userID).Select(expr).Scan(&avg).Error
+	return avg, err
+}
+
+// averageCompletionSecondsInApp is the portable fallback for AverageCompletionSecondsByUserID
+func (r *TodoRepository) averageCompletionSecondsInApp(ctx context.Context, userID uint) (*float64, error) {
+	var todos []models.Todo
+	if err := r.completedWithTimestamp(ctx, userID).Select("created_at", "completed_at").Find(&todos).Error; err != nil {
+		return nil, err
+	}
+	if len(todos) == 0 {
+		return nil, nil
+	}
+
+	var total float64
+	for _, todo := range todos {
+		total += todo.CompletedAt.Sub(todo.CreatedAt).Seconds()
+	}
+	avg := total / float64(len(todos))
+	return &avg, nil
+}
+
+// completedWithTimestamp scopes a query to a user's completed todos with a completion time
+func (r *TodoRepository) completedWithTimestamp(ctx context.Context, userID uint) *gorm.DB {
+	return r.db.WithContext(ctx).Model(&models.Todo{}).
+		Where("user_id = ? AND completed = ? AND completed_at IS NOT NULL", userID, true)
+}
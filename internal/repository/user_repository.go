@@ -1,31 +1,39 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/bhaskar/todo-api/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // UserRepository handles user data operations
 type UserRepository struct {
-	db *gorm.DB
+	db   *gorm.DB
+	opts options
 }
 
 // NewUserRepository creates a new user repository
-func NewUserRepository(db *gorm.DB) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *gorm.DB, opts ...Option) *UserRepository {
+	return &UserRepository{db: db, opts: newOptions(opts)}
 }
 
 // Create inserts a new user into the database
-func (r *UserRepository) Create(user *models.User) error {
-	return r.db.Create(user).Error
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(user).Error
+	})
 }
 
 // FindByEmail retrieves a user by email
-func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	err := r.db.Where("email = ?", email).First(&user).Error
+	err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -33,28 +41,327 @@ func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
 }
 
 // FindByID retrieves a user by ID
-func (r *UserRepository) FindByID(id uint) (*models.User, error) {
+func (r *UserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
 	var user models.User
-	err := r.db.First(&user, id).Error
+	err := r.db.WithContext(ctx).First(&user, id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
 	return &user, err
 }
 
+// ListAfterID retrieves up to limit users with IDs above afterID, in ID
+// order, for paging through every user without offsets
+func (r *UserRepository) ListAfterID(ctx context.Context, afterID uint, limit int) ([]models.User, error) {
+	var users []models.User
+	err := r.db.WithContext(ctx).Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&users).Error
+	return users, err
+}
+
+// FindByFeedTokenHash retrieves the user owning a calendar feed token
+func (r *UserRepository) FindByFeedTokenHash(ctx context.Context, hash string) (*models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Where("feed_token_hash = ?", hash).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &user, err
+}
+
+// FindByVerificationTokenHash retrieves the user an email verification token
+// was issued to
+func (r *UserRepository) FindByVerificationTokenHash(ctx context.Context, hash string) (*models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Where("verification_token_hash = ?", hash).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &user, err
+}
+
+// MarkEmailVerified records that a user verified their email, spending the
+// verification token
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id uint) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"email_verified":          true,
+			"verification_token_hash": nil,
+			"verification_expires_at": nil,
+		}).Error
+	})
+}
+
+// FindByResetTokenHash retrieves the user a password reset token was issued to
+func (r *UserRepository) FindByResetTokenHash(ctx context.Context, hash string) (*models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Where("reset_token_hash = ?", hash).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &user, err
+}
+
+// UpdateResetToken stores a user's pending password reset token, replacing
+// any earlier one
+func (r *UserRepository) UpdateResetToken(ctx context.Context, id uint, hash string, expiresAt time.Time) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"reset_token_hash": hash,
+			"reset_expires_at": expiresAt,
+		}).Error
+	})
+}
+
+// ResetPassword replaces a user's password hash and spends their reset token
+func (r *UserRepository) ResetPassword(ctx context.Context, id uint, hashedPassword string) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"password":         hashedPassword,
+			"reset_token_hash": nil,
+			"reset_expires_at": nil,
+		}).Error
+	})
+}
+
 // Update updates a user record
-func (r *UserRepository) Update(user *models.User) error {
-	return r.db.Save(user).Error
+func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Save(user).Error
+	})
+}
+
+// UpdatePassword replaces a user's stored password hash
+func (r *UserRepository) UpdatePassword(ctx context.Context, id uint, hashedPassword string) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Update("password", hashedPassword).Error
+	})
+}
+
+// RecordFailedLogin counts a failed login and, once the count reaches
+// maxFailures, locks the account until lockUntil and restarts the count. It
+// is a single statement so concurrent failures cannot skip the limit.
+func (r *UserRepository) RecordFailedLogin(ctx context.Context, id uint, maxFailures int, lockUntil time.Time) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"failed_logins": gorm.Expr("CASE WHEN failed_logins + 1 >= ? THEN 0 ELSE failed_logins + 1 END", maxFailures),
+			"locked_until":  gorm.Expr("CASE WHEN failed_logins + 1 >= ? THEN ? ELSE locked_until END", maxFailures, lockUntil),
+		}).Error
+	})
+}
+
+// ResetLoginFailures clears a user's failed login count and any lockout
+func (r *UserRepository) ResetLoginFailures(ctx context.Context, id uint) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"failed_logins": 0,
+			"locked_until":  nil,
+		}).Error
+	})
+}
+
+// UpdatePreferences saves a user's preference columns. Zero values are
+// written explicitly, since they are meaningful (e.g. a disabled threshold).
+func (r *UserRepository) UpdatePreferences(ctx context.Context, user *models.User) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(user).Select("due_soon_threshold").Updates(user).Error
+	})
+}
+
+// UpdateFeedTokenHash sets or, with nil, clears a user's calendar feed token
+func (r *UserRepository) UpdateFeedTokenHash(ctx context.Context, id uint, hash *string) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Update("feed_token_hash", hash).Error
+	})
+}
+
+// Restore writes an imported user and their todos in one transaction,
+// keeping the imported IDs unless they are taken. A user matching by email,
+// or a todo matching by ID or external ID, is overwritten when merge is set
+// and skipped otherwise; a skipped user's todos are skipped with it. Merging
+// keeps an existing user's email verification state and pending token. Todo
+// user and parent IDs are rewritten to the IDs actually used. Written todos
+// get their tags, recreated for the user where needed, and the version entry
+// that version builds for them.
+func (r *UserRepository) Restore(ctx context.Context, imported *models.User, todos []models.Todo, merge bool, version func(todo *models.Todo, created bool) (*models.AuditLog, error)) (models.DataImportResult, error) {
+	var result models.DataImportResult
+	err := r.opts.withRetry(ctx, func() error {
+		// IDs are rewritten as rows are written, so each attempt starts from
+		// the records as imported
+		user, todos := new(models.User), slices.Clone(todos)
+		*user = *imported
+		result = models.DataImportResult{}
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var existing models.User
+			err := tx.Unscoped().Where("email = ?", user.Email).First(&existing).Error
+			switch {
+			case err == nil && !merge:
+				result.UsersSkipped = 1
+				result.TodosSkipped = len(todos)
+				return nil
+			case err == nil:
+				user.ID = existing.ID
+				user.DeletedAt = gorm.DeletedAt{}
+				if err := tx.Unscoped().Select("*").Omit("feed_token_hash", "failed_logins", "locked_until", "email_verified", "verification_token_hash", "verification_expires_at").Save(user).Error; err != nil {
+					return err
+				}
+				result.UsersMerged = 1
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				if err := freeID(tx, &models.User{}, &user.ID); err != nil {
+					return err
+				}
+				if err := tx.Create(user).Error; err != nil {
+					return err
+				}
+				result.UsersCreated = 1
+			default:
+				return err
+			}
+
+			ids := make(map[uint]uint, len(todos))
+			for i := range todos {
+				todo := &todos[i]
+				importedID := todo.ID
+				todo.UserID = user.ID
+				if todo.ParentID != nil {
+					if parentID, ok := ids[*todo.ParentID]; ok {
+						todo.ParentID = &parentID
+					} else {
+						todo.ParentID = nil
+					}
+				}
+
+				match, err := findRestoreMatch(tx, todo)
+				if err != nil {
+					return err
+				}
+				switch {
+				case match != nil && !merge:
+					result.TodosSkipped++
+					ids[importedID] = match.ID
+					continue
+				case match != nil:
+					todo.ID = match.ID
+					if err := tx.Unscoped().Select("*").Omit("deleted_at", clause.Associations).Save(todo).Error; err != nil {
+						return err
+					}
+					result.TodosMerged++
+				default:
+					if err := freeID(tx, &models.Todo{}, &todo.ID); err != nil {
+						return err
+					}
+					if err := tx.Omit(clause.Associations).Create(todo).Error; err != nil {
+						return err
+					}
+					result.TodosCreated++
+				}
+				if todo.Tags != nil {
+					if err := replaceTags(tx, todo); err != nil {
+						return err
+					}
+				}
+				entry, err := version(todo, match == nil)
+				if err != nil {
+					return err
+				}
+				if err := createAudit(tx, todo, entry); err != nil {
+					return err
+				}
+				ids[importedID] = todo.ID
+			}
+
+			return syncIDSequences(tx)
+		})
+	})
+	return result, err
+}
+
+// findRestoreMatch finds the user's existing todo an imported todo
+// corresponds to, by ID or else by external ID
+func findRestoreMatch(tx *gorm.DB, todo *models.Todo) (*models.Todo, error) {
+	var match models.Todo
+	query := tx.Where("user_id = ? AND id = ?", todo.UserID, todo.ID)
+	if todo.ExternalID != nil {
+		query = tx.Where("user_id = ? AND (id = ? OR external_id = ?)", todo.UserID, todo.ID, *todo.ExternalID)
+	}
+	err := query.First(&match).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &match, err
+}
+
+// freeID clears *id when a row of model's table, deleted or not, already
+// uses it, so the insert is assigned a fresh one
+func freeID(tx *gorm.DB, model interface{}, id *uint) error {
+	if *id == 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Unscoped().Model(model).Where("id = ?", *id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		*id = 0
+	}
+	return nil
+}
+
+// syncIDSequences moves Postgres ID sequences past explicitly inserted IDs,
+// which they do not track on their own. SQLite needs no adjustment.
+func syncIDSequences(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, table := range []string{"users", "todos"} {
+		err := tx.Exec("SELECT setval(pg_get_serial_sequence(?, 'id'), COALESCE(MAX(id), 1)) FROM "+table, table).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Delete soft-deletes a user
-func (r *UserRepository) Delete(id uint) error {
-	return r.db.Delete(&models.User{}, id).Error
+func (r *UserRepository) Delete(ctx context.Context, id uint) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Delete(&models.User{}, id).Error
+	})
+}
+
+// DeleteWithTodos soft-deletes a user along with all their todos, in one
+// transaction
+func (r *UserRepository) DeleteWithTodos(ctx context.Context, id uint) error {
+	return r.opts.withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("user_id = ?", id).Delete(&models.Todo{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&models.User{}, id).Error
+		})
+	})
 }
 
-// ExistsByEmail checks if a user with the given email exists
-func (r *UserRepository) ExistsByEmail(email string) (bool, error) {
+// ExistsByEmail checks if a user with the given email exists. Deleted users
+// count, since their email stays taken.
+func (r *UserRepository) ExistsByEmail(ctx context.Context, email string) (bool, error) {
 	var count int64
-	err := r.db.Model(&models.User{}).Where("email = ?", email).Count(&count).Error
+	err := r.db.WithContext(ctx).Unscoped().Model(&models.User{}).Where("email = ?", email).Count(&count).Error
 	return count > 0, err
 }
+
+// likeEscaper escapes LIKE wildcards so user input matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchByEmailPrefix returns up to limit users whose email starts with
+// prefix, case-insensitively, ordered by email. The pattern is anchored at
+// the start so it can use the lower(email) index created by Migrate.
+func (r *UserRepository) SearchByEmailPrefix(ctx context.Context, prefix string, limit int) ([]models.User, error) {
+	var users []models.User
+	pattern := likeEscaper.Replace(strings.ToLower(prefix)) + "%"
+	err := r.db.WithContext(ctx).
+		Where(`LOWER(email) LIKE ? ESCAPE '\'`, pattern).
+		Order("LOWER(email)").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
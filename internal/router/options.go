@@ -0,0 +1,39 @@
+package router
+
+import (
+	"sync/atomic"
+
+	"github.com/bhaskar/todo-api/internal/events"
+)
+
+// Option configures the router
+type Option func(*options)
+
+type options struct {
+	shuttingDown *atomic.Bool
+	bus          *events.Bus
+}
+
+// WithShutdownFlag rejects new requests with a 503 once flag is set, for use
+// during graceful shutdown
+func WithShutdownFlag(flag *atomic.Bool) Option {
+	return func(o *options) {
+		o.shuttingDown = flag
+	}
+}
+
+// WithEventBus publishes account events, such as email verification
+// requests, on bus
+func WithEventBus(bus *events.Bus) Option {
+	return func(o *options) {
+		o.bus = bus
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,216 @@
+package router
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/handlers"
+	"github.com/bhaskar/todo-api/internal/middleware"
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/internal/repository"
+	"github.com/bhaskar/todo-api/internal/services"
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	// Swagger docs
+	_ "github.com/bhaskar/todo-api/docs"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+// TodoRepositoryOptions returns the todo repository options cfg sets, so
+// todo repositories created outside the router write the same way
+func TodoRepositoryOptions(cfg *config.Config) []repository.Option {
+	opts := []repository.Option{repository.WithWriteRetries(cfg.Database.WriteRetries)}
+	if cfg.Todo.Tombstones {
+		opts = append(opts, repository.WithTombstones())
+	}
+	return opts
+}
+
+// New wires repositories, services and handlers together and returns the
+// router with all middleware and routes registered
+func New(cfg *config.Config, db *gorm.DB, opts ...Option) *gin.Engine {
+	o := newOptions(opts)
+
+	// Initialize JWT manager
+	jwtManager := utils.NewJWTManagerWithAlgorithm(cfg.JWT.Secret, cfg.JWT.Expiry, cfg.JWT.Issuer, cfg.JWT.Algorithm)
+	jwtManager.UseBlacklist(utils.NewTokenBlacklist(time.Minute))
+	jwtManager.UseAudiences(cfg.JWT.ClientIDs, cfg.JWT.RequireAudience)
+
+	// Initialize repositories
+	retries := repository.WithWriteRetries(cfg.Database.WriteRetries)
+	userRepo := repository.NewUserRepository(db, retries)
+	todoRepo := repository.NewTodoRepository(db, TodoRepositoryOptions(cfg)...)
+	apiKeyRepo := repository.NewAPIKeyRepository(db, retries)
+
+	models.SetTimeFormat(cfg.Server.TimeFormat)
+
+	// Initialize services
+	authService := services.NewAuthService(userRepo, jwtManager, cfg.Security)
+	if o.bus != nil {
+		authService.UseEventBus(o.bus)
+	}
+	todoService := services.NewTodoService(todoRepo, userRepo, cfg.Todo)
+	adminService := services.NewAdminService(todoRepo, userRepo, cfg.Security)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo, cfg.Security)
+
+	// Initialize handlers
+	publicRoutes := middleware.PublicPaths(cfg.Auth.PublicRoutes)
+	authHandler := handlers.NewAuthHandler(authService, todoService)
+	todoHandler := handlers.NewTodoHandler(todoService, cfg.Todo)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+
+	router := gin.New()
+	adminHandler := handlers.NewAdminHandler(adminService, router.Routes, publicRoutes)
+
+	// Global middleware
+	router.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		RequestIDHeader:          cfg.Server.RequestIDHeader,
+		FallbackRequestIDHeaders: cfg.Server.RequestIDFallbackHeaders,
+	}))
+	if o.shuttingDown != nil {
+		router.Use(middleware.ShutdownMiddleware(o.shuttingDown, cfg.Server.ShutdownRetryAfter))
+	}
+	if cfg.Database.CountQueries {
+		router.Use(middleware.QueryCount())
+	}
+	router.Use(middleware.Recovery(cfg.Server.Environment != "production"))
+	if cfg.Server.EnforceHTTPS {
+		router.Use(middleware.HTTPSMiddleware(cfg.Server.HSTSMaxAge))
+	}
+	if cfg.Server.MaxHeaderCount > 0 || cfg.Server.MaxHeaderBytes > 0 {
+		router.Use(middleware.MaxHeadersMiddleware(cfg.Server.MaxHeaderCount, cfg.Server.MaxHeaderBytes))
+	}
+	if cfg.Server.MaxQueryLength > 0 {
+		router.Use(middleware.MaxQueryLengthMiddleware(cfg.Server.MaxQueryLength))
+	}
+	if cfg.Server.MaxConcurrentRequests > 0 {
+		router.Use(middleware.ConcurrencyLimitMiddleware(cfg.Server.MaxConcurrentRequests, cfg.Server.ShedRetryAfter))
+	}
+	// 100 requests per minute per IP, ahead of auth so credential guessing is
+	// limited too. API routes add a per-user limit once the user is known.
+	router.Use(middleware.RateLimitMiddleware(100, time.Minute))
+
+	// CORS middleware
+	router.Use(func(c *gin.Context) {
+		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Unmodified-Since")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", cfg.Server.RequestIDHeader+", X-Applied-Defaults, Last-Modified, X-RateLimit-Limit, X-RateLimit-Remaining, Retry-After")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	})
+
+	// Health check
+	router.GET("/health", handlers.HealthCheck)
+
+	// Swagger docs
+	if cfg.Server.EnableSwagger {
+		router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	}
+
+	// JSON routes answer 406 to clients that won't accept JSON
+	jsonOnly := middleware.Negotiate(middleware.MIMEJSON)
+
+	// Optional features answer 404 while switched off
+	apiKeys := middleware.RequireFeature(cfg.Features, config.FeatureAPIKeys)
+	calendar := middleware.RequireFeature(cfg.Features, config.FeatureCalendar)
+	importing := middleware.RequireFeature(cfg.Features, config.FeatureImport)
+	history := middleware.RequireFeature(cfg.Features, config.FeatureHistory)
+
+	// API routes; everything requires auth except the configured public routes
+	var apiKeyAuth middleware.APIKeyAuthenticator
+	if cfg.Features.Enabled(config.FeatureAPIKeys) {
+		apiKeyAuth = apiKeyService
+	}
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddlewareWithAPIKeys(jwtManager, publicRoutes, apiKeyAuth))
+	if cfg.Auth.RequireActiveUser {
+		api.Use(middleware.LoadUser(authService))
+	}
+	api.Use(middleware.UserRateLimitMiddleware(100, time.Minute))
+	{
+		api.GET("/meta", jsonOnly, todoHandler.Meta)
+
+		// Auth routes
+		auth := api.Group("/auth", jsonOnly)
+		{
+			auth.POST("/register", authHandler.Register)
+			auth.POST("/login", authHandler.Login)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/logout", authHandler.Logout)
+			auth.GET("/verify", authHandler.VerifyEmail)
+			auth.POST("/forgot-password", authHandler.ForgotPassword)
+			auth.POST("/reset-password", authHandler.ResetPassword)
+			auth.GET("/profile", authHandler.GetProfile)
+			auth.PUT("/password", authHandler.ChangePassword)
+			auth.DELETE("/account", authHandler.DeleteAccount)
+			auth.GET("/usage", authHandler.GetUsage)
+			auth.GET("/preferences", authHandler.GetPreferences)
+			auth.PUT("/preferences", authHandler.UpdatePreferences)
+			auth.POST("/feed-token", calendar, authHandler.GenerateFeedToken)
+			auth.DELETE("/feed-token", calendar, authHandler.RevokeFeedToken)
+			auth.POST("/api-keys", apiKeys, apiKeyHandler.Create)
+			auth.GET("/api-keys", apiKeys, apiKeyHandler.List)
+			auth.DELETE("/api-keys/:id", apiKeys, apiKeyHandler.Revoke)
+		}
+
+		// Todo routes
+		todos := api.Group("/todos", jsonOnly)
+		{
+			todos.POST("", todoHandler.Create)
+			todos.GET("", todoHandler.List)
+			todos.POST("/import", importing, todoHandler.Import)
+			todos.POST("/exists", todoHandler.Exists)
+			todos.PATCH("/bulk", todoHandler.BulkComplete)
+			todos.DELETE("/bulk", todoHandler.BulkDelete)
+			todos.POST("/bulk/priority", todoHandler.BulkSetPriority)
+			todos.GET("/stats", todoHandler.GetStats)
+			todos.GET("/velocity", todoHandler.GetVelocity)
+			todos.GET("/completed-today", todoHandler.CompletedToday)
+			todos.DELETE("/completed", todoHandler.ClearCompleted)
+			todos.GET("/tree", todoHandler.Tree)
+			todos.GET("/external/:externalID", todoHandler.GetByExternalID)
+			todos.PUT("/external/:externalID", todoHandler.UpsertByExternalID)
+			todos.GET("/:id", todoHandler.GetByID)
+			todos.PUT("/:id", todoHandler.Update)
+			todos.DELETE("/:id", todoHandler.Delete)
+			todos.POST("/:id/archive", todoHandler.Archive)
+			todos.POST("/:id/unarchive", todoHandler.Unarchive)
+			todos.POST("/:id/restore", todoHandler.Restore)
+			todos.GET("/:id/history", history, todoHandler.History)
+			todos.GET("/:id/history/diff", history, todoHandler.HistoryDiff)
+		}
+
+		// Calendar feeds share the todos prefix but respond with iCalendar
+		calendarFeeds := api.Group("/todos", calendar, middleware.Negotiate(middleware.MIMECalendar))
+		{
+			calendarFeeds.GET("/calendar.ics", todoHandler.Calendar)
+			calendarFeeds.GET("/calendar/:token", todoHandler.CalendarFeed)
+		}
+
+		// Admin routes
+		admin := api.Group("")
+		admin.Use(middleware.RequireAdmin(authService))
+		if cfg.Security.AdminSigningSecret != "" {
+			admin.Use(middleware.RequireSignedRequest([]byte(cfg.Security.AdminSigningSecret), cfg.Security.AdminSigningWindow, middleware.NewNonceCache()))
+		}
+		{
+			admin.GET("/routes", adminHandler.ListRoutes)
+			admin.GET("/admin/users", adminHandler.SearchUsers)
+			admin.GET("/admin/export", middleware.Negotiate(middleware.MIMENDJSON), adminHandler.Export)
+			admin.POST("/admin/import", adminHandler.Import)
+			admin.POST("/admin/users/:id/unlock", adminHandler.UnlockUser)
+			admin.PUT("/admin/todos/:id/owner", adminHandler.ReassignTodo)
+		}
+	}
+
+	return router
+}
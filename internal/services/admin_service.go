@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidImport is returned when import data is malformed
+var ErrInvalidImport = errors.New("invalid import data")
+
+// AdminService handles administrative operations across users
+type AdminService struct {
+	todoRepo *repository.TodoRepository
+	userRepo *repository.UserRepository
+	cfg      config.SecurityConfig
+}
+
+// NewAdminService creates a new admin service
+func NewAdminService(todoRepo *repository.TodoRepository, userRepo *repository.UserRepository, cfg config.SecurityConfig) *AdminService {
+	return &AdminService{
+		todoRepo: todoRepo,
+		userRepo: userRepo,
+		cfg:      cfg,
+	}
+}
+
+// ReassignTodo moves a todo, with its subtasks, to another user on behalf of
+// an admin. A subtask is detached from its parent, which stays behind.
+func (s *AdminService) ReassignTodo(ctx context.Context, actorID, todoID, userID uint) (*models.TodoResponse, error) {
+	todo, err := s.todoRepo.FindByID(ctx, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	details, err := json.Marshal(map[string]uint{
+		"from_user_id": todo.UserID,
+		"to_user_id":   userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &models.AuditLog{
+		ActorID:    actorID,
+		Action:     models.AuditActionTodoReassigned,
+		EntityType: "todo",
+		EntityID:   todo.ID,
+		Details:    string(details),
+	}
+	err = s.todoRepo.Reassign(ctx, todo, userID, entry, func(todo *models.Todo) (*models.AuditLog, error) {
+		return versionEntry(actorID, models.AuditActionTodoUpdated, todo)
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrExternalIDConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response := todo.ToResponse()
+	return &response, nil
+}
+
+// UnlockUser lifts a login lockout early and clears the failure count
+func (s *AdminService) UnlockUser(ctx context.Context, userID uint) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.New("user not found")
+	}
+
+	return s.userRepo.ResetLoginFailures(ctx, userID)
+}
+
+// exportBatchSize is how many rows an export reads per query
+const exportBatchSize = 500
+
+// Export passes every user, each followed by their todos, to emit one record
+// at a time. Rows are read in ID-ordered batches so memory use stays flat
+// regardless of dataset size. Deleted users and todos are not exported.
+func (s *AdminService) Export(ctx context.Context, emit func(models.ExportRecord) error) error {
+	var lastUserID uint
+	for {
+		users, err := s.userRepo.ListAfterID(ctx, lastUserID, exportBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			if err := emit(models.ExportRecord{Type: models.ExportTypeUser, User: user.ToExport()}); err != nil {
+				return err
+			}
+			if err := s.exportTodos(ctx, user.ID, emit); err != nil {
+				return err
+			}
+		}
+
+		if len(users) < exportBatchSize {
+			return nil
+		}
+		lastUserID = users[len(users)-1].ID
+	}
+}
+
+// exportTodos emits a user's todos in ID-ordered batches
+func (s *AdminService) exportTodos(ctx context.Context, userID uint, emit func(models.ExportRecord) error) error {
+	var lastTodoID uint
+	for {
+		todos, err := s.todoRepo.ListByUserIDAfterID(ctx, userID, lastTodoID, exportBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, todo := range todos {
+			if err := emit(models.ExportRecord{Type: models.ExportTypeTodo, Todo: todo.ToExport()}); err != nil {
+				return err
+			}
+		}
+
+		if len(todos) < exportBatchSize {
+			return nil
+		}
+		lastTodoID = todos[len(todos)-1].ID
+	}
+}
+
+// Import restores users and todos from an NDJSON export. Each user is
+// written with their todos in its own transaction, so a failure part way
+// leaves earlier users restored. Records must be in export order: a user,
+// then that user's todos. Written todos get a version recorded on behalf of
+// the admin.
+func (s *AdminService) Import(ctx context.Context, actorID uint, r io.Reader, merge bool) (*models.DataImportResult, error) {
+	result := &models.DataImportResult{}
+	var user *models.User
+	var importedUserID uint
+	var todos []models.Todo
+
+	flush := func() error {
+		if user == nil {
+			return nil
+		}
+		restored, err := s.userRepo.Restore(ctx, user, todos, merge, func(todo *models.Todo, created bool) (*models.AuditLog, error) {
+			if created {
+				return versionEntry(actorID, models.AuditActionTodoCreated, todo)
+			}
+			return versionEntry(actorID, models.AuditActionTodoUpdated, todo)
+		})
+		if err != nil {
+			return err
+		}
+		result.Add(restored)
+		user, todos = nil, nil
+		return nil
+	}
+
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var record models.ExportRecord
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("%w: record %d: %v", ErrInvalidImport, line, err)
+		}
+
+		switch {
+		case record.Type == models.ExportTypeUser && record.User != nil:
+			if err := flush(); err != nil {
+				return result, err
+			}
+			if user, err = s.importedUser(record.User); err != nil {
+				return result, fmt.Errorf("%w: record %d: %v", ErrInvalidImport, line, err)
+			}
+			importedUserID = record.User.ID
+		case record.Type == models.ExportTypeTodo && record.Todo != nil:
+			if user == nil || record.Todo.UserID != importedUserID {
+				return result, fmt.Errorf("%w: record %d: todo does not follow its user", ErrInvalidImport, line)
+			}
+			if record.Todo.Title == "" {
+				return result, fmt.Errorf("%w: record %d: todo title is required", ErrInvalidImport, line)
+			}
+			if len(record.Todo.Tags) > models.MaxTagsPerTodo {
+				return result, fmt.Errorf("%w: record %d: todo has more than %d tags", ErrInvalidImport, line, models.MaxTagsPerTodo)
+			}
+			todos = append(todos, importedTodo(record.Todo))
+		default:
+			return result, fmt.Errorf("%w: record %d: unknown record type %q", ErrInvalidImport, line, record.Type)
+		}
+	}
+
+	return result, flush()
+}
+
+// importedUser builds a user from an import record. Pre-hashed passwords
+// must be bcrypt hashes; plaintext passwords are hashed.
+func (s *AdminService) importedUser(record *models.ExportUser) (*models.User, error) {
+	if record.Email == "" {
+		return nil, errors.New("user email is required")
+	}
+
+	password := record.PasswordHash
+	switch {
+	case password != "":
+		if _, err := bcrypt.Cost([]byte(password)); err != nil {
+			return nil, errors.New("password_hash is not a bcrypt hash")
+		}
+	case record.Password != "":
+		hashed, err := bcrypt.GenerateFromPassword([]byte(record.Password), s.cfg.BcryptCost)
+		if err != nil {
+			return nil, err
+		}
+		password = string(hashed)
+	default:
+		return nil, errors.New("user needs a password_hash or password")
+	}
+
+	role := record.Role
+	if role != models.RoleAdmin {
+		role = models.RoleUser
+	}
+
+	return &models.User{
+		ID:               record.ID,
+		Email:            record.Email,
+		Password:         password,
+		Role:             role,
+		EmailVerified:    record.EmailVerified,
+		DueSoonThreshold: record.DueSoonThreshold,
+		CreatedAt:        record.CreatedAt,
+		UpdatedAt:        record.UpdatedAt,
+	}, nil
+}
+
+// importedTodo builds a todo from an import record. Its tags are the
+// record's whole set, so merging clears tags the record doesn't list; they
+// are given an owner when the todo is restored.
+func importedTodo(record *models.ExportTodo) models.Todo {
+	priority := record.Priority
+	if priority == "" {
+		priority = models.DefaultPriority
+	}
+	color := models.NormalizeColor(record.Color)
+	if !models.ValidColor(color) {
+		color = ""
+	}
+	recurrence := record.Recurrence
+	if !slices.Contains(models.Recurrences, recurrence) {
+		recurrence = ""
+	}
+
+	return models.Todo{
+		ID:          record.ID,
+		Title:       record.Title,
+		Description: record.Description,
+		Completed:   record.Completed,
+		Archived:    record.Archived,
+		Priority:    priority,
+		Color:       color,
+		DueDate:     toUTC(record.DueDate),
+		RemindAt:    toUTC(record.RemindAt),
+		RemindedAt:  record.RemindedAt,
+		CompletedAt: record.CompletedAt,
+		ExternalID:  record.ExternalID,
+		ParentID:    record.ParentID,
+		Recurrence:  recurrence,
+		Tags:        models.NewTags(0, models.NormalizeTags(record.Tags)),
+		CreatedAt:   record.CreatedAt,
+		UpdatedAt:   record.UpdatedAt,
+	}
+}
+
+// Bounds for user search results
+const (
+	DefaultUserSearchLimit = 20
+	MaxUserSearchLimit     = 50
+)
+
+// SearchUsers finds users by email prefix, returning at most limit results
+// (capped at MaxUserSearchLimit)
+func (s *AdminService) SearchUsers(ctx context.Context, emailPrefix string, limit int) ([]models.UserResponse, error) {
+	if limit < 1 {
+		limit = DefaultUserSearchLimit
+	}
+	if limit > MaxUserSearchLimit {
+		limit = MaxUserSearchLimit
+	}
+
+	users, err := s.userRepo.SearchByEmailPrefix(ctx, emailPrefix, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.UserResponse, len(users))
+	for i, user := range users {
+		responses[i] = user.ToResponse()
+	}
+	return responses, nil
+}
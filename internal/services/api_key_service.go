@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/internal/repository"
+	"github.com/bhaskar/todo-api/pkg/utils"
+)
+
+// ErrAPIKeyLimit is returned when creating a key would exceed the user's
+// limit of active API keys
+var ErrAPIKeyLimit = errors.New("API key limit reached")
+
+// apiKeyPrefixLength is how many characters of a key are kept to identify it
+const apiKeyPrefixLength = len(models.APIKeyPrefix) + 8
+
+// APIKeyService handles API key business logic
+type APIKeyService struct {
+	apiKeyRepo *repository.APIKeyRepository
+	userRepo   *repository.UserRepository
+	cfg        config.SecurityConfig
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(apiKeyRepo *repository.APIKeyRepository, userRepo *repository.UserRepository, cfg config.SecurityConfig) *APIKeyService {
+	return &APIKeyService{apiKeyRepo: apiKeyRepo, userRepo: userRepo, cfg: cfg}
+}
+
+// Create issues a new API key for a user, unless they already have the
+// configured maximum of active keys
+func (s *APIKeyService) Create(ctx context.Context, userID uint, req *models.CreateAPIKeyRequest) (*models.CreatedAPIKeyResponse, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	secret := models.APIKeyPrefix + token
+
+	key := &models.APIKey{
+		UserID:  userID,
+		Name:    req.Name,
+		Prefix:  secret[:apiKeyPrefixLength],
+		KeyHash: utils.HashToken(secret),
+	}
+	created, err := s.apiKeyRepo.CreateWithinLimit(ctx, key, s.cfg.MaxAPIKeys)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, fmt.Errorf("%w: at most %d active keys are allowed; revoke one first", ErrAPIKeyLimit, s.cfg.MaxAPIKeys)
+	}
+
+	return &models.CreatedAPIKeyResponse{APIKeyResponse: key.ToResponse(), Key: secret}, nil
+}
+
+// List returns a user's active API keys
+func (s *APIKeyService) List(ctx context.Context, userID uint) ([]models.APIKeyResponse, error) {
+	keys, err := s.apiKeyRepo.ListActiveByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.APIKeyResponse, len(keys))
+	for i := range keys {
+		responses[i] = keys[i].ToResponse()
+	}
+	return responses, nil
+}
+
+// Revoke revokes one of a user's active API keys, freeing its slot
+func (s *APIKeyService) Revoke(ctx context.Context, userID, keyID uint) error {
+	revoked, err := s.apiKeyRepo.Revoke(ctx, keyID, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errors.New("API key not found")
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns the owner of an active API key, or nil if the
+// key is unknown or revoked. The key's last-used time is refreshed once it
+// is older than the configured interval.
+func (s *APIKeyService) AuthenticateAPIKey(ctx context.Context, key string) (*models.User, error) {
+	apiKey, err := s.apiKeyRepo.FindActiveByHash(ctx, utils.HashToken(key))
+	if err != nil || apiKey == nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	staleBefore := now.Add(-s.cfg.APIKeyLastUsedInterval)
+	if apiKey.LastUsedAt == nil || apiKey.LastUsedAt.Before(staleBefore) {
+		// Best effort: a failed update shouldn't reject a valid key
+		if _, err := s.apiKeyRepo.TouchLastUsed(ctx, apiKey.ID, now, staleBefore); err != nil {
+			utils.LoggerFromContext(ctx).Printf("Failed to update API key %d last used time: %v", apiKey.ID, err)
+		}
+	}
+
+	return s.userRepo.FindByID(ctx, apiKey.UserID)
+}
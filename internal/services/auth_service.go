@@ -1,50 +1,142 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
 
+	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/events"
 	"github.com/bhaskar/todo-api/internal/models"
 	"github.com/bhaskar/todo-api/internal/repository"
 	"github.com/bhaskar/todo-api/pkg/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrAccountLocked is returned when logging into an account locked after
+// repeated failures, even if the password is correct
+var ErrAccountLocked = errors.New("account locked after too many failed login attempts")
+
+// ErrIncorrectPassword is returned when changing a password with the wrong
+// current password
+var ErrIncorrectPassword = errors.New("current password is incorrect")
+
+// ErrInvalidToken is returned when refreshing a token that is malformed,
+// forged, or expired beyond the refresh grace window
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// ErrInvalidVerificationToken is returned when verifying an email with a
+// token that is unknown, already used, or expired
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// ErrEmailNotVerified is returned when logging in before verifying the
+// account's email while verification is required
+var ErrEmailNotVerified = errors.New("email address not verified")
+
+// ErrInvalidResetToken is returned when resetting a password with a token
+// that is unknown, already used, or expired
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// ErrInvalidEmail is returned when an email is malformed or contains
+// control characters
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// ErrUnknownClient is returned when a login or registration asks for a
+// token scoped to a client_id that isn't configured, or names no client
+// while tokens must be scoped to one
+var ErrUnknownClient = errors.New("missing or unknown client_id")
+
 // AuthService handles authentication business logic
 type AuthService struct {
 	userRepo   *repository.UserRepository
 	jwtManager *utils.JWTManager
+	cfg        config.SecurityConfig
+	bus        *events.Bus
 }
 
 // NewAuthService creates a new auth service
-func NewAuthService(userRepo *repository.UserRepository, jwtManager *utils.JWTManager) *AuthService {
+func NewAuthService(userRepo *repository.UserRepository, jwtManager *utils.JWTManager, cfg config.SecurityConfig) *AuthService {
 	return &AuthService{
 		userRepo:   userRepo,
 		jwtManager: jwtManager,
+		cfg:        cfg,
 	}
 }
 
-// RegisterRequest represents registration request data
+// UseEventBus publishes account events, such as the email verification
+// token to deliver to a new user, on bus
+func (s *AuthService) UseEventBus(bus *events.Bus) {
+	s.bus = bus
+}
+
+// RegisterRequest represents registration request data. Emails are checked
+// by the service once normalized, so surrounding whitespace is accepted.
 type RegisterRequest struct {
-	Email    string `json:"email" binding:"required,email"`
+	Email    string `json:"email" binding:"required,max=255"`
 	Password string `json:"password" binding:"required,min=6,max=100"`
+	// ClientID scopes the token to one of the configured clients
+	ClientID string `json:"client_id,omitempty"`
 }
 
 // LoginRequest represents login request data
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
+	Email    string `json:"email" binding:"required,max=255"`
+	Password string `json:"password" binding:"required"`
+	// ClientID scopes the token to one of the configured clients
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// ChangePasswordRequest represents change password request data. The new
+// password follows the same rules as registration.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6,max=100"`
+}
+
+// ForgotPasswordRequest represents a password reset request
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,max=255"`
+}
+
+// ResetPasswordRequest represents the data to complete a password reset.
+// The new password follows the same rules as registration.
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6,max=100"`
+}
+
+// DeleteAccountRequest confirms an account deletion with the password
+type DeleteAccountRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// AuthResponse represents authentication response
+// AuthResponse represents authentication response. Registering while email
+// verification is required returns no token.
 type AuthResponse struct {
 	User  models.UserResponse `json:"user"`
-	Token string              `json:"token"`
+	Token string              `json:"token,omitempty"`
 }
 
 // Register creates a new user account
-func (s *AuthService) Register(req *RegisterRequest) (*AuthResponse, error) {
+func (s *AuthService) Register(ctx context.Context, req *RegisterRequest) (*AuthResponse, error) {
+	if err := s.checkClientID(req.ClientID); err != nil {
+		return nil, err
+	}
+
+	email, err := s.normalizeEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return nil, ErrInvalidEmail
+	}
+
 	// Check if email already exists
-	exists, err := s.userRepo.ExistsByEmail(req.Email)
+	exists, err := s.userRepo.ExistsByEmail(ctx, email)
 	if err != nil {
 		return nil, err
 	}
@@ -53,37 +145,126 @@ func (s *AuthService) Register(req *RegisterRequest) (*AuthResponse, error) {
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), s.cfg.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the hash of the verification token is stored
+	verificationToken, err := utils.RandomToken(32)
 	if err != nil {
 		return nil, err
 	}
+	verificationHash := utils.HashToken(verificationToken)
+	verificationExpiry := time.Now().Add(s.cfg.EmailVerificationTTL)
 
 	// Create user
 	user := &models.User{
-		Email:    req.Email,
+		Email:    email,
 		Password: string(hashedPassword),
+		Role:     models.RoleUser,
+
+		VerificationTokenHash: &verificationHash,
+		VerificationExpiresAt: &verificationExpiry,
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
+	if err := s.userRepo.Create(ctx, user); err != nil {
 		return nil, err
 	}
 
+	if s.bus != nil {
+		s.bus.Publish(ctx, events.Event{
+			Type:       events.EmailVerificationRequested,
+			UserID:     user.ID,
+			OccurredAt: time.Now().UTC(),
+			Payload: models.EmailVerification{
+				Email:     user.Email,
+				Token:     verificationToken,
+				ExpiresAt: verificationExpiry.UTC(),
+			},
+		})
+	}
+
+	response := &AuthResponse{User: user.ToResponse()}
+	if s.cfg.RequireEmailVerification {
+		return response, nil
+	}
+
 	// Generate JWT token
-	token, err := s.jwtManager.GenerateToken(user.ID, user.Email)
+	response.Token, err = s.jwtManager.GenerateTokenForAudience(user.ID, user.Email, req.ClientID)
 	if err != nil {
 		return nil, err
 	}
 
-	return &AuthResponse{
-		User:  user.ToResponse(),
-		Token: token,
-	}, nil
+	return response, nil
+}
+
+// checkClientID checks that a token can be issued for the client a login or
+// registration names
+func (s *AuthService) checkClientID(clientID string) error {
+	if clientID == "" {
+		if s.jwtManager.RequiresAudience() {
+			return ErrUnknownClient
+		}
+		return nil
+	}
+	if !s.jwtManager.AcceptsAudience(clientID) {
+		return ErrUnknownClient
+	}
+	return nil
+}
+
+// normalizeEmail trims surrounding whitespace from an email and, when
+// configured, lowercases it in Unicode NFC form, so variants of one address
+// find the same account. Emails containing control characters are rejected.
+func (s *AuthService) normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if strings.IndexFunc(email, unicode.IsControl) >= 0 {
+		return "", ErrInvalidEmail
+	}
+	if s.cfg.NormalizeEmails {
+		email = models.NormalizeEmail(email)
+	}
+	return email, nil
+}
+
+// VerifyEmail marks the user a verification token was issued to as
+// verified. Each token works once, until it expires.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) (*models.UserResponse, error) {
+	if token == "" {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	user, err := s.userRepo.FindByVerificationTokenHash(ctx, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.VerificationExpiresAt == nil || time.Now().After(*user.VerificationExpiresAt) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	user.EmailVerified = true
+
+	response := user.ToResponse()
+	return &response, nil
 }
 
 // Login authenticates a user and returns a token
-func (s *AuthService) Login(req *LoginRequest) (*AuthResponse, error) {
+func (s *AuthService) Login(ctx context.Context, req *LoginRequest) (*AuthResponse, error) {
+	if err := s.checkClientID(req.ClientID); err != nil {
+		return nil, err
+	}
+
+	email, err := s.normalizeEmail(req.Email)
+	if err != nil {
+		return nil, errors.New("invalid email or password")
+	}
+
 	// Find user by email
-	user, err := s.userRepo.FindByEmail(req.Email)
+	user, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
 		return nil, err
 	}
@@ -91,13 +272,39 @@ func (s *AuthService) Login(req *LoginRequest) (*AuthResponse, error) {
 		return nil, errors.New("invalid email or password")
 	}
 
+	// Locked accounts are rejected before the password is even checked
+	if user.IsLocked(time.Now()) {
+		return nil, fmt.Errorf("%w; try again after %s", ErrAccountLocked, user.LockedUntil.UTC().Format(time.RFC3339))
+	}
+
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		if s.cfg.MaxFailedLogins > 0 {
+			lockUntil := time.Now().Add(s.cfg.LockoutDuration)
+			if err := s.userRepo.RecordFailedLogin(ctx, user.ID, s.cfg.MaxFailedLogins, lockUntil); err != nil {
+				utils.LoggerFromContext(ctx).Printf("Failed to record failed login for user %d: %v", user.ID, err)
+			}
+		}
 		return nil, errors.New("invalid email or password")
 	}
 
+	// The password is checked first so this doesn't reveal which emails exist
+	if s.cfg.RequireEmailVerification && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	// A successful login restarts the failure count
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		if err := s.userRepo.ResetLoginFailures(ctx, user.ID); err != nil {
+			utils.LoggerFromContext(ctx).Printf("Failed to reset failed logins for user %d: %v", user.ID, err)
+		}
+	}
+
+	// Upgrade hashes created with a lower cost than currently configured
+	s.rehashIfNeeded(ctx, user, req.Password)
+
 	// Generate JWT token
-	token, err := s.jwtManager.GenerateToken(user.ID, user.Email)
+	token, err := s.jwtManager.GenerateTokenForAudience(user.ID, user.Email, req.ClientID)
 	if err != nil {
 		return nil, err
 	}
@@ -108,7 +315,269 @@ func (s *AuthService) Login(req *LoginRequest) (*AuthResponse, error) {
 	}, nil
 }
 
+// RequestPasswordReset issues a password reset token for the user with the
+// given email, replacing any earlier one. Unknown emails are silently
+// ignored, so callers can't tell which emails are registered.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	email, err := s.normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil || user == nil {
+		return err
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(s.cfg.PasswordResetTTL)
+	if err := s.userRepo.UpdateResetToken(ctx, user.ID, utils.HashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	if s.bus != nil {
+		s.bus.Publish(ctx, events.Event{
+			Type:       events.PasswordResetRequested,
+			UserID:     user.ID,
+			OccurredAt: time.Now().UTC(),
+			Payload: models.PasswordReset{
+				Email:     user.Email,
+				Token:     token,
+				ExpiresAt: expiresAt.UTC(),
+			},
+		})
+	}
+	return nil
+}
+
+// ResetPassword sets a new password for the user a reset token was issued
+// to, and revokes the tokens issued to them until now. Each reset token works
+// once, until it expires.
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	user, err := s.userRepo.FindByResetTokenHash(ctx, utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+	if user == nil || user.ResetExpiresAt == nil || time.Now().After(*user.ResetExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(newPassword), s.cfg.BcryptCost)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.ResetPassword(ctx, user.ID, string(hashed)); err != nil {
+		return err
+	}
+
+	// Whoever knew the old password may still hold a token
+	s.revokeUserTokens(ctx, user.ID)
+	return nil
+}
+
+// Refresh exchanges a valid token, or one that expired within the configured
+// grace window, for a new one without asking for the password again. The
+// exchanged token is revoked.
+func (s *AuthService) Refresh(ctx context.Context, token string) (*AuthResponse, error) {
+	claims, err := s.jwtManager.ValidateTokenWithLeeway(token, s.cfg.TokenRefreshGrace)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// The account may have been deleted or locked since the token was issued
+	user, err := s.userRepo.FindByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidToken
+	}
+	if user.IsLocked(time.Now()) {
+		return nil, fmt.Errorf("%w; try again after %s", ErrAccountLocked, user.LockedUntil.UTC().Format(time.RFC3339))
+	}
+
+	// The token's client may have been removed since it was issued
+	newToken, err := s.jwtManager.RefreshToken(claims)
+	if errors.Is(err, utils.ErrUnknownAudience) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Each token is exchanged once; a concurrent refresh of the same token
+	// loses here. Tokens that can't be revoked are still refreshed.
+	err = s.jwtManager.Consume(claims, claims.ExpiresAt.Add(s.cfg.TokenRefreshGrace))
+	if errors.Is(err, utils.ErrTokenRevoked) {
+		return nil, ErrInvalidToken
+	}
+
+	return &AuthResponse{
+		User:  user.ToResponse(),
+		Token: newToken,
+	}, nil
+}
+
+// Logout revokes a token so it is rejected before it expires, including by
+// Refresh during its grace window
+func (s *AuthService) Logout(ctx context.Context, token string) error {
+	claims, err := s.jwtManager.ValidateToken(token)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	return s.jwtManager.Revoke(claims, claims.ExpiresAt.Add(s.cfg.TokenRefreshGrace))
+}
+
+// ChangePassword replaces a user's password after verifying the current one,
+// and revokes the tokens issued to them until now
+func (s *AuthService) ChangePassword(ctx context.Context, userID uint, oldPassword, newPassword string) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.New("user not found")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); err != nil {
+		return ErrIncorrectPassword
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), s.cfg.BcryptCost)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, string(hashedPassword)); err != nil {
+		return err
+	}
+
+	// Sessions opened with the old password, possibly by someone else, end
+	s.revokeUserTokens(ctx, user.ID)
+	return nil
+}
+
+// DeleteAccount soft-deletes a user and all their todos, once the password
+// confirms it, and revokes the tokens issued to them
+func (s *AuthService) DeleteAccount(ctx context.Context, userID uint, password string) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.New("user not found")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return ErrIncorrectPassword
+	}
+
+	if err := s.userRepo.DeleteWithTodos(ctx, user.ID); err != nil {
+		return err
+	}
+
+	// Without a per-request user check, the tokens would outlive the account
+	s.revokeUserTokens(ctx, user.ID)
+	return nil
+}
+
+// revokeUserTokens revokes every token issued to a user so far. Failures
+// (a manager without a blacklist) are logged, never fatal.
+func (s *AuthService) revokeUserTokens(ctx context.Context, userID uint) {
+	if err := s.jwtManager.RevokeUser(userID, s.cfg.TokenRefreshGrace); err != nil {
+		utils.LoggerFromContext(ctx).Printf("Failed to revoke tokens for user %d: %v", userID, err)
+	}
+}
+
+// rehashIfNeeded re-hashes a verified password when its stored hash uses a
+// lower bcrypt cost than configured. Failures are logged, never fatal.
+func (s *AuthService) rehashIfNeeded(ctx context.Context, user *models.User, password string) {
+	cost, err := bcrypt.Cost([]byte(user.Password))
+	if err != nil || cost >= s.cfg.BcryptCost {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), s.cfg.BcryptCost)
+	if err != nil {
+		utils.LoggerFromContext(ctx).Printf("Failed to rehash password for user %d: %v", user.ID, err)
+		return
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, string(hashedPassword)); err != nil {
+		utils.LoggerFromContext(ctx).Printf("Failed to save rehashed password for user %d: %v", user.ID, err)
+		return
+	}
+	user.Password = string(hashedPassword)
+}
+
 // GetUserByID retrieves a user by ID
-func (s *AuthService) GetUserByID(id uint) (*models.User, error) {
-	return s.userRepo.FindByID(id)
+func (s *AuthService) GetUserByID(ctx context.Context, id uint) (*models.User, error) {
+	return s.userRepo.FindByID(ctx, id)
+}
+
+// GetPreferences returns a user's preferences
+func (s *AuthService) GetPreferences(ctx context.Context, userID uint) (*models.PreferencesResponse, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	return &models.PreferencesResponse{DueSoonThreshold: user.DueSoonThreshold}, nil
+}
+
+// UpdatePreferences changes the preferences present in req
+func (s *AuthService) UpdatePreferences(ctx context.Context, userID uint, req *models.UpdatePreferencesRequest) (*models.PreferencesResponse, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	if req.DueSoonThreshold != nil {
+		user.DueSoonThreshold = *req.DueSoonThreshold
+	}
+	if err := s.userRepo.UpdatePreferences(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &models.PreferencesResponse{DueSoonThreshold: user.DueSoonThreshold}, nil
+}
+
+// GenerateFeedToken issues a new calendar feed token for a user, replacing
+// any previous one
+func (s *AuthService) GenerateFeedToken(ctx context.Context, userID uint) (*models.FeedTokenResponse, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := utils.HashToken(token)
+	if err := s.userRepo.UpdateFeedTokenHash(ctx, userID, &hash); err != nil {
+		return nil, err
+	}
+
+	return &models.FeedTokenResponse{
+		Token: token,
+		Path:  "/api/todos/calendar/" + token + ".ics",
+	}, nil
+}
+
+// RevokeFeedToken disables a user's calendar feed token
+func (s *AuthService) RevokeFeedToken(ctx context.Context, userID uint) error {
+	return s.userRepo.UpdateFeedTokenHash(ctx, userID, nil)
+}
+
+// IsAdmin reports whether the user exists and is an administrator
+func (s *AuthService) IsAdmin(ctx context.Context, userID uint) (bool, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil || user == nil {
+		return false, err
+	}
+	return user.IsAdmin(), nil
 }
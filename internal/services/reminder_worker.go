@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bhaskar/todo-api/internal/events"
+	"github.com/bhaskar/todo-api/internal/repository"
+)
+
+// reminderBatchSize caps how many reminders one scan dispatches; the rest
+// are picked up by the next scan
+const reminderBatchSize = 100
+
+// ReminderWorker periodically publishes a todo.reminder event for each
+// incomplete todo whose reminder time has passed
+type ReminderWorker struct {
+	todoRepo *repository.TodoRepository
+	bus      *events.Bus
+	interval time.Duration
+}
+
+// NewReminderWorker creates a worker scanning every interval
+func NewReminderWorker(todoRepo *repository.TodoRepository, bus *events.Bus, interval time.Duration) *ReminderWorker {
+	return &ReminderWorker{todoRepo: todoRepo, bus: bus, interval: interval}
+}
+
+// Run scans for due reminders every interval until ctx is cancelled
+func (w *ReminderWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Scan(ctx, time.Now()); err != nil && ctx.Err() == nil {
+				log.Printf("Reminder scan failed: %v", err)
+			}
+		}
+	}
+}
+
+// Scan dispatches the reminders due at now and returns how many were sent.
+// Each todo is marked reminded before its event is published, so a reminder
+// is sent at most once even with several workers running.
+func (w *ReminderWorker) Scan(ctx context.Context, now time.Time) (int, error) {
+	now = now.UTC()
+	todos, err := w.todoRepo.ListDueReminders(ctx, now, reminderBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range todos {
+		claimed, err := w.todoRepo.MarkReminded(ctx, todos[i].ID, now)
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+
+		todos[i].RemindedAt = &now
+		w.bus.Publish(ctx, events.Event{
+			Type:       events.TodoReminder,
+			UserID:     todos[i].UserID,
+			OccurredAt: now,
+			Payload:    todos[i].ToResponse(),
+		})
+		sent++
+	}
+	return sent, nil
+}
@@ -1,85 +1,444 @@
 package services
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/bhaskar/todo-api/internal/config"
 	"github.com/bhaskar/todo-api/internal/models"
 	"github.com/bhaskar/todo-api/internal/repository"
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"gorm.io/gorm"
 )
 
+// ErrTodoNotFound is returned when a todo doesn't exist or belongs to
+// another user
+var ErrTodoNotFound = errors.New("todo not found")
+
+// ErrTodoGone is returned when a todo was permanently deleted. It is also
+// an ErrTodoNotFound.
+var ErrTodoGone = fmt.Errorf("%w: permanently deleted", ErrTodoNotFound)
+
+// ErrTodoModified is returned when a conditional update finds the todo
+// changed after the client's precondition time
+var ErrTodoModified = errors.New("todo has been modified")
+
+// ErrInvalidListOptions is returned when list sorting or filtering is invalid
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+// ErrInvalidStatsMetrics is returned when stats are requested for an unknown metric
+var ErrInvalidStatsMetrics = errors.New("invalid stats metrics")
+
+// ErrInvalidFeedToken is returned when a calendar feed token is unknown or revoked
+var ErrInvalidFeedToken = errors.New("invalid feed token")
+
+// ErrInvalidParent is returned when a subtask's parent is not one of the user's todos
+var ErrInvalidParent = errors.New("parent todo not found")
+
+// ErrInvalidReminder is returned when a todo's reminder is after its due date
+var ErrInvalidReminder = errors.New("remind_at must not be after due_date")
+
+// ErrInvalidTodo is returned when an update would leave a todo with an
+// invalid field, whatever validation the request went through beforehand
+var ErrInvalidTodo = errors.New("invalid todo")
+
+// ErrVersionNotFound is returned when an audit entry is not a recorded
+// version of the requested todo
+var ErrVersionNotFound = errors.New("version not found")
+
+// MaxTreeDepth caps how many levels of subtasks the tree view nests
+const MaxTreeDepth = 5
+
+// maxSearchLength caps the list search term
+const maxSearchLength = 200
+
+// ErrExternalIDConflict is returned when a user already has a todo with the
+// given external ID
+var ErrExternalIDConflict = errors.New("external ID already in use")
+
 // TodoService handles todo business logic
 type TodoService struct {
 	todoRepo *repository.TodoRepository
+	userRepo *repository.UserRepository
+	cfg      config.TodoConfig
 }
 
 // NewTodoService creates a new todo service
-func NewTodoService(todoRepo *repository.TodoRepository) *TodoService {
-	return &TodoService{todoRepo: todoRepo}
+func NewTodoService(todoRepo *repository.TodoRepository, userRepo *repository.UserRepository, cfg config.TodoConfig) *TodoService {
+	return &TodoService{todoRepo: todoRepo, userRepo: userRepo, cfg: cfg}
 }
 
 // Create creates a new todo for a user
-func (s *TodoService) Create(userID uint, req *models.CreateTodoRequest) (*models.TodoResponse, error) {
-	// Set default priority if not provided
-	priority := req.Priority
-	if priority == "" {
-		priority = "medium"
+func (s *TodoService) Create(ctx context.Context, userID uint, req *models.CreateTodoRequest) (*models.TodoResponse, error) {
+	// Fill in defaults for omitted fields
+	req.ApplyDefaults()
+
+	// Treat an identical create moments after the last as a double submission
+	if s.cfg.DuplicateWindow > 0 {
+		existing, err := s.todoRepo.FindRecentDuplicate(ctx, userID, req.Title, req.Description, time.Now().Add(-s.cfg.DuplicateWindow))
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return s.toResponse(ctx, userID, existing)
+		}
+	}
+
+	if req.ParentID != nil {
+		parent, err := s.todoRepo.FindByIDAndUserID(ctx, *req.ParentID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, ErrInvalidParent
+		}
 	}
 
 	todo := &models.Todo{
 		Title:       req.Title,
 		Description: req.Description,
-		Priority:    priority,
-		DueDate:     req.DueDate,
+		Priority:    req.Priority,
+		Color:       models.NormalizeColor(req.Color),
+		DueDate:     toUTC(req.DueDate),
+		RemindAt:    toUTC(req.RemindAt),
+		ExternalID:  req.ExternalID,
+		ParentID:    req.ParentID,
+		Recurrence:  req.Recurrence,
 		UserID:      userID,
 		Completed:   false,
 	}
+	if tags := models.NormalizeTags(req.Tags); len(tags) > 0 {
+		todo.Tags = models.NewTags(userID, tags)
+	}
+	if !todo.ValidReminder() {
+		return nil, ErrInvalidReminder
+	}
 
-	if err := s.todoRepo.Create(todo); err != nil {
+	entry, err := versionEntry(userID, models.AuditActionTodoCreated, todo)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.todoRepo.SaveWithAudit(ctx, todo, entry); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrExternalIDConflict
+		}
 		return nil, err
 	}
 
-	response := todo.ToResponse()
-	return &response, nil
+	return s.toResponse(ctx, userID, todo)
 }
 
-// GetByID retrieves a todo by ID, with ownership validation
-func (s *TodoService) GetByID(todoID, userID uint) (*models.TodoResponse, error) {
-	todo, err := s.todoRepo.FindByIDAndUserID(todoID, userID)
+// Import creates several todos for a user in one transaction
+func (s *TodoService) Import(ctx context.Context, userID uint, reqs []models.CreateTodoRequest) (*models.TodoImportResponse, error) {
+	if len(reqs) == 0 {
+		return &models.TodoImportResponse{}, nil
+	}
+
+	todos := make([]models.Todo, len(reqs))
+	var parentIDs []uint
+	for i := range reqs {
+		reqs[i].ApplyDefaults()
+		todos[i] = models.Todo{
+			Title:       reqs[i].Title,
+			Description: reqs[i].Description,
+			Priority:    reqs[i].Priority,
+			Color:       models.NormalizeColor(reqs[i].Color),
+			DueDate:     toUTC(reqs[i].DueDate),
+			RemindAt:    toUTC(reqs[i].RemindAt),
+			ExternalID:  reqs[i].ExternalID,
+			ParentID:    reqs[i].ParentID,
+			Recurrence:  reqs[i].Recurrence,
+			UserID:      userID,
+		}
+		if tags := models.NormalizeTags(reqs[i].Tags); len(tags) > 0 {
+			todos[i].Tags = models.NewTags(userID, tags)
+		}
+		if !todos[i].ValidReminder() {
+			return nil, fmt.Errorf("item %d: %w", i, ErrInvalidReminder)
+		}
+		if reqs[i].ParentID != nil {
+			parentIDs = append(parentIDs, *reqs[i].ParentID)
+		}
+	}
+
+	// Imported subtasks may only hang off todos the user already has
+	if len(parentIDs) > 0 {
+		existing, err := s.todoRepo.FindExistingIDsByUserID(ctx, userID, parentIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range parentIDs {
+			if !slices.Contains(existing, id) {
+				return nil, ErrInvalidParent
+			}
+		}
+	}
+
+	entries := make([]*models.AuditLog, len(todos))
+	for i := range todos {
+		entry, err := versionEntry(userID, models.AuditActionTodoCreated, &todos[i])
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = entry
+	}
+
+	if err := s.todoRepo.CreateBatch(ctx, todos, entries); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrExternalIDConflict
+		}
+		return nil, err
+	}
+
+	return &models.TodoImportResponse{Imported: len(todos)}, nil
+}
+
+// GetByID retrieves a todo by ID, with ownership validation, including the
+// given expansions (keys of models.TodoExpansions)
+func (s *TodoService) GetByID(ctx context.Context, todoID, userID uint, expand ...string) (*models.TodoResponse, error) {
+	var preloads []string
+	for _, name := range expand {
+		preloads = append(preloads, models.TodoExpansions[name])
+	}
+
+	todo, err := s.getOwnedTodo(ctx, todoID, userID, preloads...)
+	if errors.Is(err, ErrTodoNotFound) && s.cfg.Tombstones {
+		tombstone, err := s.todoRepo.FindTombstone(ctx, todoID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if tombstone != nil {
+			return nil, ErrTodoGone
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toResponse(ctx, userID, todo)
+}
+
+// getOwnedTodo loads one of the user's todos with the given preloads,
+// returning ErrTodoNotFound when it doesn't exist or isn't theirs
+func (s *TodoService) getOwnedTodo(ctx context.Context, todoID, userID uint, preloads ...string) (*models.Todo, error) {
+	todo, err := s.todoRepo.FindByIDAndUserID(ctx, todoID, userID, preloads...)
 	if err != nil {
 		return nil, err
 	}
 	if todo == nil {
-		return nil, errors.New("todo not found")
+		return nil, ErrTodoNotFound
 	}
+	return todo, nil
+}
 
-	response := todo.ToResponse()
-	return &response, nil
+// GetByExternalID retrieves a user's todo by its external ID
+func (s *TodoService) GetByExternalID(ctx context.Context, externalID string, userID uint) (*models.TodoResponse, error) {
+	todo, err := s.todoRepo.FindByExternalIDAndUserID(ctx, externalID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	return s.toResponse(ctx, userID, todo)
+}
+
+// UpsertByExternalID replaces the user's todo with the given external ID, or
+// creates it if none exists. Reports whether the todo was created. With
+// globally scoped external IDs, an ID held by another user is a conflict.
+func (s *TodoService) UpsertByExternalID(ctx context.Context, userID uint, externalID string, req *models.UpsertTodoRequest) (*models.TodoResponse, bool, error) {
+	if req.Priority == "" {
+		req.Priority = models.DefaultPriority
+	}
+
+	todo, created, err := s.todoRepo.UpsertByExternalID(ctx, userID, externalID, func(todo *models.Todo, created bool) ([]repository.TodoWrite, error) {
+		wasCompleted := todo.Completed
+		todo.Title = req.Title
+		todo.Description = req.Description
+		todo.Priority = req.Priority
+		todo.DueDate = toUTC(req.DueDate)
+		if req.Completed && !todo.Completed {
+			now := time.Now()
+			todo.CompletedAt = &now
+		} else if !req.Completed {
+			todo.CompletedAt = nil
+		}
+		todo.Completed = req.Completed
+
+		action := models.AuditActionTodoUpdated
+		if created {
+			action = models.AuditActionTodoCreated
+		}
+		entry, err := versionEntry(userID, action, todo)
+		if err != nil {
+			return nil, err
+		}
+		// The existing todo comes with its tags, so this doesn't query
+		return s.completionWrites(ctx, userID, todo, wasCompleted, entry)
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, false, ErrExternalIDConflict
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	response, err := s.toResponse(ctx, userID, todo)
+	return response, created, err
 }
 
 // List retrieves paginated todos for a user
-func (s *TodoService) List(userID uint, page, perPage int, completed *bool) (*models.TodoListResponse, error) {
-	// Apply defaults
-	if page < 1 {
-		page = 1
+func (s *TodoService) List(ctx context.Context, userID uint, opts models.TodoListOptions) (*models.TodoListResponse, error) {
+	// Offset/limit requests are validated strictly and reported as the page
+	// containing the offset; page requests fall back to defaults
+	defaultPerPage, maxPerPage := s.cfg.PageSizes()
+	if opts.Offset != nil {
+		if *opts.Offset < 0 {
+			return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidListOptions)
+		}
+		if opts.PerPage < 1 || opts.PerPage > maxPerPage {
+			return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidListOptions, maxPerPage)
+		}
+		opts.Page = *opts.Offset/opts.PerPage + 1
+	} else {
+		if opts.Page < 1 {
+			opts.Page = 1
+		}
+		if opts.PerPage < 1 || opts.PerPage > maxPerPage {
+			opts.PerPage = defaultPerPage
+		}
+		offset := (opts.Page - 1) * opts.PerPage
+		opts.Offset = &offset
+	}
+	// Client sort params win over the configured defaults
+	opts.Sort = cmp.Or(opts.Sort, s.cfg.DefaultSort, "created_at")
+	opts.Order = cmp.Or(opts.Order, s.cfg.DefaultOrder, "desc")
+
+	if !slices.Contains(models.TodoSortFields, opts.Sort) {
+		return nil, fmt.Errorf("%w: sort must be one of %s", ErrInvalidListOptions, strings.Join(models.TodoSortFields, ", "))
 	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 10
+	if opts.Order != "asc" && opts.Order != "desc" {
+		return nil, fmt.Errorf("%w: order must be asc or desc", ErrInvalidListOptions)
+	}
+	if opts.Color != "" {
+		if !models.ValidColor(opts.Color) {
+			return nil, fmt.Errorf("%w: color must be a hex code or one of %s", ErrInvalidListOptions, strings.Join(models.TodoColors, ", "))
+		}
+		opts.Color = models.NormalizeColor(opts.Color)
+	}
+	opts.DueAfter = toUTC(opts.DueAfter)
+	opts.DueBefore = toUTC(opts.DueBefore)
+	if opts.DueAfter != nil && opts.DueBefore != nil && opts.DueAfter.After(*opts.DueBefore) {
+		return nil, fmt.Errorf("%w: due_after must not be later than due_before", ErrInvalidListOptions)
+	}
+	opts.Tag = models.NormalizeTag(opts.Tag)
+	opts.Search = strings.TrimSpace(opts.Search)
+	if len(opts.Search) > maxSearchLength {
+		return nil, fmt.Errorf("%w: search must be at most %d characters", ErrInvalidListOptions, maxSearchLength)
 	}
 
-	return s.todoRepo.ListByUserID(userID, page, perPage, completed)
+	if opts.Search != "" {
+		opts.MaxResults = s.cfg.SearchMaxResults
+	}
+
+	result, err := s.todoRepo.ListByUserID(ctx, userID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	threshold, err := s.dueSoonThreshold(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range result.Todos {
+		result.Todos[i].MarkDueSoon(threshold, now)
+	}
+	return result, nil
 }
 
-// Update updates a todo
-func (s *TodoService) Update(todoID, userID uint, req *models.UpdateTodoRequest) (*models.TodoResponse, error) {
-	// Find todo with ownership check
-	todo, err := s.todoRepo.FindByIDAndUserID(todoID, userID)
+// Tree returns a user's todos with subtasks nested under their parents, down
+// to depth levels (capped at MaxTreeDepth). Subtasks whose parent is gone are
+// shown at the top level.
+func (s *TodoService) Tree(ctx context.Context, userID uint, depth int) ([]models.TodoTreeNode, error) {
+	if depth < 1 || depth > MaxTreeDepth {
+		depth = MaxTreeDepth
+	}
+
+	todos, err := s.todoRepo.ListAllByUserID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	if todo == nil {
-		return nil, errors.New("todo not found")
+
+	threshold, err := s.dueSoonThreshold(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	ids := make(map[uint]bool, len(todos))
+	for _, todo := range todos {
+		ids[todo.ID] = true
+	}
+	children := make(map[uint][]models.Todo)
+	var roots []models.Todo
+	for _, todo := range todos {
+		if todo.ParentID != nil && ids[*todo.ParentID] {
+			children[*todo.ParentID] = append(children[*todo.ParentID], todo)
+		} else {
+			roots = append(roots, todo)
+		}
+	}
+
+	var build func(todos []models.Todo, level int) []models.TodoTreeNode
+	build = func(todos []models.Todo, level int) []models.TodoTreeNode {
+		nodes := make([]models.TodoTreeNode, len(todos))
+		for i, todo := range todos {
+			nodes[i] = models.TodoTreeNode{TodoResponse: todo.ToResponse(), Subtasks: []models.TodoTreeNode{}}
+			nodes[i].MarkDueSoon(threshold, now)
+			if subtasks := children[todo.ID]; len(subtasks) > 0 {
+				if level < depth {
+					nodes[i].Subtasks = build(subtasks, level+1)
+				} else {
+					nodes[i].Truncated = true
+				}
+			}
+		}
+		return nodes
+	}
+
+	return build(roots, 1), nil
+}
+
+// Update updates a todo. When unmodifiedSince is set, the update is rejected
+// with ErrTodoModified if the todo changed after that time.
+func (s *TodoService) Update(ctx context.Context, todoID, userID uint, req *models.UpdateTodoRequest, unmodifiedSince *time.Time) (*models.TodoResponse, error) {
+	todo, err := s.getOwnedTodo(ctx, todoID, userID)
+	if err != nil {
+		return nil, err
 	}
 
+	// HTTP dates have second precision
+	if unmodifiedSince != nil && todo.UpdatedAt.Truncate(time.Second).After(*unmodifiedSince) {
+		return nil, ErrTodoModified
+	}
+
+	if err := validateUpdate(req); err != nil {
+		return nil, err
+	}
+
+	wasCompleted := todo.Completed
+
 	// Apply updates
 	if req.Title != nil {
 		todo.Title = *req.Title
@@ -88,52 +447,579 @@ func (s *TodoService) Update(todoID, userID uint, req *models.UpdateTodoRequest)
 		todo.Description = *req.Description
 	}
 	if req.Completed != nil {
+		if *req.Completed && !todo.Completed {
+			now := time.Now()
+			todo.CompletedAt = &now
+		} else if !*req.Completed {
+			todo.CompletedAt = nil
+		}
 		todo.Completed = *req.Completed
 	}
 	if req.Priority != nil {
 		todo.Priority = *req.Priority
 	}
 	if req.DueDate != nil {
-		todo.DueDate = req.DueDate
+		todo.DueDate = toUTC(req.DueDate)
+	}
+	if req.RemindAt != nil {
+		// A new reminder time gets a new reminder
+		todo.RemindAt = toUTC(req.RemindAt)
+		todo.RemindedAt = nil
+	}
+	if req.Color != nil {
+		todo.Color = models.NormalizeColor(*req.Color)
+	}
+	if req.Recurrence != nil {
+		todo.Recurrence = *req.Recurrence
+	}
+	if req.Tags != nil {
+		// Non-nil even when empty, so saving clears the todo's tags
+		todo.Tags = models.NewTags(userID, models.NormalizeTags(*req.Tags))
+	}
+	// Checked against the merged state, so moving the due date before an
+	// existing reminder is rejected too
+	if !todo.ValidReminder() {
+		return nil, ErrInvalidReminder
 	}
 
-	if err := s.todoRepo.Update(todo); err != nil {
+	entry, err := versionEntry(userID, models.AuditActionTodoUpdated, todo)
+	if err != nil {
+		return nil, err
+	}
+	writes, err := s.completionWrites(ctx, userID, todo, wasCompleted, entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.todoRepo.SaveAllWithAudit(ctx, writes); err != nil {
 		return nil, err
 	}
 
-	response := todo.ToResponse()
-	return &response, nil
+	return s.toResponse(ctx, userID, todo)
+}
+
+// completionWrites returns the writes saving a changed todo with its audit
+// entry and, when the change completes a recurring todo, creating its next
+// occurrence. The todo's tags are loaded for the copy unless already set.
+func (s *TodoService) completionWrites(ctx context.Context, userID uint, todo *models.Todo, wasCompleted bool, entry *models.AuditLog) ([]repository.TodoWrite, error) {
+	writes := []repository.TodoWrite{{Todo: todo, Entry: entry}}
+	if !todo.Completed || wasCompleted || todo.Recurrence == "" {
+		return writes, nil
+	}
+
+	if todo.Tags == nil {
+		tags, err := s.todoRepo.ListTags(ctx, todo.ID)
+		if err != nil {
+			return nil, err
+		}
+		todo.Tags = tags
+	}
+	next := todo.NextOccurrence()
+	nextEntry, err := versionEntry(userID, models.AuditActionTodoCreated, next)
+	if err != nil {
+		return nil, err
+	}
+	return append(writes, repository.TodoWrite{Todo: next, Entry: nextEntry}), nil
+}
+
+// SetArchived archives or unarchives a user's todo. Setting the state the
+// todo already has changes nothing.
+func (s *TodoService) SetArchived(ctx context.Context, todoID, userID uint, archived bool) (*models.TodoResponse, error) {
+	todo, err := s.getOwnedTodo(ctx, todoID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if todo.Archived != archived {
+		todo.Archived = archived
+		entry, err := versionEntry(userID, models.AuditActionTodoUpdated, todo)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.todoRepo.SaveWithAudit(ctx, todo, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.toResponse(ctx, userID, todo)
+}
+
+// validateUpdate checks the fields an update sets, so requests that didn't
+// go through binding can't store a blank or oversized title
+func validateUpdate(req *models.UpdateTodoRequest) error {
+	if req.Title != nil {
+		if strings.TrimSpace(*req.Title) == "" {
+			return fmt.Errorf("%w: title must not be empty", ErrInvalidTodo)
+		}
+		if utf8.RuneCountInString(*req.Title) > models.MaxTitleLength {
+			return fmt.Errorf("%w: title must be at most %d characters", ErrInvalidTodo, models.MaxTitleLength)
+		}
+	}
+	if req.Description != nil && utf8.RuneCountInString(*req.Description) > models.MaxDescriptionLength {
+		return fmt.Errorf("%w: description must be at most %d characters", ErrInvalidTodo, models.MaxDescriptionLength)
+	}
+	if req.Priority != nil && !slices.Contains(models.TodoPriorities, *req.Priority) {
+		return fmt.Errorf("%w: priority must be one of %s", ErrInvalidTodo, strings.Join(models.TodoPriorities, ", "))
+	}
+	return nil
+}
+
+// History returns the recorded versions of a user's todo, oldest first
+func (s *TodoService) History(ctx context.Context, todoID, userID uint) ([]models.TodoHistoryEntry, error) {
+	if _, err := s.getOwnedTodo(ctx, todoID, userID); err != nil {
+		return nil, err
+	}
+
+	entries, err := s.todoRepo.ListVersions(ctx, todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]models.TodoHistoryEntry, len(entries))
+	for i, entry := range entries {
+		history[i] = models.TodoHistoryEntry{
+			ID:        entry.ID,
+			Action:    entry.Action,
+			ActorID:   entry.ActorID,
+			CreatedAt: models.NewTimestamp(entry.CreatedAt),
+		}
+		if err := json.Unmarshal([]byte(entry.Details), &history[i].State); err != nil {
+			return nil, err
+		}
+	}
+	return history, nil
 }
 
-// Delete removes a todo
-func (s *TodoService) Delete(todoID, userID uint) error {
-	// Verify ownership before delete
-	todo, err := s.todoRepo.FindByIDAndUserID(todoID, userID)
+// VersionDiff returns the fields that differ between two recorded versions
+// of a user's todo, identified by their audit entry IDs
+func (s *TodoService) VersionDiff(ctx context.Context, todoID, userID, fromID, toID uint) (*models.TodoVersionDiff, error) {
+	if _, err := s.getOwnedTodo(ctx, todoID, userID); err != nil {
+		return nil, err
+	}
+
+	var states [2]map[string]interface{}
+	for i, auditID := range []uint{fromID, toID} {
+		entry, err := s.todoRepo.FindVersion(ctx, todoID, auditID)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("%w: audit entry %d", ErrVersionNotFound, auditID)
+		}
+		if err := json.Unmarshal([]byte(entry.Details), &states[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	diff := &models.TodoVersionDiff{TodoID: todoID, From: fromID, To: toID, Changes: []models.FieldChange{}}
+	from, to := states[0], states[1]
+	fields := slices.Sorted(maps.Keys(to))
+	for _, field := range fields {
+		if !reflect.DeepEqual(from[field], to[field]) {
+			diff.Changes = append(diff.Changes, models.FieldChange{Field: field, From: from[field], To: to[field]})
+		}
+	}
+	return diff, nil
+}
+
+// versionEntry builds the audit entry recording a todo's state after a change
+func versionEntry(actorID uint, action string, todo *models.Todo) (*models.AuditLog, error) {
+	details, err := json.Marshal(todo.Version())
 	if err != nil {
+		return nil, err
+	}
+	return &models.AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		EntityType: "todo",
+		Details:    string(details),
+	}, nil
+}
+
+// Delete removes a todo. Todos are soft-deleted unless hard deletes are
+// configured, in which case they are removed permanently.
+func (s *TodoService) Delete(ctx context.Context, todoID, userID uint) error {
+	if _, err := s.getOwnedTodo(ctx, todoID, userID); err != nil {
 		return err
 	}
-	if todo == nil {
-		return errors.New("todo not found")
+
+	if s.cfg.HardDeleteTodos {
+		return s.todoRepo.HardDelete(ctx, todoID)
 	}
+	return s.todoRepo.Delete(ctx, todoID)
+}
 
-	return s.todoRepo.Delete(todoID)
+// Restore brings back one of the user's soft-deleted todos. Todos that
+// aren't deleted, or were deleted permanently, are not found.
+func (s *TodoService) Restore(ctx context.Context, todoID, userID uint) (*models.TodoResponse, error) {
+	todo, err := s.todoRepo.Unscoped().FindByIDAndUserID(ctx, todoID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil || !todo.DeletedAt.Valid {
+		return nil, ErrTodoNotFound
+	}
+	entry, err := versionEntry(userID, models.AuditActionTodoUpdated, todo)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.todoRepo.Restore(ctx, todoID, userID, entry); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTodoNotFound
+		}
+		// Its external ID may have been reused since it was deleted
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrExternalIDConflict
+		}
+		return nil, err
+	}
+	return s.GetByID(ctx, todoID, userID)
 }
 
-// GetStats returns todo statistics for a user
-func (s *TodoService) GetStats(userID uint) (map[string]int64, error) {
-	total, err := s.todoRepo.CountByUserID(userID)
+// Usage reports how much a user stores, for quota enforcement
+func (s *TodoService) Usage(ctx context.Context, userID uint) (*models.UsageResponse, error) {
+	return s.todoRepo.UsageByUserID(ctx, userID)
+}
+
+// ClearCompleted deletes all of a user's completed todos, honoring the
+// configured delete mode, and reports how many were removed
+func (s *TodoService) ClearCompleted(ctx context.Context, userID uint) (*models.BulkDeleteResponse, error) {
+	deleted, err := s.todoRepo.DeleteCompletedByUserID(ctx, userID, s.cfg.HardDeleteTodos)
 	if err != nil {
 		return nil, err
 	}
+	return &models.BulkDeleteResponse{Deleted: deleted}, nil
+}
 
-	completed, err := s.todoRepo.CountCompletedByUserID(userID)
+// BulkDelete deletes a batch of the user's todos; IDs the user doesn't own
+// are skipped
+func (s *TodoService) BulkDelete(ctx context.Context, userID uint, ids []uint) (*models.BulkDeleteResponse, error) {
+	deleted, err := s.todoRepo.DeleteByIDsAndUserID(ctx, userID, ids, s.cfg.HardDeleteTodos)
 	if err != nil {
 		return nil, err
 	}
+	return &models.BulkDeleteResponse{Deleted: deleted}, nil
+}
 
-	return map[string]int64{
-		"total":     total,
-		"completed": completed,
-		"pending":   total - completed,
-	}, nil
+// GetStats returns todo statistics for a user. metrics selects which
+// statistics to compute (see models.StatsMetrics); nil or empty means all.
+// Only the queries needed for the requested metrics are run. Soft-deleted
+// todos are counted when includeDeleted is set.
+func (s *TodoService) GetStats(ctx context.Context, userID uint, metrics []string, includeDeleted bool) (map[string]interface{}, error) {
+	if len(metrics) == 0 {
+		metrics = models.StatsMetrics
+	}
+	for _, metric := range metrics {
+		if !slices.Contains(models.StatsMetrics, metric) {
+			return nil, fmt.Errorf("%w: metrics must be among %s", ErrInvalidStatsMetrics, strings.Join(models.StatsMetrics, ", "))
+		}
+	}
+
+	todoRepo := s.todoRepo
+	if includeDeleted {
+		todoRepo = todoRepo.Unscoped()
+	}
+
+	// Counts shared by several metrics are queried at most once
+	var total, completed *int64
+	count := func(cached **int64, query func(context.Context, uint) (int64, error)) (int64, error) {
+		if *cached == nil {
+			n, err := query(ctx, userID)
+			if err != nil {
+				return 0, err
+			}
+			*cached = &n
+		}
+		return **cached, nil
+	}
+
+	stats := make(map[string]interface{}, len(metrics))
+	for _, metric := range metrics {
+		switch metric {
+		case "total":
+			n, err := count(&total, todoRepo.CountByUserID)
+			if err != nil {
+				return nil, err
+			}
+			stats[metric] = n
+		case "completed":
+			n, err := count(&completed, todoRepo.CountCompletedByUserID)
+			if err != nil {
+				return nil, err
+			}
+			stats[metric] = n
+		case "pending":
+			all, err := count(&total, todoRepo.CountByUserID)
+			if err != nil {
+				return nil, err
+			}
+			done, err := count(&completed, todoRepo.CountCompletedByUserID)
+			if err != nil {
+				return nil, err
+			}
+			stats[metric] = all - done
+		case "overdue":
+			n, err := todoRepo.CountOverdueByUserID(ctx, userID, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			stats[metric] = n
+		case "average_completion_time":
+			avgSeconds, err := todoRepo.AverageCompletionSecondsByUserID(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+
+			// Average time to complete, as an ISO 8601 duration (null when nothing is completed)
+			var avgCompletion interface{}
+			if avgSeconds != nil {
+				avgCompletion = utils.FormatISODuration(time.Duration(*avgSeconds * float64(time.Second)))
+			}
+			stats[metric] = avgCompletion
+		case "by_priority":
+			counts, err := todoRepo.CountByPriorityByUserID(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			stats[metric] = counts
+		}
+	}
+
+	return stats, nil
+}
+
+// Calendar returns the user's due-dated todos as iCalendar events
+func (s *TodoService) Calendar(ctx context.Context, userID uint) ([]utils.ICalEvent, error) {
+	todos, err := s.todoRepo.ListWithDueDateByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]utils.ICalEvent, len(todos))
+	for i, todo := range todos {
+		status := "Pending"
+		if todo.Completed {
+			status = "Completed"
+		}
+		events[i] = utils.ICalEvent{
+			UID:         fmt.Sprintf("todo-%d@todo-api", todo.ID),
+			Summary:     todo.Title,
+			Description: todo.Description,
+			Start:       *todo.DueDate,
+			Stamp:       todo.UpdatedAt,
+			Categories:  []string{status},
+		}
+	}
+	return events, nil
+}
+
+// CalendarForFeedToken returns the calendar of the user owning a feed token
+func (s *TodoService) CalendarForFeedToken(ctx context.Context, token string) ([]utils.ICalEvent, error) {
+	user, err := s.userRepo.FindByFeedTokenHash(ctx, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidFeedToken
+	}
+
+	return s.Calendar(ctx, user.ID)
+}
+
+// GetVelocity returns the average number of todos completed per day over the
+// last `days` days, and a projection of how long the pending todos will take
+func (s *TodoService) GetVelocity(ctx context.Context, userID uint, days int) (*models.VelocityResponse, error) {
+	since := time.Now().AddDate(0, 0, -days)
+	completed, err := s.todoRepo.CountCompletedSinceByUserID(ctx, userID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.todoRepo.CountByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	allCompleted, err := s.todoRepo.CountCompletedByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	pending := total - allCompleted
+
+	velocity := &models.VelocityResponse{
+		Days:          days,
+		Completed:     completed,
+		AveragePerDay: float64(completed) / float64(days),
+		Pending:       pending,
+	}
+
+	// Without any completions there is nothing to project from
+	if completed > 0 {
+		projection := float64(pending) / velocity.AveragePerDay
+		velocity.ProjectedDaysToClear = &projection
+	}
+
+	return velocity, nil
+}
+
+// CompletedOnDay returns the todos a user completed on the calendar day of
+// day, in day's location
+func (s *TodoService) CompletedOnDay(ctx context.Context, userID uint, day time.Time) (*models.CompletedTodayResponse, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+
+	todos, err := s.todoRepo.ListCompletedBetweenByUserID(ctx, userID, start.UTC(), end.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	threshold, err := s.dueSoonThreshold(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	response := &models.CompletedTodayResponse{
+		Date:     start.Format(time.DateOnly),
+		Timezone: day.Location().String(),
+		Todos:    make([]models.TodoResponse, len(todos)),
+	}
+	for i := range todos {
+		response.Todos[i] = todos[i].ToResponse()
+		response.Todos[i].MarkDueSoon(threshold, now)
+	}
+	return response, nil
+}
+
+// SetPriority sets the priority of a batch of the user's todos. Todos that
+// already have it are left alone and, as in BulkUpdateCompleted, aren't
+// counted.
+func (s *TodoService) SetPriority(ctx context.Context, userID uint, req *models.BulkPriorityRequest) (*models.BulkUpdateResponse, error) {
+	todos, err := s.todoRepo.ListByIDsAndUserID(ctx, userID, req.IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var writes []repository.TodoWrite
+	for i := range todos {
+		if todos[i].Priority == req.Priority {
+			continue
+		}
+		todos[i].Priority = req.Priority
+		entry, err := versionEntry(userID, models.AuditActionTodoUpdated, &todos[i])
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, repository.TodoWrite{Todo: &todos[i], Entry: entry})
+	}
+	if err := s.todoRepo.SaveAllWithAudit(ctx, writes); err != nil {
+		return nil, err
+	}
+	return &models.BulkUpdateResponse{Updated: int64(len(writes))}, nil
+}
+
+// BulkUpdateCompleted marks a batch of the user's todos completed or not
+// completed; IDs the user doesn't own are skipped. Todos already in that
+// state are left alone, keeping their completion time, and aren't counted.
+func (s *TodoService) BulkUpdateCompleted(ctx context.Context, userID uint, ids []uint, completed bool) (*models.BulkUpdateResponse, error) {
+	todos, err := s.todoRepo.ListByIDsAndUserID(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var writes []repository.TodoWrite
+	var updated int64
+	for i := range todos {
+		todo := &todos[i]
+		if todo.Completed == completed {
+			continue
+		}
+		todo.Completed = completed
+		todo.CompletedAt = nil
+		if completed {
+			todo.CompletedAt = &now
+		}
+		entry, err := versionEntry(userID, models.AuditActionTodoUpdated, todo)
+		if err != nil {
+			return nil, err
+		}
+		// Completed recurring todos schedule their next occurrence, as in Update
+		todoWrites, err := s.completionWrites(ctx, userID, todo, false, entry)
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, todoWrites...)
+		updated++
+	}
+	if err := s.todoRepo.SaveAllWithAudit(ctx, writes); err != nil {
+		return nil, err
+	}
+	return &models.BulkUpdateResponse{Updated: updated}, nil
+}
+
+// Exists reports which of the given todo IDs still exist for a user, so
+// offline clients can prune local copies of deleted todos
+func (s *TodoService) Exists(ctx context.Context, userID uint, ids []uint) (*models.TodoExistsResponse, error) {
+	found, err := s.todoRepo.FindExistingIDsByUserID(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	foundSet := make(map[uint]bool, len(found))
+	for _, id := range found {
+		foundSet[id] = true
+	}
+
+	// Preserve the client's ordering and drop duplicate IDs
+	response := &models.TodoExistsResponse{Existing: []uint{}, Missing: []uint{}}
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if foundSet[id] {
+			response.Existing = append(response.Existing, id)
+		} else {
+			response.Missing = append(response.Missing, id)
+		}
+	}
+
+	return response, nil
+}
+
+// toResponse converts a todo for the API, flagging it if due soon for its owner
+func (s *TodoService) toResponse(ctx context.Context, userID uint, todo *models.Todo) (*models.TodoResponse, error) {
+	threshold, err := s.dueSoonThreshold(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if todo.Tags == nil {
+		if todo.Tags, err = s.todoRepo.ListTags(ctx, todo.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	response := todo.ToResponse()
+	response.MarkDueSoon(threshold, time.Now())
+	return &response, nil
+}
+
+// toUTC normalizes a client-supplied time to UTC, so stored due dates compare
+// consistently regardless of the offset they were sent with
+func toUTC(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// dueSoonThreshold returns the user's due-soon window
+func (s *TodoService) dueSoonThreshold(ctx context.Context, userID uint) (time.Duration, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil || user == nil {
+		return 0, err
+	}
+	return user.DueSoonWindow(), nil
 }
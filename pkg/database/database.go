@@ -22,7 +22,10 @@ func Connect(cfg *config.DatabaseConfig) (*gorm.DB, error) {
 
 	// Use SQLite for development/testing, PostgreSQL for production
 	if cfg.Host == "sqlite" {
-		dialector = sqlite.Open(cfg.DBName + ".db")
+		// Take the write lock when a transaction begins and wait for it, so
+		// concurrent read-then-write transactions queue up instead of
+		// failing with "database is locked"
+		dialector = sqlite.Open(cfg.DBName + ".db?_busy_timeout=5000&_txlock=immediate")
 		log.Println("📦 Using SQLite database")
 	} else {
 		dialector = postgres.Open(cfg.DSN())
@@ -31,6 +34,8 @@ func Connect(cfg *config.DatabaseConfig) (*gorm.DB, error) {
 
 	gormConfig := &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
+		// Surface unique violations as gorm.ErrDuplicatedKey on every dialect
+		TranslateError: true,
 	}
 
 	db, err := gorm.Open(dialector, gormConfig)
@@ -38,6 +43,13 @@ func Connect(cfg *config.DatabaseConfig) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// Count queries per request when debugging
+	if cfg.CountQueries {
+		if err := RegisterQueryCounter(db); err != nil {
+			return nil, fmt.Errorf("failed to register query counter: %w", err)
+		}
+	}
+
 	// Configure connection pool
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -59,18 +71,109 @@ func Connect(cfg *config.DatabaseConfig) (*gorm.DB, error) {
 func Migrate(db *gorm.DB) error {
 	log.Println("🔄 Running database migrations...")
 	
+	// Link todos and tags through TodoTag so the join table gets its index
+	if err := db.SetupJoinTable(&models.Todo{}, "Tags", &models.TodoTag{}); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Todo{},
+		&models.AuditLog{},
+		&models.APIKey{},
+		&models.Tag{},
+		&models.TodoTag{},
+		&models.TodoTombstone{},
 	)
 	if err != nil {
 		return fmt.Errorf("migration failed: %w", err)
 	}
 
+	// External IDs are unique per user among undeleted todos only, so a
+	// deleted todo's ID can be used again. Earlier versions indexed every row.
+	for _, stmt := range []string{
+		"DROP INDEX IF EXISTS idx_todos_user_external_id",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_user_external_id_live ON todos (user_id, external_id) WHERE deleted_at IS NULL",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+
+	// Prefix searches on lower(email) need a pattern-ops index in Postgres,
+	// since the default collation cannot serve LIKE 'x%' from a btree
+	if db.Dialector.Name() == "postgres" {
+		err = db.Exec("CREATE INDEX IF NOT EXISTS idx_users_email_lower_prefix ON users (LOWER(email) text_pattern_ops)").Error
+		if err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+
 	log.Println("✅ Database migration completed")
 	return nil
 }
 
+// NormalizeEmails rewrites stored emails with models.NormalizeEmail, for
+// accounts registered before emails were normalized on the way in. It fails
+// without changing anything if two users, deleted ones included, would end
+// up with the same email.
+func NormalizeEmails(db *gorm.DB) error {
+	var users []models.User
+	if err := db.Unscoped().Select("id", "email").Order("id").Find(&users).Error; err != nil {
+		return fmt.Errorf("failed to normalize emails: %w", err)
+	}
+
+	owners := make(map[string]uint, len(users))
+	changed := make(map[uint]string)
+	for _, user := range users {
+		email := models.NormalizeEmail(user.Email)
+		if owner, ok := owners[email]; ok {
+			return fmt.Errorf("failed to normalize emails: users %d and %d both have %q; merge or rename one first", owner, user.ID, email)
+		}
+		owners[email] = user.ID
+		if email != user.Email {
+			changed[user.ID] = email
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for id, email := range changed {
+			if err := tx.Unscoped().Model(&models.User{}).Where("id = ?", id).UpdateColumn("email", email).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to normalize emails: %w", err)
+	}
+	log.Printf("✅ Normalized %d stored emails", len(changed))
+	return nil
+}
+
+// ApplyExternalIDScope adds a unique index on the external_id of undeleted
+// todos in the global scope, on top of the per-user one from Migrate, and
+// drops it again in the user scope. Switching to global fails while two users
+// share an external ID.
+func ApplyExternalIDScope(db *gorm.DB, scope string) error {
+	// Earlier versions indexed deleted todos too, under another name
+	stmts := []string{"DROP INDEX IF EXISTS idx_todos_external_id"}
+	if scope == models.ExternalIDScopeGlobal {
+		stmts = append(stmts, "CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_external_id_live ON todos (external_id) WHERE deleted_at IS NULL")
+	} else {
+		stmts = append(stmts, "DROP INDEX IF EXISTS idx_todos_external_id_live")
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to apply external ID scope %q: %w", scope, err)
+		}
+	}
+	return nil
+}
+
 // Close closes the database connection
 func Close(db *gorm.DB) error {
 	sqlDB, err := db.DB()
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// QueryCounter counts the database queries issued on behalf of one request
+type QueryCounter struct {
+	count atomic.Int64
+}
+
+// Count returns the number of queries recorded so far
+func (q *QueryCounter) Count() int64 {
+	return q.count.Load()
+}
+
+type queryCounterKey struct{}
+
+// WithQueryCounter returns a context carrying a fresh QueryCounter. Queries
+// run with this context (via db.WithContext) are counted once
+// RegisterQueryCounter has been installed.
+func WithQueryCounter(ctx context.Context) (context.Context, *QueryCounter) {
+	counter := &QueryCounter{}
+	return context.WithValue(ctx, queryCounterKey{}, counter), counter
+}
+
+// QueryCounterFromContext returns the context's QueryCounter, or nil
+func QueryCounterFromContext(ctx context.Context) *QueryCounter {
+	counter, _ := ctx.Value(queryCounterKey{}).(*QueryCounter)
+	return counter
+}
+
+// RegisterQueryCounter installs GORM callbacks that increment the
+// QueryCounter found in each statement's context
+func RegisterQueryCounter(db *gorm.DB) error {
+	count := func(tx *gorm.DB) {
+		if tx.Statement.Context == nil {
+			return
+		}
+		if counter := QueryCounterFromContext(tx.Statement.Context); counter != nil {
+			counter.count.Add(1)
+		}
+	}
+
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("query_counter:create", count); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("gorm:query").Register("query_counter:query", count); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("query_counter:update", count); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("query_counter:delete", count); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:row").Register("query_counter:row", count); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("query_counter:raw", count)
+}
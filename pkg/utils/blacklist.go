@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBlacklist remembers revoked token IDs (jti), and per-user cutoffs
+// before which all of a user's tokens are revoked, until the tokens could no
+// longer be used anyway. It is in-memory, so revocations only apply to the
+// instance that recorded them and are lost on restart.
+type TokenBlacklist struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+	users   map[uint]userCutoff
+}
+
+// userCutoff revokes a user's tokens issued before a time, until a later one
+type userCutoff struct {
+	before time.Time
+	until  time.Time
+}
+
+// NewTokenBlacklist creates an empty blacklist that prunes expired entries
+// every interval
+func NewTokenBlacklist(interval time.Duration) *TokenBlacklist {
+	b := &TokenBlacklist{
+		entries: make(map[string]time.Time),
+		users:   make(map[uint]userCutoff),
+	}
+
+	// Start cleanup goroutine
+	go b.cleanup(interval)
+
+	return b
+}
+
+// Add blacklists a token ID until the given time
+func (b *TokenBlacklist) Add(id string, until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if existing, ok := b.entries[id]; !ok || until.After(existing) {
+		b.entries[id] = until
+	}
+}
+
+// AddOnce blacklists a token ID until the given time, reporting false if it
+// was already blacklisted
+func (b *TokenBlacklist) AddOnce(id string, until time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if existing, ok := b.entries[id]; ok && time.Now().Before(existing) {
+		return false
+	}
+	b.entries[id] = until
+	return true
+}
+
+// Contains reports whether a token ID is blacklisted
+func (b *TokenBlacklist) Contains(id string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	until, ok := b.entries[id]
+	return ok && time.Now().Before(until)
+}
+
+// AddUser blacklists every token issued to a user before the given time,
+// until the given time
+func (b *TokenBlacklist) AddUser(userID uint, before, until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cutoff := b.users[userID]
+	if before.After(cutoff.before) {
+		cutoff.before = before
+	}
+	if until.After(cutoff.until) {
+		cutoff.until = until
+	}
+	b.users[userID] = cutoff
+}
+
+// ContainsUser reports whether a token issued to a user at issuedAt is
+// blacklisted by a cutoff
+func (b *TokenBlacklist) ContainsUser(userID uint, issuedAt time.Time) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	cutoff, ok := b.users[userID]
+	return ok && time.Now().Before(cutoff.until) && issuedAt.Before(cutoff.before)
+}
+
+// Len returns the number of entries and user cutoffs, including expired ones
+// not yet pruned
+func (b *TokenBlacklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.entries) + len(b.users)
+}
+
+// Prune removes entries that expired by now and returns how many it removed
+func (b *TokenBlacklist) Prune(now time.Time) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pruned := 0
+	for id, until := range b.entries {
+		if !now.Before(until) {
+			delete(b.entries, id)
+			pruned++
+		}
+	}
+	for userID, cutoff := range b.users {
+		if !now.Before(cutoff.until) {
+			delete(b.users, userID)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// cleanup periodically removes expired entries
+func (b *TokenBlacklist) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		b.Prune(now)
+	}
+}
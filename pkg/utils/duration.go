@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FormatISODuration formats a duration as an ISO 8601 duration such as
+// "P1DT2H30M". Days are nominal 24 hour days and the result is rounded to
+// whole seconds.
+func FormatISODuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d == 0 {
+		return "PT0S"
+	}
+
+	var b strings.Builder
+	if d < 0 {
+		b.WriteByte('-')
+		d = -d
+	}
+	b.WriteByte('P')
+
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+
+	if days > 0 {
+		fmt.Fprintf(&b, "%dD", days)
+	}
+	if hours > 0 || minutes > 0 || seconds > 0 {
+		b.WriteByte('T')
+	}
+	if hours > 0 {
+		fmt.Fprintf(&b, "%dH", hours)
+	}
+	if minutes > 0 {
+		fmt.Fprintf(&b, "%dM", minutes)
+	}
+	if seconds > 0 {
+		fmt.Fprintf(&b, "%dS", seconds)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// ICalEvent is a single VEVENT in an iCalendar feed
+type ICalEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	Stamp       time.Time
+	Categories  []string
+}
+
+// icalTimeFormat is the UTC date-time form used by iCalendar (RFC 5545 3.3.5)
+const icalTimeFormat = "20060102T150405Z"
+
+// icalEscaper escapes TEXT values (RFC 5545 3.3.11)
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// WriteICalendar writes a VCALENDAR containing events to w
+func WriteICalendar(w io.Writer, prodID, name string, events []ICalEvent) error {
+	bw := bufio.NewWriter(w)
+	line := func(s string) { writeFolded(bw, s) }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:" + prodID)
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + icalEscaper.Replace(name))
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + event.UID)
+		line("DTSTAMP:" + event.Stamp.UTC().Format(icalTimeFormat))
+		line("DTSTART:" + event.Start.UTC().Format(icalTimeFormat))
+		line("SUMMARY:" + icalEscaper.Replace(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION:" + icalEscaper.Replace(event.Description))
+		}
+		if len(event.Categories) > 0 {
+			categories := make([]string, len(event.Categories))
+			for i, category := range event.Categories {
+				categories[i] = icalEscaper.Replace(category)
+			}
+			line("CATEGORIES:" + strings.Join(categories, ","))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	return bw.Flush()
+}
+
+// writeFolded writes a content line terminated by CRLF, folding it so no
+// physical line exceeds 75 octets without splitting a UTF-8 sequence
+func writeFolded(w *bufio.Writer, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// isRuneStart reports whether b begins a UTF-8 sequence
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTooManyItems is returned when a streamed JSON array exceeds its limit
+var ErrTooManyItems = errors.New("too many items")
+
+// DecodeJSONArray streams a JSON array from r, decoding one element at a
+// time and passing it to fn. Decoding stops with ErrTooManyItems as soon as
+// element maxItems+1 is reached, without reading the rest of the payload.
+func DecodeJSONArray[T any](r io.Reader, maxItems int, fn func(index int, item T) error) error {
+	dec := json.NewDecoder(r)
+
+	token, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New("expected a JSON array")
+	}
+
+	for i := 0; dec.More(); i++ {
+		if i >= maxItems {
+			return ErrTooManyItems
+		}
+
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return fmt.Errorf("item %d: %w", i, err)
+		}
+		if err := fn(i, item); err != nil {
+			return err
+		}
+	}
+
+	// Consume the closing bracket
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package utils
 
 import (
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,52 +14,173 @@ import (
 type JWTClaims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
+	// IssuedAtNanos is iat in Unix nanoseconds, since iat itself only holds
+	// whole seconds; zero in tokens issued before it was added
+	IssuedAtNanos int64 `json:"iat_ns,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// DefaultJWTAlgorithm is the signing algorithm used by NewJWTManager
+const DefaultJWTAlgorithm = "HS256"
+
+// JWTAlgorithms lists the supported HMAC signing algorithms
+var JWTAlgorithms = []string{"HS256", "HS384", "HS512"}
+
+// ErrUnsupportedAlgorithm is returned when signing with an algorithm outside JWTAlgorithms
+var ErrUnsupportedAlgorithm = errors.New("unsupported JWT signing algorithm")
+
+// ErrIssuerMismatch is returned when a token's issuer is not the manager's
+var ErrIssuerMismatch = errors.New("token issuer does not match")
+
+// ErrUnknownAudience is returned when issuing a token for an audience the
+// manager doesn't accept
+var ErrUnknownAudience = errors.New("unknown token audience")
+
+// ErrAudienceMismatch is returned when a token's audience is not one the
+// manager accepts, while an audience is required
+var ErrAudienceMismatch = errors.New("token audience is not accepted")
+
+// ErrTokenRevoked is returned when validating a token that was logged out,
+// or issued before its user's tokens were revoked
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// ErrTokenNotRevocable is returned when revoking a token without an ID, or
+// with a manager that has no blacklist
+var ErrTokenNotRevocable = errors.New("token cannot be revoked")
+
 // JWTManager handles JWT token operations
 type JWTManager struct {
 	secret []byte
 	expiry time.Duration
 	issuer string
+	method jwt.SigningMethod // nil when the configured algorithm is unsupported
+
+	blacklist *TokenBlacklist // nil disables revocation
+
+	// audiences are the clients tokens may be issued for; with
+	// requireAudience, tokens must be for one of them
+	audiences       []string
+	requireAudience bool
 }
 
-// NewJWTManager creates a new JWT manager
+// NewJWTManager creates a new JWT manager signing with HS256
 func NewJWTManager(secret string, expiry time.Duration, issuer string) *JWTManager {
+	return NewJWTManagerWithAlgorithm(secret, expiry, issuer, DefaultJWTAlgorithm)
+}
+
+// NewJWTManagerWithAlgorithm creates a JWT manager that signs with, and only
+// accepts, the given algorithm. An unsupported algorithm fails closed: token
+// generation returns ErrUnsupportedAlgorithm and every token is rejected.
+// The issuer is trimmed of surrounding whitespace; when non-empty, tokens
+// must carry exactly that issuer.
+func NewJWTManagerWithAlgorithm(secret string, expiry time.Duration, issuer, algorithm string) *JWTManager {
+	var method jwt.SigningMethod
+	if slices.Contains(JWTAlgorithms, algorithm) {
+		method = jwt.GetSigningMethod(algorithm)
+	}
+
 	return &JWTManager{
 		secret: []byte(secret),
 		expiry: expiry,
-		issuer: issuer,
+		issuer: strings.TrimSpace(issuer),
+		method: method,
 	}
 }
 
+// UseBlacklist makes the manager reject tokens revoked into blacklist
+func (j *JWTManager) UseBlacklist(blacklist *TokenBlacklist) {
+	j.blacklist = blacklist
+}
+
+// UseAudiences lets tokens be issued for any of audiences (client IDs).
+// When require is set, only tokens issued for one of them are accepted.
+func (j *JWTManager) UseAudiences(audiences []string, require bool) {
+	j.audiences = audiences
+	j.requireAudience = require
+}
+
+// AcceptsAudience reports whether tokens may be issued for audience
+func (j *JWTManager) AcceptsAudience(audience string) bool {
+	return slices.Contains(j.audiences, audience)
+}
+
+// RequiresAudience reports whether only tokens scoped to an audience are
+// accepted
+func (j *JWTManager) RequiresAudience() bool {
+	return j.requireAudience
+}
+
 // GenerateToken creates a new JWT token for a user
 func (j *JWTManager) GenerateToken(userID uint, email string) (string, error) {
+	return j.GenerateTokenForAudience(userID, email, "")
+}
+
+// GenerateTokenForAudience creates a JWT token for a user scoped to the
+// given audience, which must be one of the manager's audiences. An empty
+// audience issues an unscoped token.
+func (j *JWTManager) GenerateTokenForAudience(userID uint, email, audience string) (string, error) {
+	if j.method == nil {
+		return "", ErrUnsupportedAlgorithm
+	}
+
+	var aud jwt.ClaimStrings
+	if audience != "" {
+		if !j.AcceptsAudience(audience) {
+			return "", fmt.Errorf("%w %q", ErrUnknownAudience, audience)
+		}
+		aud = jwt.ClaimStrings{audience}
+	}
+
+	// A unique ID lets the token be revoked on its own
+	id, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := JWTClaims{
-		UserID: userID,
-		Email:  email,
+		UserID:        userID,
+		Email:         email,
+		IssuedAtNanos: now.UnixNano(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.expiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.expiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    j.issuer,
+			Audience:  aud,
+			ID:        id,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(j.method, claims)
 	return token.SignedString(j.secret)
 }
 
 // ValidateToken validates a JWT token and returns the claims
 func (j *JWTManager) ValidateToken(tokenString string) (*JWTClaims, error) {
+	return j.ValidateTokenWithLeeway(tokenString, 0)
+}
+
+// ValidateTokenWithLeeway validates a JWT token like ValidateToken, but also
+// accepts tokens that expired less than leeway ago
+func (j *JWTManager) ValidateTokenWithLeeway(tokenString string, leeway time.Duration) (*JWTClaims, error) {
+	if j.method == nil {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	// Pin the exact algorithm so a token signed with another HMAC variant
+	// (or "none") is rejected even though the key would verify it
+	parserOptions := []jwt.ParserOption{jwt.WithValidMethods([]string{j.method.Alg()}), jwt.WithLeeway(leeway)}
+	if j.issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(j.issuer))
+	}
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
 		return j.secret, nil
-	})
+	}, parserOptions...)
 
+	if errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+		return nil, fmt.Errorf("%w: expected %q", ErrIssuerMismatch, j.issuer)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -66,10 +190,71 @@ func (j *JWTManager) ValidateToken(tokenString string) (*JWTClaims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	if j.requireAudience && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(j.audiences, aud)
+	}) {
+		return nil, ErrAudienceMismatch
+	}
+
+	if j.blacklist != nil && claims.ID != "" && j.blacklist.Contains(claims.ID) {
+		return nil, ErrTokenRevoked
+	}
+
+	// A token without iat can't prove it postdates a user cutoff, and one
+	// with whole seconds only is revoked with the second the cutoff falls in
+	var issuedAt time.Time
+	if claims.IssuedAtNanos != 0 {
+		issuedAt = time.Unix(0, claims.IssuedAtNanos)
+	} else if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	if j.blacklist != nil && j.blacklist.ContainsUser(claims.UserID, issuedAt) {
+		return nil, ErrTokenRevoked
+	}
+
 	return claims, nil
 }
 
-// RefreshToken generates a new token with extended expiry
+// Revoke blacklists a token until the given time, which should be no earlier
+// than the last moment the token would otherwise be accepted
+func (j *JWTManager) Revoke(claims *JWTClaims, until time.Time) error {
+	if j.blacklist == nil || claims.ID == "" {
+		return ErrTokenNotRevocable
+	}
+	j.blacklist.Add(claims.ID, until)
+	return nil
+}
+
+// Consume revokes a token like Revoke, but fails with ErrTokenRevoked if it
+// already was, so that only one caller can exchange a token
+func (j *JWTManager) Consume(claims *JWTClaims, until time.Time) error {
+	if j.blacklist == nil || claims.ID == "" {
+		return ErrTokenNotRevocable
+	}
+	if !j.blacklist.AddOnce(claims.ID, until) {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// RevokeUser blacklists every token issued to a user until now, for as long
+// as they could be accepted, allowing grace past expiry. Tokens issued right
+// after the call stay valid.
+func (j *JWTManager) RevokeUser(userID uint, grace time.Duration) error {
+	if j.blacklist == nil {
+		return ErrTokenNotRevocable
+	}
+	now := time.Now()
+	j.blacklist.AddUser(userID, now, now.Add(j.expiry+grace))
+	return nil
+}
+
+// RefreshToken generates a new token with extended expiry, for the same
+// audience
 func (j *JWTManager) RefreshToken(claims *JWTClaims) (string, error) {
-	return j.GenerateToken(claims.UserID, claims.Email)
+	var audience string
+	if len(claims.Audience) > 0 {
+		audience = claims.Audience[0]
+	}
+	return j.GenerateTokenForAudience(claims.UserID, claims.Email, audience)
 }
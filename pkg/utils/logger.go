@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"context"
+	"log"
+)
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger
+func WithLogger(ctx context.Context, logger *log.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the context's request-scoped logger, or the
+// standard logger outside a request
+func LoggerFromContext(ctx context.Context) *log.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*log.Logger); ok {
+		return logger
+	}
+	return log.Default()
+}
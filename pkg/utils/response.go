@@ -23,13 +23,22 @@ type APIError struct {
 
 // Common error codes
 const (
-	ErrCodeValidation     = "VALIDATION_ERROR"
-	ErrCodeUnauthorized   = "UNAUTHORIZED"
-	ErrCodeForbidden      = "FORBIDDEN"
-	ErrCodeNotFound       = "NOT_FOUND"
-	ErrCodeConflict       = "CONFLICT"
-	ErrCodeInternal       = "INTERNAL_ERROR"
-	ErrCodeBadRequest     = "BAD_REQUEST"
+	ErrCodeValidation    = "VALIDATION_ERROR"
+	ErrCodeUnauthorized  = "UNAUTHORIZED"
+	ErrCodeForbidden     = "FORBIDDEN"
+	ErrCodeNotFound      = "NOT_FOUND"
+	ErrCodeGone          = "GONE"
+	ErrCodeConflict      = "CONFLICT"
+	ErrCodeInternal      = "INTERNAL_ERROR"
+	ErrCodeBadRequest    = "BAD_REQUEST"
+	ErrCodeUnavailable   = "SERVICE_UNAVAILABLE"
+	ErrCodePrecondition  = "PRECONDITION_FAILED"
+	ErrCodeTooLarge      = "PAYLOAD_TOO_LARGE"
+	ErrCodeURITooLong    = "URI_TOO_LONG"
+	ErrCodeHeaders       = "HEADERS_TOO_LARGE"
+	ErrCodeLocked        = "ACCOUNT_LOCKED"
+	ErrCodeNotAcceptable = "NOT_ACCEPTABLE"
+	ErrCodeRateLimited   = "RATE_LIMITED"
 )
 
 // Success sends a successful response
@@ -74,11 +83,21 @@ func ForbiddenError(c *gin.Context, message string) {
 	Error(c, http.StatusForbidden, ErrCodeForbidden, message, nil)
 }
 
+// AccountLockedError sends a forbidden response for a locked account
+func AccountLockedError(c *gin.Context, message string) {
+	Error(c, http.StatusForbidden, ErrCodeLocked, message, nil)
+}
+
 // NotFoundError sends a not found error response
 func NotFoundError(c *gin.Context, resource string) {
 	Error(c, http.StatusNotFound, ErrCodeNotFound, resource+" not found", nil)
 }
 
+// GoneError sends a 410 response for a resource that was permanently deleted
+func GoneError(c *gin.Context, resource string) {
+	Error(c, http.StatusGone, ErrCodeGone, resource+" has been permanently deleted", nil)
+}
+
 // ConflictError sends a conflict error response
 func ConflictError(c *gin.Context, message string) {
 	Error(c, http.StatusConflict, ErrCodeConflict, message, nil)
@@ -97,6 +116,44 @@ func BadRequestError(c *gin.Context, message string) {
 	Error(c, http.StatusBadRequest, ErrCodeBadRequest, message, nil)
 }
 
+// NotAcceptableError sends a 406 not acceptable response
+func NotAcceptableError(c *gin.Context, message string) {
+	Error(c, http.StatusNotAcceptable, ErrCodeNotAcceptable, message, nil)
+}
+
+// PreconditionFailedError sends a precondition failed error response
+func PreconditionFailedError(c *gin.Context, message string) {
+	Error(c, http.StatusPreconditionFailed, ErrCodePrecondition, message, nil)
+}
+
+// PayloadTooLargeError sends a payload too large error response
+func PayloadTooLargeError(c *gin.Context, message string) {
+	Error(c, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, message, nil)
+}
+
+// URITooLongError sends a 414 URI too long response
+func URITooLongError(c *gin.Context, message string) {
+	Error(c, http.StatusRequestURITooLong, ErrCodeURITooLong, message, nil)
+}
+
+// HeadersTooLargeError sends a 431 request header fields too large response
+func HeadersTooLargeError(c *gin.Context, message string) {
+	Error(c, http.StatusRequestHeaderFieldsTooLarge, ErrCodeHeaders, message, nil)
+}
+
+// TooManyRequestsError sends a 429 rate limited response
+func TooManyRequestsError(c *gin.Context, message string) {
+	Error(c, http.StatusTooManyRequests, ErrCodeRateLimited, message, nil)
+}
+
+// ServiceUnavailableError sends a service unavailable error response
+func ServiceUnavailableError(c *gin.Context, message string) {
+	if message == "" {
+		message = "Service temporarily unavailable"
+	}
+	Error(c, http.StatusServiceUnavailable, ErrCodeUnavailable, message, nil)
+}
+
 // Created sends a 201 created response
 func Created(c *gin.Context, message string, data interface{}) {
 	Success(c, http.StatusCreated, message, data)
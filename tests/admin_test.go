@@ -0,0 +1,532 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/handlers"
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/internal/router"
+	"github.com/bhaskar/todo-api/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+// AdminTestSuite is the test suite for admin endpoints, run against the full router
+type AdminTestSuite struct {
+	suite.Suite
+	router     *gin.Engine
+	db         *gorm.DB
+	adminToken string
+	userToken  string
+}
+
+// SetupSuite runs before all tests
+func (s *AdminTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+
+	cfg, err := config.Load()
+	s.Require().NoError(err)
+	cfg.Database = config.DatabaseConfig{
+		Host:   "sqlite",
+		DBName: ":memory:",
+	}
+	// Keep mixed-case emails as registered, like accounts predating normalization
+	cfg.Security.NormalizeEmails = false
+
+	db, err := database.Connect(&cfg.Database)
+	s.Require().NoError(err)
+	s.Require().NoError(database.Migrate(db))
+	s.db = db
+
+	s.router = router.New(cfg, db)
+
+	s.userToken, _ = s.registerUser("admin-test-user@example.com")
+	_, adminID := s.registerUser("admin-test-admin@example.com")
+	s.Require().NoError(db.Model(&models.User{}).Where("id = ?", adminID).Update("role", models.RoleAdmin).Error)
+	s.adminToken = s.login("admin-test-admin@example.com")
+}
+
+// registerUser registers a user and returns its auth token and ID
+func (s *AdminTestSuite) registerUser(email string) (string, uint) {
+	jsonBody, _ := json.Marshal(map[string]string{"email": email, "password": "password123"})
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/register", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusCreated, w.Code)
+
+	var response struct {
+		Data struct {
+			User  models.UserResponse `json:"user"`
+			Token string              `json:"token"`
+		} `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Data.Token, response.Data.User.ID
+}
+
+// login returns a fresh auth token for a user
+func (s *AdminTestSuite) login(email string, password ...string) string {
+	jsonBody, _ := json.Marshal(map[string]string{"email": email, "password": cmp.Or(append(password, "password123")...)})
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	var response struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Data.Token
+}
+
+// TestListRoutes tests that the route listing includes todo routes and auth requirements
+func (s *AdminTestSuite) TestListRoutes() {
+	req := httptest.NewRequest(http.MethodGet, "/api/routes", nil)
+	req.Header.Set("Authorization", "Bearer "+s.adminToken)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	var response struct {
+		Data []handlers.RouteInfo `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+
+	assert.Contains(s.T(), response.Data, handlers.RouteInfo{Method: http.MethodPost, Path: "/api/todos", RequiresAuth: true})
+	assert.Contains(s.T(), response.Data, handlers.RouteInfo{Method: http.MethodGet, Path: "/api/todos", RequiresAuth: true})
+	assert.Contains(s.T(), response.Data, handlers.RouteInfo{Method: http.MethodGet, Path: "/api/todos/:id", RequiresAuth: true})
+	assert.Contains(s.T(), response.Data, handlers.RouteInfo{Method: http.MethodPut, Path: "/api/todos/:id", RequiresAuth: true})
+	assert.Contains(s.T(), response.Data, handlers.RouteInfo{Method: http.MethodDelete, Path: "/api/todos/:id", RequiresAuth: true})
+	assert.Contains(s.T(), response.Data, handlers.RouteInfo{Method: http.MethodPost, Path: "/api/auth/login", RequiresAuth: false})
+	assert.Contains(s.T(), response.Data, handlers.RouteInfo{Method: http.MethodGet, Path: "/health", RequiresAuth: false})
+}
+
+// TestListRoutesForbiddenForNonAdmin tests that regular users get 403
+func (s *AdminTestSuite) TestListRoutesForbiddenForNonAdmin() {
+	req := httptest.NewRequest(http.MethodGet, "/api/routes", nil)
+	req.Header.Set("Authorization", "Bearer "+s.userToken)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusForbidden, w.Code)
+}
+
+// TestReassignTodo tests moving a todo to another user and auditing it
+func (s *AdminTestSuite) TestReassignTodo() {
+	_, fromID := s.registerUser("reassign-from@example.com")
+	_, toID := s.registerUser("reassign-to@example.com")
+	todo := models.Todo{Title: "Hand over", UserID: fromID, Tags: models.NewTags(fromID, []string{"handover"})}
+	s.Require().NoError(s.db.Create(&todo).Error)
+
+	w := s.reassign(s.adminToken, todo.ID, toID)
+
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	s.Require().NoError(s.db.Preload("Tags").First(&todo, todo.ID).Error)
+	assert.Equal(s.T(), toID, todo.UserID)
+
+	// The tag moves to one of the new owner's
+	s.Require().Len(todo.Tags, 1)
+	assert.Equal(s.T(), toID, todo.Tags[0].UserID)
+	assert.Equal(s.T(), "handover", todo.Tags[0].Name)
+
+	var entry models.AuditLog
+	s.Require().NoError(s.db.Where("action = ? AND entity_id = ?", models.AuditActionTodoReassigned, todo.ID).First(&entry).Error)
+	assert.Equal(s.T(), "todo", entry.EntityType)
+	assert.JSONEq(s.T(), fmt.Sprintf(`{"from_user_id":%d,"to_user_id":%d}`, fromID, toID), entry.Details)
+
+	// The move is part of the todo's history too
+	var versions int64
+	s.Require().NoError(s.db.Model(&models.AuditLog{}).Where("action IN ? AND entity_id = ?", models.TodoVersionActions, todo.ID).Count(&versions).Error)
+	assert.Equal(s.T(), int64(1), versions)
+}
+
+// TestReassignTodoWithSubtasks tests that subtasks move with their parent,
+// and that a subtask moved on its own leaves its parent behind
+func (s *AdminTestSuite) TestReassignTodoWithSubtasks() {
+	_, fromID := s.registerUser("reassign-tree-from@example.com")
+	_, toID := s.registerUser("reassign-tree-to@example.com")
+	parent := models.Todo{Title: "Parent", UserID: fromID}
+	s.Require().NoError(s.db.Create(&parent).Error)
+	child := models.Todo{Title: "Child", UserID: fromID, ParentID: &parent.ID, Tags: models.NewTags(fromID, []string{"nested"})}
+	s.Require().NoError(s.db.Create(&child).Error)
+	grandchild := models.Todo{Title: "Grandchild", UserID: fromID, ParentID: &child.ID}
+	s.Require().NoError(s.db.Create(&grandchild).Error)
+	s.Require().NoError(s.db.Delete(&grandchild).Error)
+
+	s.Require().Equal(http.StatusOK, s.reassign(s.adminToken, parent.ID, toID).Code)
+	for _, todo := range []*models.Todo{&parent, &child, &grandchild} {
+		s.Require().NoError(s.db.Unscoped().Preload("Tags").First(todo, todo.ID).Error)
+		assert.Equal(s.T(), toID, todo.UserID, todo.Title)
+	}
+	s.Require().NotNil(grandchild.ParentID)
+	assert.Equal(s.T(), child.ID, *grandchild.ParentID)
+	s.Require().Len(child.Tags, 1)
+	assert.Equal(s.T(), toID, child.Tags[0].UserID)
+	var versions int64
+	s.Require().NoError(s.db.Model(&models.AuditLog{}).Where("action IN ? AND entity_id = ?", models.TodoVersionActions, child.ID).Count(&versions).Error)
+	assert.Equal(s.T(), int64(1), versions)
+
+	// Moving the child back detaches it, taking the grandchild along
+	s.Require().Equal(http.StatusOK, s.reassign(s.adminToken, child.ID, fromID).Code)
+	s.Require().NoError(s.db.First(&child, child.ID).Error)
+	s.Require().NoError(s.db.Unscoped().First(&grandchild, grandchild.ID).Error)
+	s.Require().NoError(s.db.First(&parent, parent.ID).Error)
+	assert.Equal(s.T(), fromID, child.UserID)
+	assert.Nil(s.T(), child.ParentID)
+	assert.Equal(s.T(), fromID, grandchild.UserID)
+	assert.Equal(s.T(), toID, parent.UserID)
+}
+
+// TestReassignTodoExternalIDConflict tests that a todo can't be moved to a
+// user who already uses its external ID, and that nothing moves
+func (s *AdminTestSuite) TestReassignTodoExternalIDConflict() {
+	_, fromID := s.registerUser("reassign-conflict-from@example.com")
+	_, toID := s.registerUser("reassign-conflict-to@example.com")
+	externalID := "shared-external-id"
+	parent := models.Todo{Title: "Parent", UserID: fromID}
+	s.Require().NoError(s.db.Create(&parent).Error)
+	child := models.Todo{Title: "Child", UserID: fromID, ParentID: &parent.ID, ExternalID: &externalID}
+	s.Require().NoError(s.db.Create(&child).Error)
+	s.Require().NoError(s.db.Create(&models.Todo{Title: "Taken", UserID: toID, ExternalID: &externalID}).Error)
+
+	assert.Equal(s.T(), http.StatusConflict, s.reassign(s.adminToken, parent.ID, toID).Code)
+	for _, todo := range []*models.Todo{&parent, &child} {
+		s.Require().NoError(s.db.First(todo, todo.ID).Error)
+		assert.Equal(s.T(), fromID, todo.UserID, todo.Title)
+	}
+}
+
+// TestReassignTodoToMissingUser tests that the target user must exist
+func (s *AdminTestSuite) TestReassignTodoToMissingUser() {
+	_, ownerID := s.registerUser("reassign-missing@example.com")
+	todo := models.Todo{Title: "Stays put", UserID: ownerID}
+	s.Require().NoError(s.db.Create(&todo).Error)
+
+	w := s.reassign(s.adminToken, todo.ID, 999999)
+
+	assert.Equal(s.T(), http.StatusNotFound, w.Code)
+	s.Require().NoError(s.db.First(&todo, todo.ID).Error)
+	assert.Equal(s.T(), ownerID, todo.UserID)
+}
+
+// TestReassignTodoForbiddenForNonAdmin tests that regular users get 403
+func (s *AdminTestSuite) TestReassignTodoForbiddenForNonAdmin() {
+	_, ownerID := s.registerUser("reassign-nonadmin@example.com")
+	todo := models.Todo{Title: "Not yours to move", UserID: ownerID}
+	s.Require().NoError(s.db.Create(&todo).Error)
+
+	w := s.reassign(s.userToken, todo.ID, ownerID)
+
+	assert.Equal(s.T(), http.StatusForbidden, w.Code)
+}
+
+// TestSearchUsersByEmailPrefix tests prefix-only matching and result capping
+func (s *AdminTestSuite) TestSearchUsersByEmailPrefix() {
+	s.registerUser("search-alpha@example.com")
+	s.registerUser("Search-Beta@example.com")
+	s.registerUser("search-gamma@example.com")
+	s.registerUser("mid-search-delta@example.com")
+	s.registerUser("searchxwild@example.com")
+
+	emails := func(path string) []string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+s.adminToken)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusOK, w.Code)
+
+		var response struct {
+			Data []models.UserResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		result := make([]string, len(response.Data))
+		for i, user := range response.Data {
+			result[i] = user.Email
+		}
+		return result
+	}
+
+	// Matches at the start only, case-insensitively
+	assert.Equal(s.T(), []string{"search-alpha@example.com", "Search-Beta@example.com", "search-gamma@example.com"}, emails("/api/admin/users?email=search-"))
+
+	// Wildcards in the prefix match literally
+	assert.Empty(s.T(), emails("/api/admin/users?email=search_"))
+
+	// Results are capped
+	assert.Len(s.T(), emails("/api/admin/users?email=search&limit=2"), 2)
+}
+
+// TestLockoutAndAdminUnlock tests that repeated failures lock an account,
+// even against the correct password, until an admin unlocks it
+func (s *AdminTestSuite) TestLockoutAndAdminUnlock() {
+	_, userID := s.registerUser("lockout@example.com")
+
+	attempt := func(password string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(map[string]string{"email": "lockout@example.com", "password": password})
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A success resets the count, so failures must be consecutive
+	for i := 0; i < 4; i++ {
+		s.Require().Equal(http.StatusUnauthorized, attempt("wrong-password").Code)
+	}
+	s.Require().Equal(http.StatusOK, attempt("password123").Code)
+	for i := 0; i < 5; i++ {
+		s.Require().Equal(http.StatusUnauthorized, attempt("wrong-password").Code)
+	}
+
+	w := attempt("password123")
+	assert.Equal(s.T(), http.StatusForbidden, w.Code)
+	assert.Contains(s.T(), w.Body.String(), "ACCOUNT_LOCKED")
+	assert.Contains(s.T(), w.Body.String(), "too many failed login attempts")
+
+	unlock := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/admin/users/%d/unlock", userID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(s.T(), http.StatusForbidden, unlock(s.userToken))
+	assert.Equal(s.T(), http.StatusOK, unlock(s.adminToken))
+
+	assert.Equal(s.T(), http.StatusOK, attempt("password123").Code)
+}
+
+// TestExport tests that the NDJSON export contains users followed by their
+// todos and is rejected for non-admins
+func (s *AdminTestSuite) TestExport() {
+	_, userID := s.registerUser("export@example.com")
+	todos := []models.Todo{
+		{Title: "Exported one", UserID: userID},
+		{Title: "Exported two", UserID: userID, Completed: true},
+	}
+	s.Require().NoError(s.db.Create(&todos).Error)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/export", nil)
+	req.Header.Set("Authorization", "Bearer "+s.userToken)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusForbidden, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/export", nil)
+	req.Header.Set("Authorization", "Bearer "+s.adminToken)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Equal(s.T(), "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var records []models.ExportRecord
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var record models.ExportRecord
+		s.Require().NoError(json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+
+	// The seeded user is followed directly by both of their todos
+	index := slices.IndexFunc(records, func(r models.ExportRecord) bool {
+		return r.Type == models.ExportTypeUser && r.User.ID == userID
+	})
+	s.Require().NotEqual(-1, index)
+	assert.Equal(s.T(), "export@example.com", records[index].User.Email)
+	assert.NotEmpty(s.T(), records[index].User.PasswordHash)
+
+	s.Require().Greater(len(records), index+2)
+	for i, todo := range todos {
+		record := records[index+1+i]
+		s.Require().Equal(models.ExportTypeTodo, record.Type)
+		assert.Equal(s.T(), todo.ID, record.Todo.ID)
+		assert.Equal(s.T(), todo.Title, record.Todo.Title)
+		assert.Equal(s.T(), userID, record.Todo.UserID)
+	}
+}
+
+// TestImport tests restoring users and todos from NDJSON, keeping their IDs,
+// and the skip and merge modes for records that already exist
+func (s *AdminTestSuite) TestImport() {
+	data := strings.Join([]string{
+		`{"type":"user","user":{"id":900001,"email":"restored@example.com","password":"restored-pass","role":"user","email_verified":true}}`,
+		`{"type":"todo","todo":{"id":900101,"user_id":900001,"title":"Restored parent","priority":"high","tags":["Errands"]}}`,
+		`{"type":"todo","todo":{"id":900102,"user_id":900001,"title":"Restored child","parent_id":900101,"completed":true}}`,
+	}, "\n")
+
+	importData := func(mode string) models.DataImportResult {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/import?mode="+mode, strings.NewReader(data))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.Header.Set("Authorization", "Bearer "+s.adminToken)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+		var response struct {
+			Data models.DataImportResult `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	result := importData(models.ImportModeSkip)
+	assert.Equal(s.T(), models.DataImportResult{UsersCreated: 1, TodosCreated: 2}, result)
+
+	var user models.User
+	s.Require().NoError(s.db.First(&user, 900001).Error)
+	assert.Equal(s.T(), "restored@example.com", user.Email)
+	assert.NotEqual(s.T(), "restored-pass", user.Password, "plaintext passwords are hashed")
+	assert.True(s.T(), user.EmailVerified)
+	s.login("restored@example.com", "restored-pass")
+
+	var todos []models.Todo
+	s.Require().NoError(s.db.Where("user_id = ?", user.ID).Order("id").Find(&todos).Error)
+	s.Require().Len(todos, 2)
+	assert.Equal(s.T(), uint(900101), todos[0].ID)
+	assert.Equal(s.T(), "high", todos[0].Priority)
+	var tag models.Tag
+	s.Require().NoError(s.db.Joins("JOIN todo_tags ON todo_tags.tag_id = tags.id").Where("todo_tags.todo_id = ?", todos[0].ID).First(&tag).Error)
+	assert.Equal(s.T(), models.Tag{ID: tag.ID, UserID: user.ID, Name: "errands", CreatedAt: tag.CreatedAt}, tag)
+	assert.Equal(s.T(), uint(900102), todos[1].ID)
+	s.Require().NotNil(todos[1].ParentID)
+	assert.Equal(s.T(), uint(900101), *todos[1].ParentID)
+	assert.True(s.T(), todos[1].Completed)
+
+	// Importing again skips everything, or overwrites it when merging
+	assert.Equal(s.T(), models.DataImportResult{UsersSkipped: 1, TodosSkipped: 2}, importData(models.ImportModeSkip))
+
+	s.Require().NoError(s.db.Model(&models.Todo{}).Where("id = ?", 900101).Update("title", "Edited").Error)
+	assert.Equal(s.T(), models.DataImportResult{UsersMerged: 1, TodosMerged: 2}, importData(models.ImportModeMerge))
+	var parent models.Todo
+	s.Require().NoError(s.db.First(&parent, 900101).Error)
+	assert.Equal(s.T(), "Restored parent", parent.Title)
+
+	// Each write recorded a version, in the same transaction as the todo
+	var versions []models.AuditLog
+	s.Require().NoError(s.db.Where("entity_type = ? AND entity_id = ?", "todo", 900101).Order("id").Find(&versions).Error)
+	s.Require().Len(versions, 2)
+	assert.Equal(s.T(), models.AuditActionTodoCreated, versions[0].Action)
+	assert.Equal(s.T(), models.AuditActionTodoUpdated, versions[1].Action)
+	var state models.TodoVersion
+	s.Require().NoError(json.Unmarshal([]byte(versions[1].Details), &state))
+	assert.Equal(s.T(), "Restored parent", state.Title)
+
+	// Malformed data is rejected
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/import", strings.NewReader(`{"type":"todo","todo":{"id":1,"user_id":1,"title":"Orphan"}}`))
+	req.Header.Set("Authorization", "Bearer "+s.adminToken)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+// exportUser returns a user's export records: the user followed by their todos
+func (s *AdminTestSuite) exportUser(userID uint) []models.ExportRecord {
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/export", nil)
+	req.Header.Set("Authorization", "Bearer "+s.adminToken)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	var records []models.ExportRecord
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var record models.ExportRecord
+		s.Require().NoError(json.Unmarshal(scanner.Bytes(), &record))
+		if record.User != nil && record.User.ID == userID || record.Todo != nil && record.Todo.UserID == userID {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// importRecords imports export records in the given mode
+func (s *AdminTestSuite) importRecords(records []models.ExportRecord, mode string) models.DataImportResult {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, record := range records {
+		s.Require().NoError(encoder.Encode(record))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/import?mode="+mode, &body)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Authorization", "Bearer "+s.adminToken)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var response struct {
+		Data models.DataImportResult `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Data
+}
+
+// TestExportImportRoundTrip tests that merging an export back restores the
+// todos' state as exported
+func (s *AdminTestSuite) TestExportImportRoundTrip() {
+	_, userID := s.registerUser("round-trip@example.com")
+	todo := models.Todo{Title: "Archived", UserID: userID, Archived: true, Recurrence: models.RecurrenceWeekly, Tags: models.NewTags(userID, []string{"home", "work"})}
+	s.Require().NoError(s.db.Create(&todo).Error)
+
+	s.Require().NoError(s.db.Model(&models.User{}).Where("id = ?", userID).Update("email_verified", true).Error)
+
+	records := s.exportUser(userID)
+	s.Require().Len(records, 2)
+	assert.True(s.T(), records[0].User.EmailVerified)
+	assert.Equal(s.T(), []string{"home", "work"}, records[1].Todo.Tags)
+
+	s.Require().NoError(s.db.Model(&todo).Updates(map[string]interface{}{"archived": false, "recurrence": ""}).Error)
+	s.Require().NoError(s.db.Where("todo_id = ?", todo.ID).Delete(&models.TodoTag{}).Error)
+	assert.Equal(s.T(), models.DataImportResult{UsersMerged: 1, TodosMerged: 1}, s.importRecords(records, models.ImportModeMerge))
+
+	var user models.User
+	s.Require().NoError(s.db.First(&user, userID).Error)
+	assert.True(s.T(), user.EmailVerified)
+
+	var restored models.Todo
+	s.Require().NoError(s.db.First(&restored, todo.ID).Error)
+	assert.True(s.T(), restored.Archived)
+	assert.Equal(s.T(), models.RecurrenceWeekly, restored.Recurrence)
+	var tags []string
+	s.Require().NoError(s.db.Model(&models.Tag{}).
+		Joins("JOIN todo_tags ON todo_tags.tag_id = tags.id").
+		Where("todo_tags.todo_id = ? AND tags.user_id = ?", todo.ID, userID).
+		Order("tags.name").Pluck("tags.name", &tags).Error)
+	assert.Equal(s.T(), []string{"home", "work"}, tags)
+}
+
+// reassign sends a todo owner change with the given token
+func (s *AdminTestSuite) reassign(token string, todoID, userID uint) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(models.ReassignTodoRequest{UserID: userID})
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/admin/todos/%d/owner", todoID), bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// TestAdminTestSuite runs the test suite
+func TestAdminTestSuite(t *testing.T) {
+	suite.Run(t, new(AdminTestSuite))
+}
@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/internal/repository"
+	"github.com/bhaskar/todo-api/internal/router"
+	"github.com/bhaskar/todo-api/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+// APIKeyTestSuite is the test suite for API keys, run against the full router
+type APIKeyTestSuite struct {
+	suite.Suite
+	router *gin.Engine
+	db     *gorm.DB
+}
+
+// SetupSuite runs before all tests
+func (s *APIKeyTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+
+	cfg, err := config.Load()
+	s.Require().NoError(err)
+	cfg.Database = config.DatabaseConfig{
+		Host:   "sqlite",
+		DBName: ":memory:",
+	}
+	cfg.Security.MaxAPIKeys = 3
+
+	db, err := database.Connect(&cfg.Database)
+	s.Require().NoError(err)
+	s.Require().NoError(database.Migrate(db))
+
+	s.db = db
+	s.router = router.New(cfg, db)
+}
+
+// request sends an authenticated JSON request and returns the recorder
+func (s *APIKeyTestSuite) request(method, path, credential string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		s.Require().NoError(json.NewEncoder(&payload).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if credential != "" {
+		req.Header.Set("Authorization", "Bearer "+credential)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// registerUser registers a user and returns its auth token
+func (s *APIKeyTestSuite) registerUser(email string) string {
+	w := s.request(http.MethodPost, "/api/auth/register", "", map[string]string{"email": email, "password": "password123"})
+	s.Require().Equal(http.StatusCreated, w.Code)
+
+	var response struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Data.Token
+}
+
+// createKey creates an API key and returns its response
+func (s *APIKeyTestSuite) createKey(token, name string) (*httptest.ResponseRecorder, models.CreatedAPIKeyResponse) {
+	w := s.request(http.MethodPost, "/api/auth/api-keys", token, models.CreateAPIKeyRequest{Name: name})
+	var response struct {
+		Data models.CreatedAPIKeyResponse `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response.Data
+}
+
+// TestAPIKeyAuthenticates tests that a key authenticates until revoked
+func (s *APIKeyTestSuite) TestAPIKeyAuthenticates() {
+	token := s.registerUser("api-key-auth@example.com")
+
+	w, key := s.createKey(token, "Script")
+	s.Require().Equal(http.StatusCreated, w.Code)
+	assert.Contains(s.T(), key.Key, models.APIKeyPrefix)
+	assert.Equal(s.T(), key.Key[:len(key.Prefix)], key.Prefix)
+
+	assert.Equal(s.T(), http.StatusOK, s.request(http.MethodGet, "/api/auth/profile", key.Key, nil).Code)
+
+	w = s.request(http.MethodDelete, fmt.Sprintf("/api/auth/api-keys/%d", key.ID), token, nil)
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Equal(s.T(), http.StatusUnauthorized, s.request(http.MethodGet, "/api/auth/profile", key.Key, nil).Code)
+	assert.Equal(s.T(), http.StatusUnauthorized, s.request(http.MethodGet, "/api/auth/profile", models.APIKeyPrefix+"unknown", nil).Code)
+}
+
+// TestAPIKeyLimit tests that keys past the limit are rejected until one is revoked
+func (s *APIKeyTestSuite) TestAPIKeyLimit() {
+	token := s.registerUser("api-key-limit@example.com")
+	otherToken := s.registerUser("api-key-limit-other@example.com")
+
+	var keys []models.CreatedAPIKeyResponse
+	for i := 0; i < 3; i++ {
+		w, key := s.createKey(token, fmt.Sprintf("Key %d", i))
+		s.Require().Equal(http.StatusCreated, w.Code)
+		keys = append(keys, key)
+	}
+
+	w, _ := s.createKey(token, "One too many")
+	assert.Equal(s.T(), http.StatusConflict, w.Code)
+	assert.Contains(s.T(), w.Body.String(), "at most 3 active keys")
+
+	// The limit is per user, and other users can't revoke the key
+	w, _ = s.createKey(otherToken, "Other")
+	assert.Equal(s.T(), http.StatusCreated, w.Code)
+	w = s.request(http.MethodDelete, fmt.Sprintf("/api/auth/api-keys/%d", keys[0].ID), otherToken, nil)
+	assert.Equal(s.T(), http.StatusNotFound, w.Code)
+
+	// Revoking frees a slot
+	w = s.request(http.MethodDelete, fmt.Sprintf("/api/auth/api-keys/%d", keys[0].ID), token, nil)
+	s.Require().Equal(http.StatusOK, w.Code)
+	w, _ = s.createKey(token, "Replacement")
+	assert.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.request(http.MethodGet, "/api/auth/api-keys", token, nil)
+	s.Require().Equal(http.StatusOK, w.Code)
+	var listed struct {
+		Data []models.APIKeyResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Len(s.T(), listed.Data, 3)
+	assert.NotContains(s.T(), w.Body.String(), keys[1].Key)
+}
+
+// TestAPIKeyLastUsed tests that using a key records when, at most once per interval
+func (s *APIKeyTestSuite) TestAPIKeyLastUsed() {
+	token := s.registerUser("api-key-last-used@example.com")
+	_, key := s.createKey(token, "Sync")
+	assert.Nil(s.T(), key.LastUsedAt)
+
+	lastUsed := func() time.Time {
+		var stored models.APIKey
+		s.Require().NoError(s.db.First(&stored, key.ID).Error)
+		s.Require().NotNil(stored.LastUsedAt)
+		return *stored.LastUsedAt
+	}
+
+	s.Require().Equal(http.StatusOK, s.request(http.MethodGet, "/api/auth/profile", key.Key, nil).Code)
+	first := lastUsed()
+
+	// Rapid reuse within the interval doesn't write
+	for i := 0; i < 3; i++ {
+		s.Require().Equal(http.StatusOK, s.request(http.MethodGet, "/api/auth/profile", key.Key, nil).Code)
+	}
+	assert.True(s.T(), lastUsed().Equal(first))
+
+	repo := repository.NewAPIKeyRepository(s.db)
+	touched, err := repo.TouchLastUsed(context.Background(), key.ID, time.Now(), first.Add(-time.Minute))
+	s.Require().NoError(err)
+	assert.False(s.T(), touched)
+
+	// Once the interval has passed, the next use refreshes it
+	stale := time.Now().Add(-time.Hour)
+	s.Require().NoError(s.db.Model(&models.APIKey{}).Where("id = ?", key.ID).Update("last_used_at", stale).Error)
+	s.Require().Equal(http.StatusOK, s.request(http.MethodGet, "/api/auth/profile", key.Key, nil).Code)
+	assert.True(s.T(), lastUsed().After(stale.Add(time.Minute)))
+
+	w := s.request(http.MethodGet, "/api/auth/api-keys", token, nil)
+	s.Require().Equal(http.StatusOK, w.Code)
+	var listed struct {
+		Data []models.APIKeyResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &listed))
+	s.Require().Len(listed.Data, 1)
+	assert.NotNil(s.T(), listed.Data[0].LastUsedAt)
+}
+
+// TestAPIKeyTestSuite runs the test suite
+func TestAPIKeyTestSuite(t *testing.T) {
+	suite.Run(t, new(APIKeyTestSuite))
+}
+
+// TestAPIKeysFeatureDisabled tests that switching off the api_keys feature
+// hides its routes and stops keys authenticating
+func (s *APIKeyTestSuite) TestAPIKeysFeatureDisabled() {
+	token := s.registerUser("api-key-disabled@example.com")
+	w, key := s.createKey(token, "Script")
+	s.Require().Equal(http.StatusCreated, w.Code)
+
+	cfg, err := config.Load()
+	s.Require().NoError(err)
+	cfg.Features = config.Features{config.FeatureAPIKeys: false}
+	disabled := router.New(cfg, s.db)
+
+	request := func(method, path, credential string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+credential)
+		w := httptest.NewRecorder()
+		disabled.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(s.T(), http.StatusNotFound, request(http.MethodGet, "/api/auth/api-keys", token))
+	assert.Equal(s.T(), http.StatusNotFound, request(http.MethodPost, "/api/auth/api-keys", token))
+	assert.Equal(s.T(), http.StatusUnauthorized, request(http.MethodGet, "/api/auth/profile", key.Key))
+	assert.Equal(s.T(), http.StatusOK, request(http.MethodGet, "/api/auth/profile", token))
+
+	// The suite's router has the feature enabled
+	assert.Equal(s.T(), http.StatusOK, s.request(http.MethodGet, "/api/auth/api-keys", token, nil).Code)
+}
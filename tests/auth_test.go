@@ -2,22 +2,29 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/events"
 	"github.com/bhaskar/todo-api/internal/handlers"
 	"github.com/bhaskar/todo-api/internal/middleware"
+	"github.com/bhaskar/todo-api/internal/models"
 	"github.com/bhaskar/todo-api/internal/repository"
 	"github.com/bhaskar/todo-api/internal/services"
 	"github.com/bhaskar/todo-api/pkg/database"
 	"github.com/bhaskar/todo-api/pkg/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // AuthTestSuite is the test suite for authentication endpoints
@@ -25,7 +32,9 @@ type AuthTestSuite struct {
 	suite.Suite
 	router      *gin.Engine
 	authHandler *handlers.AuthHandler
+	todoService *services.TodoService
 	jwtManager  *utils.JWTManager
+	db          *gorm.DB
 }
 
 // SetupSuite runs before all tests
@@ -41,24 +50,32 @@ func (s *AuthTestSuite) SetupSuite() {
 	db, err := database.Connect(cfg)
 	s.Require().NoError(err)
 	s.Require().NoError(database.Migrate(db))
+	s.db = db
 
 	// Setup JWT manager
 	s.jwtManager = utils.NewJWTManager("test-secret", time.Hour, "test")
+	s.jwtManager.UseBlacklist(utils.NewTokenBlacklist(time.Minute))
 
 	// Setup repositories and services
 	userRepo := repository.NewUserRepository(db)
-	authService := services.NewAuthService(userRepo, s.jwtManager)
-	s.authHandler = handlers.NewAuthHandler(authService)
+	authService := services.NewAuthService(userRepo, s.jwtManager, config.SecurityConfig{BcryptCost: bcrypt.DefaultCost})
+	s.todoService = services.NewTodoService(repository.NewTodoRepository(db), userRepo, config.TodoConfig{})
+	s.authHandler = handlers.NewAuthHandler(authService, s.todoService)
 
 	// Setup router
 	s.router = gin.New()
 	s.router.POST("/api/auth/register", s.authHandler.Register)
 	s.router.POST("/api/auth/login", s.authHandler.Login)
+	s.router.POST("/api/auth/refresh", s.authHandler.Refresh)
 	
 	// Protected route
 	protected := s.router.Group("")
 	protected.Use(middleware.AuthMiddleware(s.jwtManager))
 	protected.GET("/api/auth/profile", s.authHandler.GetProfile)
+	protected.POST("/api/auth/logout", s.authHandler.Logout)
+	protected.PUT("/api/auth/password", s.authHandler.ChangePassword)
+	protected.GET("/api/auth/usage", s.authHandler.GetUsage)
+	protected.DELETE("/api/auth/account", s.authHandler.DeleteAccount)
 }
 
 // TestRegister tests user registration
@@ -123,6 +140,113 @@ func (s *AuthTestSuite) TestRegisterInvalidEmail() {
 	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
 }
 
+// TestEmailNormalization tests that whitespace, case and Unicode
+// normalization variants of an email resolve to the same account
+func (s *AuthTestSuite) TestEmailNormalization() {
+	ctx := context.Background()
+	authService := services.NewAuthService(repository.NewUserRepository(s.db), s.jwtManager, config.SecurityConfig{
+		BcryptCost:      bcrypt.MinCost,
+		NormalizeEmails: true,
+	})
+
+	// "é" precomposed when registering, decomposed ("e" + U+0301) afterwards
+	registered, err := authService.Register(ctx, &services.RegisterRequest{Email: "Café@Example.com", Password: "password123"})
+	s.Require().NoError(err)
+	assert.Equal(s.T(), "café@example.com", registered.User.Email)
+
+	for _, email := range []string{"café@example.com ", " cafe\u0301@example.com", "CAFE\u0301@EXAMPLE.COM\t"} {
+		loggedIn, err := authService.Login(ctx, &services.LoginRequest{Email: email, Password: "password123"})
+		s.Require().NoError(err, email)
+		assert.Equal(s.T(), registered.User.ID, loggedIn.User.ID, email)
+
+		_, err = authService.Register(ctx, &services.RegisterRequest{Email: email, Password: "password123"})
+		assert.EqualError(s.T(), err, "email already registered", email)
+	}
+
+	// Control characters are rejected, whitespace around the email is not
+	for email, status := range map[string]int{
+		"control\u0000@example.com": http.StatusBadRequest,
+		"contr\u007fol@example.com": http.StatusBadRequest,
+		"  spaced@example.com  ":    http.StatusCreated,
+	} {
+		jsonBody, _ := json.Marshal(map[string]string{"email": email, "password": "password123"})
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/register", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		assert.Equal(s.T(), status, w.Code, email)
+	}
+	_, err = authService.Login(ctx, &services.LoginRequest{Email: "spaced@example.com", Password: "password123"})
+	assert.NoError(s.T(), err)
+}
+
+// TestLoginClientID tests tokens scoped to a client_id from the allowlist,
+// and the auth middleware enforcing the token audience
+func (s *AuthTestSuite) TestLoginClientID() {
+	s.registerUser("client@example.com")
+
+	jwtManager := utils.NewJWTManager("test-secret", time.Hour, "test")
+	jwtManager.UseAudiences([]string{"web", "mobile"}, true)
+	authService := services.NewAuthService(repository.NewUserRepository(s.db), jwtManager, config.SecurityConfig{BcryptCost: bcrypt.MinCost})
+	authHandler := handlers.NewAuthHandler(authService, s.todoService)
+
+	router := gin.New()
+	router.POST("/api/auth/login", authHandler.Login)
+	router.POST("/api/auth/register", authHandler.Register)
+	router.GET("/api/auth/profile", middleware.AuthMiddleware(jwtManager), authHandler.GetProfile)
+
+	post := func(path, clientID string) *httptest.ResponseRecorder {
+		email := "client@example.com"
+		if path == "/api/auth/register" {
+			email = "client-new@example.com"
+		}
+		jsonBody, _ := json.Marshal(map[string]string{"email": email, "password": "password123", "client_id": clientID})
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	profile := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Unknown clients are rejected without creating an account
+	assert.Equal(s.T(), http.StatusBadRequest, post("/api/auth/login", "desktop").Code)
+	assert.Equal(s.T(), http.StatusBadRequest, post("/api/auth/register", "desktop").Code)
+	exists, err := repository.NewUserRepository(s.db).ExistsByEmail(context.Background(), "client-new@example.com")
+	s.Require().NoError(err)
+	assert.False(s.T(), exists)
+
+	w := post("/api/auth/login", "web")
+	s.Require().Equal(http.StatusOK, w.Code)
+	var response struct {
+		Data services.AuthResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	claims, err := jwtManager.ValidateToken(response.Data.Token)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), []string{"web"}, []string(claims.Audience))
+	assert.Equal(s.T(), http.StatusOK, profile(response.Data.Token))
+
+	// With an audience required, logins must name a client
+	assert.Equal(s.T(), http.StatusBadRequest, post("/api/auth/login", "").Code)
+
+	// Tokens without an accepted audience are rejected by the middleware
+	unscoped, err := s.jwtManager.GenerateToken(1, "client@example.com")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), http.StatusUnauthorized, profile(unscoped))
+
+	mobileToken, err := jwtManager.GenerateTokenForAudience(1, "client@example.com", "mobile")
+	s.Require().NoError(err)
+	jwtManager.UseAudiences([]string{"web"}, true)
+	assert.Equal(s.T(), http.StatusUnauthorized, profile(mobileToken))
+}
+
 // TestLogin tests user login
 func (s *AuthTestSuite) TestLogin() {
 	// Register user first
@@ -183,6 +307,598 @@ func (s *AuthTestSuite) TestGetProfileUnauthorized() {
 	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
 }
 
+// TestGetProfile tests that the default profile omits stats
+func (s *AuthTestSuite) TestGetProfile() {
+	token, _ := s.registerUser("profile-plain@example.com")
+
+	profile := s.getProfile(token, "/api/auth/profile")
+
+	assert.Equal(s.T(), "profile-plain@example.com", profile["email"])
+	assert.NotContains(s.T(), profile, "stats")
+}
+
+// TestGetProfileIncludeStats tests embedding todo stats in the profile
+func (s *AuthTestSuite) TestGetProfileIncludeStats() {
+	token, userID := s.registerUser("profile-stats@example.com")
+	ctx := context.Background()
+
+	var todoIDs []uint
+	for _, title := range []string{"One", "Two", "Three"} {
+		todo, err := s.todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: title})
+		s.Require().NoError(err)
+		todoIDs = append(todoIDs, todo.ID)
+	}
+	completed := true
+	_, err := s.todoService.Update(ctx, todoIDs[0], userID, &models.UpdateTodoRequest{Completed: &completed}, nil)
+	s.Require().NoError(err)
+
+	profile := s.getProfile(token, "/api/auth/profile?include=stats")
+
+	assert.Equal(s.T(), "profile-stats@example.com", profile["email"])
+	s.Require().Contains(profile, "stats")
+	stats := profile["stats"].(map[string]interface{})
+	assert.Equal(s.T(), float64(3), stats["total"])
+	assert.Equal(s.T(), float64(1), stats["completed"])
+	assert.Equal(s.T(), float64(2), stats["pending"])
+}
+
+// TestGetProfileUnsupportedInclude tests rejecting unknown include values
+func (s *AuthTestSuite) TestGetProfileUnsupportedInclude() {
+	token, _ := s.registerUser("profile-include@example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/profile?include=friends", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+// registerUser registers a user and returns its auth token and ID
+func (s *AuthTestSuite) registerUser(email string) (string, uint) {
+	jsonBody, _ := json.Marshal(map[string]string{"email": email, "password": "password123"})
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/register", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusCreated, w.Code)
+
+	var response struct {
+		Data struct {
+			User  models.UserResponse `json:"user"`
+			Token string              `json:"token"`
+		} `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Data.Token, response.Data.User.ID
+}
+
+// getProfile fetches the profile at path and returns its data object
+func (s *AuthTestSuite) getProfile(token, path string) map[string]interface{} {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Data
+}
+
+// TestConfiguredBcryptCost tests that registering and changing passwords
+// hash with the configured cost
+func (s *AuthTestSuite) TestConfiguredBcryptCost() {
+	userRepo := repository.NewUserRepository(s.db)
+	authService := services.NewAuthService(userRepo, s.jwtManager, config.SecurityConfig{BcryptCost: 6})
+	ctx := context.Background()
+
+	storedHash := func(userID uint) string {
+		user, err := userRepo.FindByID(ctx, userID)
+		s.Require().NoError(err)
+		return user.Password
+	}
+
+	registered, err := authService.Register(ctx, &services.RegisterRequest{Email: "bcrypt-cost@example.com", Password: "password123"})
+	s.Require().NoError(err)
+	assert.True(s.T(), strings.HasPrefix(storedHash(registered.User.ID), "$2a$06$"), storedHash(registered.User.ID))
+
+	s.Require().NoError(authService.ChangePassword(ctx, registered.User.ID, "password123", "newpassword123"))
+	cost, err := bcrypt.Cost([]byte(storedHash(registered.User.ID)))
+	s.Require().NoError(err)
+	assert.Equal(s.T(), 6, cost)
+}
+
+// TestLoginUpgradesBcryptCost tests that a lower-cost hash is rehashed on login
+func (s *AuthTestSuite) TestLoginUpgradesBcryptCost() {
+	userRepo := repository.NewUserRepository(s.db)
+	authService := services.NewAuthService(userRepo, s.jwtManager, config.SecurityConfig{BcryptCost: bcrypt.MinCost + 1})
+	ctx := context.Background()
+
+	oldHash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	s.Require().NoError(err)
+	user := &models.User{Email: "rehash@example.com", Password: string(oldHash)}
+	s.Require().NoError(userRepo.Create(ctx, user))
+
+	_, err = authService.Login(ctx, &services.LoginRequest{Email: user.Email, Password: "password123"})
+	s.Require().NoError(err)
+
+	stored, err := userRepo.FindByID(ctx, user.ID)
+	s.Require().NoError(err)
+	cost, err := bcrypt.Cost([]byte(stored.Password))
+	s.Require().NoError(err)
+	assert.Equal(s.T(), bcrypt.MinCost+1, cost)
+
+	// The upgraded hash still authenticates the same password
+	_, err = authService.Login(ctx, &services.LoginRequest{Email: user.Email, Password: "password123"})
+	assert.NoError(s.T(), err)
+	_, err = authService.Login(ctx, &services.LoginRequest{Email: user.Email, Password: "wrongpassword"})
+	assert.Error(s.T(), err)
+}
+
+// refresh posts token to the refresh endpoint of router
+func (s *AuthTestSuite) refresh(router *gin.Engine, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestRefreshToken tests exchanging a valid token for a new one
+func (s *AuthTestSuite) TestRefreshToken() {
+	token, userID := s.registerUser("refresh@example.com")
+
+	w := s.refresh(s.router, token)
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	var response struct {
+		Data services.AuthResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(s.T(), userID, response.Data.User.ID)
+	s.Require().NotEmpty(response.Data.Token)
+
+	// The new token authenticates like the old one
+	profile := s.getProfile(response.Data.Token, "/api/auth/profile")
+	assert.Equal(s.T(), "refresh@example.com", profile["email"])
+
+	// The old token was exchanged, so it neither authenticates nor refreshes again
+	assert.Equal(s.T(), http.StatusUnauthorized, s.profileStatus(token))
+	assert.Equal(s.T(), http.StatusUnauthorized, s.refresh(s.router, token).Code)
+
+	assert.Equal(s.T(), http.StatusUnauthorized, s.refresh(s.router, "not-a-token").Code)
+}
+
+// TestRefreshExpiredToken tests that expired tokens are only refreshed within the grace window
+func (s *AuthTestSuite) TestRefreshExpiredToken() {
+	_, userID := s.registerUser("refresh-expired@example.com")
+	expiredManager := utils.NewJWTManager("test-secret", -time.Hour, "test")
+	expired, err := expiredManager.GenerateToken(userID, "refresh-expired@example.com")
+	s.Require().NoError(err)
+
+	// Without a grace window, an expired token must log in again
+	w := s.refresh(s.router, expired)
+	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
+
+	// A grace window covering the expiry accepts it
+	userRepo := repository.NewUserRepository(s.db)
+	graceService := services.NewAuthService(userRepo, s.jwtManager, config.SecurityConfig{
+		BcryptCost:        bcrypt.DefaultCost,
+		TokenRefreshGrace: 2 * time.Hour,
+	})
+	graceRouter := gin.New()
+	graceRouter.POST("/api/auth/refresh", handlers.NewAuthHandler(graceService, s.todoService).Refresh)
+
+	w = s.refresh(graceRouter, expired)
+	s.Require().Equal(http.StatusOK, w.Code)
+	var response struct {
+		Data services.AuthResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	claims, err := s.jwtManager.ValidateToken(response.Data.Token)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), userID, claims.UserID)
+
+	// ...but not a token that expired before the window
+	longExpired, err := utils.NewJWTManager("test-secret", -3*time.Hour, "test").GenerateToken(userID, "refresh-expired@example.com")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), http.StatusUnauthorized, s.refresh(graceRouter, longExpired).Code)
+}
+
+// TestVerifyEmail tests the email verification flow, with logins blocked
+// until the address is verified
+func (s *AuthTestSuite) TestVerifyEmail() {
+	ctx := context.Background()
+	userRepo := repository.NewUserRepository(s.db)
+	newService := func(ttl time.Duration) (*services.AuthService, map[string]string) {
+		tokens := make(map[string]string)
+		bus := events.NewBus()
+		bus.Subscribe(events.EmailVerificationRequested, func(_ context.Context, event events.Event) {
+			verification := event.Payload.(models.EmailVerification)
+			tokens[verification.Email] = verification.Token
+		})
+		authService := services.NewAuthService(userRepo, s.jwtManager, config.SecurityConfig{
+			BcryptCost:               bcrypt.MinCost,
+			RequireEmailVerification: true,
+			EmailVerificationTTL:     ttl,
+		})
+		authService.UseEventBus(bus)
+		return authService, tokens
+	}
+	authService, tokens := newService(time.Hour)
+
+	verifyRouter := gin.New()
+	verifyRouter.GET("/api/auth/verify", handlers.NewAuthHandler(authService, s.todoService).VerifyEmail)
+	verify := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		verifyRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/verify?token="+token, nil))
+		return w
+	}
+
+	// No token is issued until the email is verified
+	registered, err := authService.Register(ctx, &services.RegisterRequest{Email: "verify@example.com", Password: "password123"})
+	s.Require().NoError(err)
+	assert.Empty(s.T(), registered.Token)
+	assert.False(s.T(), registered.User.EmailVerified)
+	s.Require().NotEmpty(tokens["verify@example.com"])
+
+	login := &services.LoginRequest{Email: "verify@example.com", Password: "password123"}
+	_, err = authService.Login(ctx, login)
+	assert.ErrorIs(s.T(), err, services.ErrEmailNotVerified)
+
+	w := verify(tokens["verify@example.com"])
+	s.Require().Equal(http.StatusOK, w.Code)
+	var response struct {
+		Data models.UserResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(s.T(), response.Data.EmailVerified)
+
+	loggedIn, err := authService.Login(ctx, login)
+	s.Require().NoError(err)
+	assert.NotEmpty(s.T(), loggedIn.Token)
+	assert.True(s.T(), loggedIn.User.EmailVerified)
+
+	// Tokens work once, and unknown tokens not at all
+	assert.Equal(s.T(), http.StatusBadRequest, verify(tokens["verify@example.com"]).Code)
+	assert.Equal(s.T(), http.StatusBadRequest, verify("not-a-token").Code)
+	assert.Equal(s.T(), http.StatusBadRequest, verify("").Code)
+
+	// Nor once expired
+	expiredService, expiredTokens := newService(-time.Minute)
+	_, err = expiredService.Register(ctx, &services.RegisterRequest{Email: "verify-expired@example.com", Password: "password123"})
+	s.Require().NoError(err)
+	assert.Equal(s.T(), http.StatusBadRequest, verify(expiredTokens["verify-expired@example.com"]).Code)
+}
+
+// TestPasswordReset tests the forgot/reset password cycle
+func (s *AuthTestSuite) TestPasswordReset() {
+	_, userID := s.registerUser("reset@example.com")
+	stale := s.staleToken(userID, "reset@example.com")
+	s.Require().Equal(http.StatusOK, s.profileStatus(stale))
+
+	newRouter := func(ttl time.Duration) (*gin.Engine, map[string]string) {
+		tokens := make(map[string]string)
+		bus := events.NewBus()
+		bus.Subscribe(events.PasswordResetRequested, func(_ context.Context, event events.Event) {
+			reset := event.Payload.(models.PasswordReset)
+			tokens[reset.Email] = reset.Token
+		})
+		authService := services.NewAuthService(repository.NewUserRepository(s.db), s.jwtManager, config.SecurityConfig{
+			BcryptCost:       bcrypt.MinCost,
+			PasswordResetTTL: ttl,
+		})
+		authService.UseEventBus(bus)
+		authHandler := handlers.NewAuthHandler(authService, s.todoService)
+
+		router := gin.New()
+		router.POST("/api/auth/forgot-password", authHandler.ForgotPassword)
+		router.POST("/api/auth/reset-password", authHandler.ResetPassword)
+		return router, tokens
+	}
+	post := func(router *gin.Engine, path string, body map[string]string) int {
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	login := func(password string) int {
+		jsonBody, _ := json.Marshal(map[string]string{"email": "reset@example.com", "password": password})
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	resetRouter, tokens := newRouter(time.Hour)
+
+	// Unknown emails get the same response, but no token
+	assert.Equal(s.T(), http.StatusOK, post(resetRouter, "/api/auth/forgot-password", map[string]string{"email": "nobody@example.com"}))
+	assert.Empty(s.T(), tokens)
+
+	s.Require().Equal(http.StatusOK, post(resetRouter, "/api/auth/forgot-password", map[string]string{"email": "reset@example.com"}))
+	token := tokens["reset@example.com"]
+	s.Require().NotEmpty(token)
+
+	// The new password must follow the registration rules
+	assert.Equal(s.T(), http.StatusBadRequest, post(resetRouter, "/api/auth/reset-password", map[string]string{"token": token, "new_password": "short"}))
+
+	s.Require().Equal(http.StatusOK, post(resetRouter, "/api/auth/reset-password", map[string]string{"token": token, "new_password": "newpassword123"}))
+	assert.Equal(s.T(), http.StatusOK, login("newpassword123"))
+	assert.Equal(s.T(), http.StatusUnauthorized, login("password123"))
+
+	// JWTs issued before the reset are revoked
+	assert.Equal(s.T(), http.StatusUnauthorized, s.profileStatus(stale))
+
+	// Tokens work once, and unknown tokens not at all
+	assert.Equal(s.T(), http.StatusBadRequest, post(resetRouter, "/api/auth/reset-password", map[string]string{"token": token, "new_password": "anotherpassword"}))
+	assert.Equal(s.T(), http.StatusBadRequest, post(resetRouter, "/api/auth/reset-password", map[string]string{"token": "not-a-token", "new_password": "anotherpassword"}))
+
+	// Nor once expired
+	expiredRouter, expiredTokens := newRouter(-time.Minute)
+	s.Require().Equal(http.StatusOK, post(expiredRouter, "/api/auth/forgot-password", map[string]string{"email": "reset@example.com"}))
+	assert.Equal(s.T(), http.StatusBadRequest, post(expiredRouter, "/api/auth/reset-password", map[string]string{"token": expiredTokens["reset@example.com"], "new_password": "anotherpassword"}))
+	assert.Equal(s.T(), http.StatusOK, login("newpassword123"))
+}
+
+// TestDeleteAccount tests that deleting an account needs the password and
+// takes the user's todos with it
+func (s *AuthTestSuite) TestDeleteAccount() {
+	ctx := context.Background()
+	token, userID := s.registerUser("delete-account@example.com")
+	_, otherID := s.registerUser("delete-account-other@example.com")
+
+	todo, err := s.todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: "Goes with the account"})
+	s.Require().NoError(err)
+	other, err := s.todoService.Create(ctx, otherID, &models.CreateTodoRequest{Title: "Stays"})
+	s.Require().NoError(err)
+
+	deleteAccount := func(password string) int {
+		jsonBody, _ := json.Marshal(map[string]string{"password": password})
+		req := httptest.NewRequest(http.MethodDelete, "/api/auth/account", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(s.T(), http.StatusUnauthorized, deleteAccount("wrong-password"))
+	assert.Equal(s.T(), http.StatusBadRequest, deleteAccount(""))
+	_, err = s.todoService.GetByID(ctx, todo.ID, userID)
+	s.Require().NoError(err)
+
+	s.Require().Equal(http.StatusOK, deleteAccount("password123"))
+
+	user, err := repository.NewUserRepository(s.db).FindByID(ctx, userID)
+	s.Require().NoError(err)
+	assert.Nil(s.T(), user)
+	_, err = s.todoService.GetByID(ctx, todo.ID, userID)
+	assert.ErrorIs(s.T(), err, services.ErrTodoNotFound)
+	var remaining int64
+	s.Require().NoError(s.db.Model(&models.Todo{}).Where("user_id = ?", userID).Count(&remaining).Error)
+	assert.Zero(s.T(), remaining)
+
+	// Other users keep their todos
+	_, err = s.todoService.GetByID(ctx, other.ID, otherID)
+	assert.NoError(s.T(), err)
+
+	// The account can't log in, and its email stays taken
+	jsonBody, _ := json.Marshal(map[string]string{"email": "delete-account@example.com", "password": "password123"})
+	for path, status := range map[string]int{"/api/auth/login": http.StatusUnauthorized, "/api/auth/register": http.StatusConflict} {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		assert.Equal(s.T(), status, w.Code, path)
+	}
+
+	// Its tokens are revoked, even where nothing checks that the user exists
+	_, err = s.jwtManager.ValidateToken(token)
+	assert.ErrorIs(s.T(), err, utils.ErrTokenRevoked)
+	assert.Equal(s.T(), http.StatusUnauthorized, s.profileStatus(token))
+	assert.Equal(s.T(), http.StatusUnauthorized, s.refresh(s.router, token).Code)
+}
+
+// TestLogout tests that a logged-out token is rejected while others still work
+func (s *AuthTestSuite) TestLogout() {
+	token, _ := s.registerUser("logout@example.com")
+	otherToken := s.loginToken("logout@example.com")
+
+	logout := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	s.Require().Equal(http.StatusOK, logout(token))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
+
+	assert.Equal(s.T(), http.StatusUnauthorized, logout(token))
+	assert.Equal(s.T(), http.StatusUnauthorized, s.refresh(s.router, token).Code)
+
+	// Other tokens for the same user are unaffected
+	profile := s.getProfile(otherToken, "/api/auth/profile")
+	assert.Equal(s.T(), "logout@example.com", profile["email"])
+}
+
+// TestTokenBlacklistPrune tests that expired entries and user cutoffs are pruned
+func (s *AuthTestSuite) TestTokenBlacklistPrune() {
+	blacklist := utils.NewTokenBlacklist(time.Hour)
+	now := time.Now()
+	blacklist.Add("expired", now.Add(-time.Second))
+	blacklist.Add("active", now.Add(time.Hour))
+
+	assert.False(s.T(), blacklist.Contains("expired"))
+	assert.True(s.T(), blacklist.Contains("active"))
+
+	blacklist.AddUser(1, now, now.Add(-time.Second))
+	blacklist.AddUser(2, now, now.Add(time.Hour))
+	assert.False(s.T(), blacklist.ContainsUser(1, now.Add(-time.Minute)))
+	assert.True(s.T(), blacklist.ContainsUser(2, now.Add(-time.Minute)))
+	assert.False(s.T(), blacklist.ContainsUser(2, now))
+
+	assert.Equal(s.T(), 2, blacklist.Prune(now))
+	assert.Equal(s.T(), 2, blacklist.Len())
+	assert.True(s.T(), blacklist.Contains("active"))
+	assert.True(s.T(), blacklist.ContainsUser(2, now.Add(-time.Minute)))
+}
+
+// TestRevokeUserSameSecond tests that revoking a user's tokens covers ones
+// issued moments before, within the same second, but not ones issued after
+func (s *AuthTestSuite) TestRevokeUserSameSecond() {
+	jwtManager := utils.NewJWTManager("test-secret", time.Hour, "test")
+	jwtManager.UseBlacklist(utils.NewTokenBlacklist(time.Minute))
+
+	before, err := jwtManager.GenerateToken(1, "same-second@example.com")
+	s.Require().NoError(err)
+	s.Require().NoError(jwtManager.RevokeUser(1, 0))
+	after, err := jwtManager.GenerateToken(1, "same-second@example.com")
+	s.Require().NoError(err)
+
+	_, err = jwtManager.ValidateToken(before)
+	assert.ErrorIs(s.T(), err, utils.ErrTokenRevoked)
+	_, err = jwtManager.ValidateToken(after)
+	assert.NoError(s.T(), err)
+}
+
+// TestChangePassword tests rotating a password
+func (s *AuthTestSuite) TestChangePassword() {
+	token, userID := s.registerUser("change-password@example.com")
+	stale := s.staleToken(userID, "change-password@example.com")
+
+	changePassword := func(current, next string) int {
+		jsonBody, _ := json.Marshal(services.ChangePasswordRequest{CurrentPassword: current, NewPassword: next})
+		req := httptest.NewRequest(http.MethodPut, "/api/auth/password", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	login := func(password string) int {
+		jsonBody, _ := json.Marshal(map[string]string{"email": "change-password@example.com", "password": password})
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(s.T(), http.StatusUnauthorized, changePassword("wrongpassword", "newpassword123"))
+	assert.Equal(s.T(), http.StatusBadRequest, changePassword("password123", "short"))
+	assert.Equal(s.T(), http.StatusOK, login("password123"))
+
+	assert.Equal(s.T(), http.StatusOK, s.profileStatus(stale))
+
+	s.Require().Equal(http.StatusOK, changePassword("password123", "newpassword123"))
+	assert.Equal(s.T(), http.StatusUnauthorized, login("password123"))
+	assert.Equal(s.T(), http.StatusOK, login("newpassword123"))
+
+	// Tokens issued before the change are revoked, including for refresh
+	assert.Equal(s.T(), http.StatusUnauthorized, s.profileStatus(stale))
+	assert.Equal(s.T(), http.StatusUnauthorized, s.refresh(s.router, stale).Code)
+}
+
+// TestGetUsage tests that usage matches the user's seeded todos
+func (s *AuthTestSuite) TestGetUsage() {
+	token, userID := s.registerUser("usage@example.com")
+	otherToken, otherID := s.registerUser("usage-other@example.com")
+	ctx := context.Background()
+
+	var created []*models.TodoResponse
+	for _, req := range []models.CreateTodoRequest{
+		{Title: "abc", Description: "de"},
+		{Title: "fghé"}, // é takes two bytes
+		{Title: "kl", Description: "mnop"},
+	} {
+		todo, err := s.todoService.Create(ctx, userID, &req)
+		s.Require().NoError(err)
+		created = append(created, todo)
+	}
+	_, err := s.todoService.SetArchived(ctx, created[0].ID, userID, true)
+	s.Require().NoError(err)
+	deleted, err := s.todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: "gone"})
+	s.Require().NoError(err)
+	s.Require().NoError(s.todoService.Delete(ctx, deleted.ID, userID))
+	_, err = s.todoService.Create(ctx, otherID, &models.CreateTodoRequest{Title: "someone else's"})
+	s.Require().NoError(err)
+
+	getUsage := func(token string) models.UsageResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/usage", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusOK, w.Code)
+
+		var response struct {
+			Data models.UsageResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	assert.Equal(s.T(), models.UsageResponse{ActiveTodos: 3, ArchivedTodos: 1, DeletedTodos: 1, TextBytes: 20}, getUsage(token))
+	assert.Equal(s.T(), models.UsageResponse{ActiveTodos: 1, TextBytes: 14}, getUsage(otherToken))
+}
+
+// loginToken logs in as a user registered by registerUser and returns a
+// new, independently revocable token
+func (s *AuthTestSuite) loginToken(email string) string {
+	jsonBody, _ := json.Marshal(map[string]string{"email": email, "password": "password123"})
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code)
+	var response struct {
+		Data services.AuthResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Data.Token
+}
+
+// staleToken signs a token for a user as if it had been issued an hour ago
+func (s *AuthTestSuite) staleToken(userID uint, email string) string {
+	issuedAt := time.Now().Add(-time.Hour)
+	claims := utils.JWTClaims{
+		UserID: userID,
+		Email:  email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			NotBefore: jwt.NewNumericDate(issuedAt),
+			Issuer:    "test",
+			ID:        "stale-" + email,
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	s.Require().NoError(err)
+	return token
+}
+
+// profileStatus returns the status of fetching the profile with token
+func (s *AuthTestSuite) profileStatus(token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w.Code
+}
+
 // TestAuthTestSuite runs the test suite
 func TestAuthTestSuite(t *testing.T) {
 	suite.Run(t, new(AuthTestSuite))
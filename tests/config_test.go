@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoadRejectsInvalidDefaultSort tests that the default sort is validated against the allowlist
+func TestLoadRejectsInvalidDefaultSort(t *testing.T) {
+	t.Setenv("TODO_DEFAULT_SORT", "password")
+
+	_, err := config.Load()
+	assert.Error(t, err)
+}
+
+// TestLoadRejectsInvalidDefaultOrder tests that the default order must be asc or desc
+func TestLoadRejectsInvalidDefaultOrder(t *testing.T) {
+	t.Setenv("TODO_DEFAULT_ORDER", "sideways")
+
+	_, err := config.Load()
+	assert.Error(t, err)
+}
+
+// TestLoadRejectsUnsupportedJWTAlgorithm tests that only HMAC algorithms can be configured
+func TestLoadRejectsUnsupportedJWTAlgorithm(t *testing.T) {
+	t.Setenv("JWT_ALGORITHM", "RS256")
+
+	_, err := config.Load()
+	assert.Error(t, err)
+}
+
+// TestLoadTrimsJWTIssuer tests that whitespace around the configured issuer is dropped
+func TestLoadTrimsJWTIssuer(t *testing.T) {
+	t.Setenv("JWT_ISSUER", " todo-api \t")
+
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "todo-api", cfg.JWT.Issuer)
+}
+
+// TestLoadRejectsRequiredAudienceWithoutClients tests that requiring a
+// token audience needs client IDs to scope tokens to
+func TestLoadRejectsRequiredAudienceWithoutClients(t *testing.T) {
+	t.Setenv("JWT_REQUIRE_AUDIENCE", "true")
+
+	_, err := config.Load()
+	assert.Error(t, err)
+
+	t.Setenv("JWT_CLIENT_IDS", "web, mobile")
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web", "mobile"}, cfg.JWT.ClientIDs)
+}
+
+// TestLoadRejectsBcryptCostOutOfRange tests that the bcrypt cost must be
+// one bcrypt accepts
+func TestLoadRejectsBcryptCostOutOfRange(t *testing.T) {
+	for _, cost := range []string{"3", "32"} {
+		t.Setenv("BCRYPT_COST", cost)
+		_, err := config.Load()
+		assert.Error(t, err, cost)
+	}
+
+	t.Setenv("BCRYPT_COST", "12")
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, 12, cfg.Security.BcryptCost)
+}
+
+// TestLoadRejectsUnknownDefaultExpansion tests that default expansions are validated
+func TestLoadRejectsUnknownDefaultExpansion(t *testing.T) {
+	t.Setenv("TODO_DEFAULT_EXPAND", "subtasks,owner")
+
+	_, err := config.Load()
+	assert.Error(t, err)
+}
+
+// TestLoadFeatures tests that features default to enabled and can be switched off
+func TestLoadFeatures(t *testing.T) {
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.True(t, cfg.Features.Enabled(config.FeatureCalendar))
+	assert.False(t, cfg.Features.Enabled("webhooks"))
+
+	t.Setenv("FEATURES", "calendar=false, History=0")
+	cfg, err = config.Load()
+	assert.NoError(t, err)
+	assert.False(t, cfg.Features.Enabled(config.FeatureCalendar))
+	assert.False(t, cfg.Features.Enabled(config.FeatureHistory))
+	assert.True(t, cfg.Features.Enabled(config.FeatureImport))
+	assert.True(t, config.DefaultFeatures.Enabled(config.FeatureCalendar))
+
+	t.Setenv("FEATURES", "webhooks=true")
+	_, err = config.Load()
+	assert.Error(t, err)
+
+	t.Setenv("FEATURES", "calendar")
+	_, err = config.Load()
+	assert.Error(t, err)
+}
+
+// TestLoadRejectsInvalidPageSizes tests that the default page size must fit under the maximum
+func TestLoadRejectsInvalidPageSizes(t *testing.T) {
+	t.Setenv("TODO_MAX_PER_PAGE", "20")
+	t.Setenv("TODO_DEFAULT_PER_PAGE", "25")
+	_, err := config.Load()
+	assert.Error(t, err)
+
+	t.Setenv("TODO_MAX_PER_PAGE", "0")
+	t.Setenv("TODO_DEFAULT_PER_PAGE", "10")
+	_, err = config.Load()
+	assert.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bhaskar/todo-api/docs"
+	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/router"
+	"github.com/bhaskar/todo-api/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// swaggerDoc holds the parts of the generated Swagger document the tests inspect
+type swaggerDoc struct {
+	Paths       map[string]map[string]json.RawMessage `json:"paths"`
+	Definitions map[string]struct {
+		Properties map[string]struct {
+			Example interface{} `json:"example"`
+		} `json:"properties"`
+	} `json:"definitions"`
+}
+
+// readSwaggerDoc parses the generated Swagger document
+func readSwaggerDoc(t *testing.T) swaggerDoc {
+	var doc swaggerDoc
+	assert.NoError(t, json.Unmarshal([]byte(docs.SwaggerInfo.ReadDoc()), &doc))
+	return doc
+}
+
+// TestSwaggerDocsCoverRoutes tests that every registered API route is documented
+func TestSwaggerDocsCoverRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	cfg.Database = config.DatabaseConfig{Host: "sqlite", DBName: ":memory:"}
+	db, err := database.Connect(&cfg.Database)
+	assert.NoError(t, err)
+
+	doc := readSwaggerDoc(t)
+	param := regexp.MustCompile(`:(\w+)`)
+	for _, route := range router.New(cfg, db).Routes() {
+		if !strings.HasPrefix(route.Path, "/api/") {
+			continue
+		}
+		path := param.ReplaceAllString(route.Path, "{$1}")
+		_, ok := doc.Paths[path][strings.ToLower(route.Method)]
+		assert.True(t, ok, "%s %s is not documented", route.Method, path)
+	}
+}
+
+// TestSwaggerDocsExamples tests that the list, create and stats schemas carry examples
+func TestSwaggerDocsExamples(t *testing.T) {
+	doc := readSwaggerDoc(t)
+
+	for definition, fields := range map[string][]string{
+		"models.CreateTodoRequest": {"title", "priority", "due_date"},
+		"models.TodoResponse":      {"id", "title", "created_at"},
+		"models.TodoListResponse":  {"total", "page", "per_page"},
+		"models.TodoStats":         {"total", "average_completion_time"},
+	} {
+		properties := doc.Definitions[definition].Properties
+		for _, field := range fields {
+			assert.NotNil(t, properties[field].Example, "%s.%s has no example", definition, field)
+		}
+	}
+}
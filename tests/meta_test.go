@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/internal/router"
+	"github.com/bhaskar/todo-api/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMetaReflectsConfig tests that the public metadata endpoint reports the
+// configured limits
+func TestMetaReflectsConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("TODO_DEFAULT_PER_PAGE", "5")
+	t.Setenv("TODO_MAX_PER_PAGE", "50")
+	t.Setenv("TODO_IMPORT_MAX_ITEMS", "200")
+	t.Setenv("TODO_DEFAULT_SORT", "due_date")
+
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	cfg.Server.EnforceHTTPS = false
+	cfg.Database = config.DatabaseConfig{Host: "sqlite", DBName: ":memory:"}
+	db, err := database.Connect(&cfg.Database)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.New(cfg, db).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/meta", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Data models.MetaResponse `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	meta := response.Data
+	assert.Equal(t, 5, meta.DefaultPerPage)
+	assert.Equal(t, 50, meta.MaxPerPage)
+	assert.Equal(t, 200, meta.MaxImportItems)
+	assert.Equal(t, "due_date", meta.DefaultSort)
+	assert.Equal(t, "desc", meta.DefaultOrder)
+	assert.Equal(t, models.MaxBulkUpdateIDs, meta.MaxBulkUpdateIDs)
+	assert.Equal(t, models.MaxBulkDeleteIDs, meta.MaxBulkDeleteIDs)
+	assert.Equal(t, 255, meta.MaxTitleLength)
+	assert.Equal(t, []string{"low", "medium", "high"}, meta.Priorities)
+	assert.Equal(t, models.TodoSortFields, meta.SortFields)
+}
@@ -0,0 +1,709 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/handlers"
+	"github.com/bhaskar/todo-api/internal/middleware"
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/internal/repository"
+	"github.com/bhaskar/todo-api/internal/router"
+	"github.com/bhaskar/todo-api/internal/services"
+	"github.com/bhaskar/todo-api/pkg/database"
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConcurrencyLimitShedsExcessRequests saturates the limiter with slow handlers
+func TestConcurrencyLimitShedsExcessRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.Use(middleware.ConcurrencyLimitMiddleware(2, 5*time.Second))
+	router.GET("/slow", func(c *gin.Context) {
+		started <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	// Occupy both slots
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		}()
+		<-started
+	}
+
+	// Next request should be shed immediately
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+
+	var response utils.APIResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.False(t, response.Success)
+	assert.Equal(t, utils.ErrCodeUnavailable, response.Error.Code)
+
+	close(release)
+	wg.Wait()
+
+	// Slots are freed once in-flight requests finish
+	go func() { <-started }()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// TestRateLimitPerClient tests that each IP and each user gets its own rate
+// limit
+func TestRateLimitPerClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middleware.RateLimitMiddleware(3, time.Hour))
+	router.Use(func(c *gin.Context) {
+		// Stands in for the auth middleware
+		if id, err := strconv.ParseUint(c.GetHeader("X-User"), 10, 64); err == nil {
+			c.Set("user_id", uint(id))
+		}
+		c.Next()
+	})
+	router.Use(middleware.UserRateLimitMiddleware(2, time.Hour))
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(ip, user string) int {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = ip + ":1234"
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// User 1 uses up their limit, even when switching IPs
+	assert.Equal(t, http.StatusOK, send("10.0.0.1", "1"))
+	assert.Equal(t, http.StatusOK, send("10.0.0.2", "1"))
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.3", "1"))
+
+	// ...without blocking another user behind the same IP
+	assert.Equal(t, http.StatusOK, send("10.0.0.1", "2"))
+
+	// Each IP is limited whoever sends from it, anonymous or not
+	assert.Equal(t, http.StatusOK, send("10.0.0.1", ""))
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.1", ""))
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.1", "3"))
+	assert.Equal(t, http.StatusOK, send("10.0.0.9", ""))
+}
+
+// TestRateLimitHeaders tests the rate limit headers and the throttled
+// response's envelope
+func TestRateLimitHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middleware.RateLimitMiddleware(2, time.Minute))
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+		return w
+	}
+
+	for _, remaining := range []string{"1", "0"} {
+		w := send()
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, remaining, w.Header().Get("X-RateLimit-Remaining"))
+		assert.Empty(t, w.Header().Get("Retry-After"))
+	}
+
+	w := send()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	// One request comes back every 30 seconds
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.True(t, retryAfter > 0 && retryAfter <= 30, "Retry-After %d", retryAfter)
+
+	var response utils.APIResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.False(t, response.Success)
+	if assert.NotNil(t, response.Error) {
+		assert.Equal(t, utils.ErrCodeRateLimited, response.Error.Code)
+		assert.NotEmpty(t, response.Error.Message)
+	}
+}
+
+// TestRateLimiterRefills tests that spent tokens come back over the window
+func TestRateLimiterRefills(t *testing.T) {
+	now := time.Now()
+	limiter := middleware.NewRateLimiter(2, time.Minute)
+	limiter.UseClock(func() time.Time { return now })
+
+	assert.True(t, limiter.Allow("key"))
+	assert.True(t, limiter.Allow("key"))
+	allowed, _, retryAfter := limiter.Take("key")
+	assert.False(t, allowed)
+	assert.Equal(t, 30*time.Second, retryAfter)
+
+	// Half a window later one of the two tokens is back
+	now = now.Add(30 * time.Second)
+	assert.True(t, limiter.Allow("key"))
+	assert.False(t, limiter.Allow("key"))
+}
+
+// TestShutdownRejectsNewRequests tests that requests arriving after shutdown
+// begins get a 503 while in-flight ones finish
+func TestShutdownRejectsNewRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var shuttingDown atomic.Bool
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	r := gin.New()
+	r.Use(middleware.ShutdownMiddleware(&shuttingDown, 5*time.Second))
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	inFlight := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.ServeHTTP(inFlight, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-started
+
+	shuttingDown.Store(true)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+	var response utils.APIResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, utils.ErrCodeUnavailable, response.Error.Code)
+
+	close(release)
+	<-done
+	assert.Equal(t, http.StatusOK, inFlight.Code)
+
+	// The full router applies the flag ahead of everything else
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	cfg.Server.EnforceHTTPS = false
+	cfg.Server.ShutdownRetryAfter = 2 * time.Second
+	cfg.Database = config.DatabaseConfig{Host: "sqlite", DBName: ":memory:"}
+	db, err := database.Connect(&cfg.Database)
+	assert.NoError(t, err)
+
+	var engineShuttingDown atomic.Bool
+	engine := router.New(cfg, db, router.WithShutdownFlag(&engineShuttingDown))
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	engineShuttingDown.Store(true)
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+}
+
+// TestNegotiate tests choosing a response type from the Accept header
+func TestNegotiate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(middleware.Negotiate(middleware.MIMEJSON, middleware.MIMECSV))
+	r.GET("/todos", func(c *gin.Context) {
+		c.String(http.StatusOK, middleware.NegotiatedType(c))
+	})
+
+	tests := []struct {
+		accept string
+		code   int
+		chosen string
+	}{
+		{"", http.StatusOK, middleware.MIMEJSON},
+		{"application/json", http.StatusOK, middleware.MIMEJSON},
+		{"text/csv", http.StatusOK, middleware.MIMECSV},
+		{"Text/CSV; charset=utf-8", http.StatusOK, middleware.MIMECSV},
+		{"text/csv;q=0.5, application/json;q=0.9", http.StatusOK, middleware.MIMEJSON},
+		{"text/*, application/json;q=0.1", http.StatusOK, middleware.MIMECSV},
+		{"*/*", http.StatusOK, middleware.MIMEJSON},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", http.StatusOK, middleware.MIMEJSON},
+		{"application/xml", http.StatusNotAcceptable, ""},
+		{"application/json;q=0, text/csv;q=0", http.StatusNotAcceptable, ""},
+		{"*/*, application/json;q=0", http.StatusOK, middleware.MIMECSV},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code, tt.accept)
+		if tt.code == http.StatusOK {
+			assert.Equal(t, tt.chosen, w.Body.String(), tt.accept)
+			continue
+		}
+		var response utils.APIResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, utils.ErrCodeNotAcceptable, response.Error.Code)
+		assert.Contains(t, response.Error.Message, middleware.MIMECSV)
+	}
+}
+
+// TestExtractCredential tests Authorization header parsing
+func TestExtractCredential(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		scheme string
+		value  string
+		ok     bool
+	}{
+		{"bearer token", "Bearer x", "Bearer", "x", true},
+		{"lowercase scheme with extra space", "bearer  x", "bearer", "x", true},
+		{"surrounding whitespace", "  ApiKey\tabc123  ", "ApiKey", "abc123", true},
+		{"missing scheme", "x", "", "", false},
+		{"empty header", "", "", "", false},
+		{"too many parts", "Bearer x y", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme, value, ok := middleware.ExtractCredential(tt.header)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.scheme, scheme)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+}
+
+// TestRecoveryReturnsJSONEnvelope tests that panics produce the standard error body
+func TestRecoveryReturnsJSONEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middleware.Logger())
+	router.Use(middleware.Recovery(false))
+	router.GET("/panic", func(c *gin.Context) {
+		panic("something broke")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var response utils.APIResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.False(t, response.Success)
+	assert.Equal(t, utils.ErrCodeInternal, response.Error.Code)
+	assert.Nil(t, response.Error.Details)
+	assert.NotContains(t, w.Body.String(), "something broke")
+	assert.NotContains(t, w.Body.String(), "goroutine")
+}
+
+// TestAuthMiddlewareSkipsPublicPaths tests that configured public paths bypass auth
+func TestAuthMiddlewareSkipsPublicPaths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwtManager := utils.NewJWTManager("test-secret", time.Hour, "test")
+	public := middleware.PublicPaths{"/api/status", "/api/docs/*", "/api/items/:id"}
+
+	router := gin.New()
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddlewareWithPublicPaths(jwtManager, public))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.GET("/status", ok)
+	api.GET("/docs/*any", ok)
+	api.GET("/items/:id", ok)
+	api.GET("/private", ok)
+	api.GET("/statuses", ok)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/api/status", http.StatusOK},
+		{"/api/docs/index.html", http.StatusOK},
+		{"/api/items/42", http.StatusOK},
+		{"/api/private", http.StatusUnauthorized},
+		{"/api/statuses", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		assert.Equal(t, tt.code, w.Code, tt.path)
+	}
+
+	// Protected paths still accept a valid token
+	token, err := jwtManager.GenerateToken(1, "public@example.com")
+	assert.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/api/private", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// TestQueryCountLogsQueriesPerRequest tests that the logger reports each request's query count
+func TestQueryCountLogsQueriesPerRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := database.Connect(&config.DatabaseConfig{Host: "sqlite", DBName: ":memory:", CountQueries: true})
+	assert.NoError(t, err)
+	assert.NoError(t, database.Migrate(db))
+
+	router := gin.New()
+	router.Use(middleware.Logger())
+	router.Use(middleware.QueryCount())
+	router.GET("/queries", func(c *gin.Context) {
+		var count int64
+		for i := 0; i < 3; i++ {
+			db.WithContext(c.Request.Context()).Model(&models.Todo{}).Count(&count)
+		}
+		c.Status(http.StatusOK)
+	})
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/queries", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, buf.String(), "| 3 queries")
+}
+
+// TestLoggerRedactsTokens tests that token query parameters are kept out of
+// the access log
+func TestLoggerRedactsTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middleware.Logger())
+	router.GET("/api/auth/verify", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/auth/verify?token=s3cret&lang=en", nil))
+
+	assert.NotContains(t, buf.String(), "s3cret")
+	assert.Contains(t, buf.String(), "token=REDACTED&lang=en")
+}
+
+// TestRequestLoggerIncludesRequestID tests that handler error logs carry the request ID
+func TestRequestLoggerIncludesRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := database.Connect(&config.DatabaseConfig{Host: "sqlite", DBName: ":memory:"})
+	assert.NoError(t, err)
+	assert.NoError(t, database.Migrate(db))
+	todoService := services.NewTodoService(repository.NewTodoRepository(db), repository.NewUserRepository(db), config.TodoConfig{})
+	todoHandler := handlers.NewTodoHandler(todoService, config.TodoConfig{})
+
+	// A closed connection makes the handler fail with an internal error
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	assert.NoError(t, sqlDB.Close())
+
+	router := gin.New()
+	router.Use(middleware.Logger())
+	router.GET("/api/todos", func(c *gin.Context) {
+		c.Set("user_id", uint(1))
+		todoHandler.List(c)
+	})
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/todos", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "closed")
+
+	var errorLine string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, "ERROR: Failed to fetch todos") {
+			errorLine = line
+		}
+	}
+	assert.Contains(t, errorLine, "[req-42] ")
+	assert.Contains(t, errorLine, "database is closed")
+}
+
+// TestLoggerCustomRequestIDHeader tests reading and echoing a configured request ID header
+func TestLoggerCustomRequestIDHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		RequestIDHeader:          "X-Correlation-ID",
+		FallbackRequestIDHeaders: []string{"X-Request-ID"},
+	}))
+	router.GET("/id", func(c *gin.Context) {
+		c.String(http.StatusOK, middleware.GetRequestID(c))
+	})
+
+	// Read from and echoed in the configured header
+	req := httptest.NewRequest(http.MethodGet, "/id", nil)
+	req.Header.Set("X-Correlation-ID", "corr-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "corr-123", w.Header().Get("X-Correlation-ID"))
+	assert.Equal(t, "corr-123", w.Body.String())
+	assert.Empty(t, w.Header().Get("X-Request-ID"))
+
+	// Falls back to other headers, still echoed in the configured one
+	req = httptest.NewRequest(http.MethodGet, "/id", nil)
+	req.Header.Set("X-Request-ID", "req-456")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "req-456", w.Header().Get("X-Correlation-ID"))
+
+	// Generated when absent or unsafe to log
+	req = httptest.NewRequest(http.MethodGet, "/id", nil)
+	req.Header.Set("X-Correlation-ID", "bad id\nforged log line")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Len(t, w.Header().Get("X-Correlation-ID"), 36)
+}
+
+// TestMaxQueryLength tests that overly long query strings are rejected with 414
+func TestMaxQueryLength(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middleware.MaxQueryLengthMiddleware(16))
+	router.GET("/search", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// "ids=" plus 12 bytes is exactly at the limit
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?ids="+strings.Repeat("1", 12), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?ids="+strings.Repeat("1", 13), nil))
+	assert.Equal(t, http.StatusRequestURITooLong, w.Code)
+
+	var response utils.APIResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, utils.ErrCodeURITooLong, response.Error.Code)
+}
+
+// TestMaxHeaders tests that too many or too large headers are rejected with 431
+func TestMaxHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middleware.MaxHeadersMiddleware(10, 256))
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	withHeaders := func(n int, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		for i := 0; i < n; i++ {
+			req.Header.Add(fmt.Sprintf("X-Custom-%d", i), value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, withHeaders(10, "v").Code)
+
+	w := withHeaders(50, "v")
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, w.Code)
+	var response utils.APIResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, utils.ErrCodeHeaders, response.Error.Code)
+
+	// Few headers can still exceed the size limit
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, withHeaders(1, strings.Repeat("x", 300)).Code)
+}
+
+// TestRequestSigning tests that signed requests are accepted once, and stale
+// or replayed ones are rejected
+func TestRequestSigning(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := []byte("signing-secret")
+
+	router := gin.New()
+	router.Use(middleware.RequireSignedRequest(secret, time.Minute, middleware.NewNonceCache()))
+	router.POST("/admin/action", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+
+	send := func(timestamp time.Time, nonce, signedBody, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/action?x=1", strings.NewReader(body))
+		req.Header.Set(middleware.SignatureTimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+		req.Header.Set(middleware.SignatureNonceHeader, nonce)
+		req.Header.Set(middleware.SignatureHeader, middleware.RequestSignature(secret, http.MethodPost, "/admin/action?x=1", timestamp.Unix(), nonce, []byte(signedBody)))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A fresh request is accepted and its body still reaches the handler
+	w := send(time.Now(), "nonce-1", "payload", "payload")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "payload", w.Body.String())
+
+	// Replaying the same nonce is rejected
+	w = send(time.Now(), "nonce-1", "payload", "payload")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "already been used")
+
+	// Stale and future timestamps are rejected
+	w = send(time.Now().Add(-2*time.Minute), "nonce-2", "payload", "payload")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "outside the allowed window")
+	assert.Equal(t, http.StatusUnauthorized, send(time.Now().Add(2*time.Minute), "nonce-3", "payload", "payload").Code)
+
+	// A tampered body fails verification
+	assert.Equal(t, http.StatusUnauthorized, send(time.Now(), "nonce-4", "payload", "tampered").Code)
+
+	// Unsigned requests are rejected
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/action", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// TestHTTPSEnforcement tests HSTS and redirects for the production router
+func TestHTTPSEnforcement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("ENVIRONMENT", "production")
+
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.True(t, cfg.Server.EnforceHTTPS)
+	cfg.Database = config.DatabaseConfig{Host: "sqlite", DBName: ":memory:"}
+
+	db, err := database.Connect(&cfg.Database)
+	assert.NoError(t, err)
+	engine := router.New(cfg, db)
+
+	// HTTPS requests are served with HSTS
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+
+	// Forwarded plain-HTTP reads are redirected
+	req = httptest.NewRequest(http.MethodGet, "/health?probe=1", nil)
+	req.Host = "todo.example.com"
+	req.Header.Set("X-Forwarded-Proto", "http")
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "https://todo.example.com/health?probe=1", w.Header().Get("Location"))
+
+	// Forwarded plain-HTTP writes are rejected
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+	req.Header.Set("X-Forwarded-Proto", "http")
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestHTTPSNotEnforcedInDevelopment tests that development mode skips HSTS
+func TestHTTPSNotEnforcedInDevelopment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("ENVIRONMENT", "development")
+
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	cfg.Database = config.DatabaseConfig{Host: "sqlite", DBName: ":memory:"}
+
+	db, err := database.Connect(&cfg.Database)
+	assert.NoError(t, err)
+	engine := router.New(cfg, db)
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Forwarded-Proto", "http")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+}
+
+// TestSwaggerToggle tests that the Swagger route is only mounted when enabled
+func TestSwaggerToggle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		environment string
+		code        int
+	}{
+		{"development", http.StatusOK},
+		{"production", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.environment, func(t *testing.T) {
+			t.Setenv("ENVIRONMENT", tt.environment)
+
+			cfg, err := config.Load()
+			assert.NoError(t, err)
+			cfg.Server.EnforceHTTPS = false
+			cfg.Database = config.DatabaseConfig{Host: "sqlite", DBName: ":memory:"}
+
+			db, err := database.Connect(&cfg.Database)
+			assert.NoError(t, err)
+			engine := router.New(cfg, db)
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger/index.html", nil))
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/models"
+	"github.com/bhaskar/todo-api/internal/repository"
+	"github.com/bhaskar/todo-api/internal/services"
+	"github.com/bhaskar/todo-api/pkg/database"
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// transientError mimics a driver error carrying a retryable SQLSTATE
+type transientError struct{ code string }
+
+func (e *transientError) Error() string    { return "transient error " + e.code }
+func (e *transientError) SQLState() string { return e.code }
+
+// failCreates makes the next n creates fail with err, counting every attempt
+func failCreates(t *testing.T, db *gorm.DB, n int, err error) *int {
+	attempts := 0
+	name := "test:fail_creates"
+	assert.NoError(t, db.Callback().Create().Before("gorm:create").Register(name, func(tx *gorm.DB) {
+		attempts++
+		if attempts <= n {
+			tx.AddError(err)
+		}
+	}))
+	t.Cleanup(func() { _ = db.Callback().Create().Remove(name) })
+	return &attempts
+}
+
+// TestWriteRetriesTransientError tests that a write succeeds on the attempt after a transient error
+func TestWriteRetriesTransientError(t *testing.T) {
+	db, err := database.Connect(&config.DatabaseConfig{Host: "sqlite", DBName: ":memory:"})
+	assert.NoError(t, err)
+	assert.NoError(t, database.Migrate(db))
+
+	attempts := failCreates(t, db, 1, &transientError{code: "40001"})
+	todoRepo := repository.NewTodoRepository(db, repository.WithWriteRetries(2))
+
+	todo := &models.Todo{Title: "Retried", UserID: 1}
+	assert.NoError(t, todoRepo.Create(context.Background(), todo))
+	assert.Equal(t, 2, *attempts)
+	assert.NotZero(t, todo.ID)
+}
+
+// TestWriteRetriesSkipPermanentErrors tests that non-transient errors are returned immediately
+func TestWriteRetriesSkipPermanentErrors(t *testing.T) {
+	db, err := database.Connect(&config.DatabaseConfig{Host: "sqlite", DBName: ":memory:"})
+	assert.NoError(t, err)
+	assert.NoError(t, database.Migrate(db))
+
+	attempts := failCreates(t, db, 1, &transientError{code: "23505"})
+	todoRepo := repository.NewTodoRepository(db, repository.WithWriteRetries(2))
+
+	assert.Error(t, todoRepo.Create(context.Background(), &models.Todo{Title: "Not retried", UserID: 1}))
+	assert.Equal(t, 1, *attempts)
+}
+
+// TestExternalIDScopes tests that external IDs may be shared between users
+// only in the user scope, and that deleted todos don't hold on to theirs
+func TestExternalIDScopes(t *testing.T) {
+	ctx := context.Background()
+	for _, scope := range models.ExternalIDScopes {
+		name := "external-id-" + scope
+		_ = os.Remove(name + ".db")
+		db, err := database.Connect(&config.DatabaseConfig{Host: "sqlite", DBName: name})
+		assert.NoError(t, err)
+		assert.NoError(t, database.Migrate(db))
+		assert.NoError(t, database.ApplyExternalIDScope(db, scope))
+
+		todoService := services.NewTodoService(repository.NewTodoRepository(db), repository.NewUserRepository(db), config.TodoConfig{})
+		externalID := "shared-1"
+		_, err = todoService.Create(ctx, 1, &models.CreateTodoRequest{Title: "First", ExternalID: &externalID})
+		assert.NoError(t, err, scope)
+
+		// The owner can still upsert its own todo
+		_, created, err := todoService.UpsertByExternalID(ctx, 1, externalID, &models.UpsertTodoRequest{Title: "First again"})
+		assert.NoError(t, err, scope)
+		assert.False(t, created, scope)
+
+		_, createErr := todoService.Create(ctx, 2, &models.CreateTodoRequest{Title: "Second", ExternalID: &externalID})
+		_, _, upsertErr := todoService.UpsertByExternalID(ctx, 3, externalID, &models.UpsertTodoRequest{Title: "Third"})
+		if scope == models.ExternalIDScopeGlobal {
+			assert.ErrorIs(t, createErr, services.ErrExternalIDConflict)
+			assert.ErrorIs(t, upsertErr, services.ErrExternalIDConflict)
+		} else {
+			assert.NoError(t, createErr)
+			assert.NoError(t, upsertErr)
+		}
+
+		// Once deleted, the ID is free again in either scope
+		first, err := todoService.GetByExternalID(ctx, externalID, 1)
+		assert.NoError(t, err, scope)
+		assert.NoError(t, todoService.Delete(ctx, first.ID, 1), scope)
+		_, created, err = todoService.UpsertByExternalID(ctx, 4, externalID, &models.UpsertTodoRequest{Title: "Fourth"})
+		assert.NoError(t, err, scope)
+		assert.True(t, created, scope)
+
+		assert.NoError(t, database.Close(db))
+		_ = os.Remove(name + ".db")
+	}
+}
+
+// TestListByUserIDSearch tests matching search terms against title and
+// description, combined with the completed filter and pagination counts
+func TestListByUserIDSearch(t *testing.T) {
+	ctx := context.Background()
+	_ = os.Remove("search.db")
+	db, err := database.Connect(&config.DatabaseConfig{Host: "sqlite", DBName: "search"})
+	assert.NoError(t, err)
+	assert.NoError(t, database.Migrate(db))
+	defer func() {
+		assert.NoError(t, database.Close(db))
+		_ = os.Remove("search.db")
+	}()
+
+	todoRepo := repository.NewTodoRepository(db)
+	todos := []models.Todo{
+		{UserID: 1, Title: "Buy groceries", Description: "Milk and eggs"},
+		{UserID: 1, Title: "Call mom", Description: "About the GROCERIES list", Completed: true},
+		{UserID: 1, Title: "Write report", Description: "Quarterly numbers"},
+		{UserID: 1, Title: "100% done", Description: "Literal percent"},
+		{UserID: 2, Title: "Groceries for someone else"},
+	}
+	for i := range todos {
+		assert.NoError(t, todoRepo.Create(ctx, &todos[i]))
+	}
+
+	offset := 0
+	list := func(search string, completed *bool, perPage int) *models.TodoListResponse {
+		result, err := todoRepo.ListByUserID(ctx, 1, models.TodoListOptions{
+			Page: 1, PerPage: perPage, Offset: &offset,
+			Search: search, Completed: completed, Sort: "created_at", Order: "asc",
+		})
+		assert.NoError(t, err)
+		return result
+	}
+	titles := func(result *models.TodoListResponse) []string {
+		var titles []string
+		for _, todo := range result.Todos {
+			titles = append(titles, todo.Title)
+		}
+		return titles
+	}
+
+	// Title and description match, case-insensitively, only for the user
+	assert.Equal(t, []string{"Buy groceries", "Call mom"}, titles(list("groceries", nil, 10)))
+	assert.Equal(t, []string{"Write report"}, titles(list("QUARTERLY", nil, 10)))
+	assert.Empty(t, list("vacation", nil, 10).Todos)
+
+	// Wildcards match literally
+	assert.Equal(t, []string{"100% done"}, titles(list("%", nil, 10)))
+	assert.Empty(t, list("_x", nil, 10).Todos)
+
+	// Combined with the completed filter
+	pending := false
+	assert.Equal(t, []string{"Buy groceries"}, titles(list("groceries", &pending, 10)))
+
+	// Counts cover the whole search, not the page
+	result := list("groceries", nil, 1)
+	assert.Len(t, result.Todos, 1)
+	assert.Equal(t, int64(2), result.Total)
+	assert.Equal(t, 2, result.TotalPages)
+}
+
+// TestRestore tests that a soft-deleted todo can be restored by its owner only
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	_ = os.Remove("restore.db")
+	db, err := database.Connect(&config.DatabaseConfig{Host: "sqlite", DBName: "restore"})
+	assert.NoError(t, err)
+	assert.NoError(t, database.Migrate(db))
+	defer func() {
+		assert.NoError(t, database.Close(db))
+		_ = os.Remove("restore.db")
+	}()
+
+	todoRepo := repository.NewTodoRepository(db)
+	todo := &models.Todo{UserID: 1, Title: "Deleted by mistake"}
+	assert.NoError(t, todoRepo.Create(ctx, todo))
+
+	offset := 0
+	listed := func() int64 {
+		result, err := todoRepo.ListByUserID(ctx, 1, models.TodoListOptions{
+			Page: 1, PerPage: 10, Offset: &offset, Sort: "created_at", Order: "asc",
+		})
+		assert.NoError(t, err)
+		return result.Total
+	}
+
+	// Only deleted todos can be restored
+	assert.ErrorIs(t, todoRepo.Restore(ctx, todo.ID, 1, &models.AuditLog{}), gorm.ErrRecordNotFound)
+
+	assert.NoError(t, todoRepo.DeleteByIDAndUserID(ctx, todo.ID, 1))
+	assert.Equal(t, int64(0), listed())
+
+	assert.ErrorIs(t, todoRepo.Restore(ctx, todo.ID, 2, &models.AuditLog{}), gorm.ErrRecordNotFound)
+	assert.NoError(t, todoRepo.Restore(ctx, todo.ID, 1, &models.AuditLog{}))
+	assert.Equal(t, int64(1), listed())
+
+	// Hard-deleted todos are gone for good
+	assert.NoError(t, todoRepo.HardDelete(ctx, todo.ID))
+	assert.ErrorIs(t, todoRepo.Restore(ctx, todo.ID, 1, &models.AuditLog{}), gorm.ErrRecordNotFound)
+}
+
+// TestNormalizeStoredEmails tests that accounts stored with mixed-case emails
+// can still log in, and can't be duplicated, once stored emails are normalized
+func TestNormalizeStoredEmails(t *testing.T) {
+	ctx := context.Background()
+	_ = os.Remove("normalize-emails.db")
+	db, err := database.Connect(&config.DatabaseConfig{Host: "sqlite", DBName: "normalize-emails"})
+	assert.NoError(t, err)
+	assert.NoError(t, database.Migrate(db))
+	defer func() {
+		assert.NoError(t, database.Close(db))
+		_ = os.Remove("normalize-emails.db")
+	}()
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	legacy := &models.User{Email: "Legacy.User@Example.com", Password: string(hashed)}
+	assert.NoError(t, db.Create(legacy).Error)
+
+	assert.NoError(t, database.NormalizeEmails(db))
+	assert.NoError(t, database.NormalizeEmails(db))
+
+	authService := services.NewAuthService(repository.NewUserRepository(db), utils.NewJWTManager("test-secret", time.Hour, "test"), config.SecurityConfig{
+		BcryptCost:      bcrypt.MinCost,
+		NormalizeEmails: true,
+	})
+	loggedIn, err := authService.Login(ctx, &services.LoginRequest{Email: "Legacy.User@Example.com", Password: "password123"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, loggedIn) {
+		assert.Equal(t, legacy.ID, loggedIn.User.ID)
+	}
+	_, err = authService.Register(ctx, &services.RegisterRequest{Email: "legacy.user@example.com", Password: "password123"})
+	assert.EqualError(t, err, "email already registered")
+
+	// Emails that only differ in case can't both be kept
+	assert.NoError(t, db.Create(&models.User{Email: "LEGACY.USER@example.com", Password: string(hashed)}).Error)
+	assert.ErrorContains(t, database.NormalizeEmails(db), "legacy.user@example.com")
+}
+
+// TestSearchResultWindow tests that searches matching more todos than the
+// result window are capped and reported as truncated
+func TestSearchResultWindow(t *testing.T) {
+	ctx := context.Background()
+	_ = os.Remove("search-window.db")
+	db, err := database.Connect(&config.DatabaseConfig{Host: "sqlite", DBName: "search-window"})
+	assert.NoError(t, err)
+	assert.NoError(t, database.Migrate(db))
+	defer func() {
+		assert.NoError(t, database.Close(db))
+		_ = os.Remove("search-window.db")
+	}()
+
+	todoRepo := repository.NewTodoRepository(db)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, todoRepo.Create(ctx, &models.Todo{UserID: 1, Title: fmt.Sprintf("Match %d", i)}))
+	}
+	assert.NoError(t, todoRepo.Create(ctx, &models.Todo{UserID: 1, Title: "Other"}))
+
+	list := func(offset, perPage, maxResults int) *models.TodoListResponse {
+		result, err := todoRepo.ListByUserID(ctx, 1, models.TodoListOptions{
+			Page: offset/perPage + 1, PerPage: perPage, Offset: &offset,
+			Search: "match", MaxResults: maxResults, Sort: "title", Order: "asc",
+		})
+		assert.NoError(t, err)
+		return result
+	}
+
+	result := list(0, 2, 3)
+	assert.True(t, result.Truncated)
+	assert.NotEmpty(t, result.Warning)
+	assert.Equal(t, int64(3), result.Total)
+	assert.Equal(t, 2, result.TotalPages)
+	assert.Len(t, result.Todos, 2)
+
+	// Pages stop at the window's edge
+	result = list(2, 2, 3)
+	assert.Len(t, result.Todos, 1)
+	assert.Equal(t, "Match 2", result.Todos[0].Title)
+	assert.Empty(t, list(4, 2, 3).Todos)
+
+	// A window the matches fit in, or none at all, isn't truncated
+	for _, maxResults := range []int{5, 0} {
+		result = list(0, 10, maxResults)
+		assert.False(t, result.Truncated)
+		assert.Empty(t, result.Warning)
+		assert.Equal(t, int64(5), result.Total)
+		assert.Len(t, result.Todos, 5)
+	}
+}
+
+// TestListByUserIDStableOrder tests that paging through todos with equal
+// sort values visits each todo exactly once
+func TestListByUserIDStableOrder(t *testing.T) {
+	ctx := context.Background()
+	_ = os.Remove("stable-order.db")
+	db, err := database.Connect(&config.DatabaseConfig{Host: "sqlite", DBName: "stable-order"})
+	assert.NoError(t, err)
+	assert.NoError(t, database.Migrate(db))
+	defer func() {
+		assert.NoError(t, database.Close(db))
+		_ = os.Remove("stable-order.db")
+	}()
+
+	// Mostly equal priorities, due dates and creation times
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	due := created.Add(48 * time.Hour)
+	todos := make([]models.Todo, 23)
+	for i := range todos {
+		todos[i] = models.Todo{UserID: 1, Title: "Same", Priority: "medium", DueDate: &due, CreatedAt: created}
+		if i%7 == 0 {
+			todos[i].Priority = "high"
+		}
+	}
+	assert.NoError(t, db.Create(&todos).Error)
+
+	todoRepo := repository.NewTodoRepository(db)
+	for _, sort := range []string{"priority", "due_date", "created_at", "title"} {
+		for _, order := range []string{"asc", "desc"} {
+			seen := make(map[uint]bool)
+			for offset := 0; offset < len(todos); offset += 4 {
+				result, err := todoRepo.ListByUserID(ctx, 1, models.TodoListOptions{
+					Page: offset/4 + 1, PerPage: 4, Offset: &offset, Sort: sort, Order: order,
+				})
+				assert.NoError(t, err)
+				for _, todo := range result.Todos {
+					assert.False(t, seen[todo.ID], "%s %s: todo %d repeated", sort, order, todo.ID)
+					seen[todo.ID] = true
+				}
+			}
+			assert.Len(t, seen, len(todos), "%s %s", sort, order)
+		}
+	}
+}
@@ -2,14 +2,20 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/bhaskar/todo-api/internal/config"
+	"github.com/bhaskar/todo-api/internal/events"
 	"github.com/bhaskar/todo-api/internal/handlers"
 	"github.com/bhaskar/todo-api/internal/middleware"
 	"github.com/bhaskar/todo-api/internal/models"
@@ -20,6 +26,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // TodoTestSuite is the test suite for todo endpoints
@@ -29,6 +37,7 @@ type TodoTestSuite struct {
 	todoHandler *handlers.TodoHandler
 	authHandler *handlers.AuthHandler
 	jwtManager  *utils.JWTManager
+	db          *gorm.DB
 	authToken   string
 }
 
@@ -45,6 +54,7 @@ func (s *TodoTestSuite) SetupSuite() {
 	db, err := database.Connect(cfg)
 	s.Require().NoError(err)
 	s.Require().NoError(database.Migrate(db))
+	s.db = db
 
 	// Setup JWT manager
 	s.jwtManager = utils.NewJWTManager("test-secret", time.Hour, "test")
@@ -52,39 +62,71 @@ func (s *TodoTestSuite) SetupSuite() {
 	// Setup repositories and services
 	userRepo := repository.NewUserRepository(db)
 	todoRepo := repository.NewTodoRepository(db)
-	authService := services.NewAuthService(userRepo, s.jwtManager)
-	todoService := services.NewTodoService(todoRepo)
+	authService := services.NewAuthService(userRepo, s.jwtManager, config.SecurityConfig{BcryptCost: bcrypt.DefaultCost})
+	todoConfig := config.TodoConfig{ImportMaxItems: 5}
+	todoService := services.NewTodoService(todoRepo, userRepo, todoConfig)
 
-	s.authHandler = handlers.NewAuthHandler(authService)
-	s.todoHandler = handlers.NewTodoHandler(todoService)
+	s.authHandler = handlers.NewAuthHandler(authService, todoService)
+	s.todoHandler = handlers.NewTodoHandler(todoService, todoConfig)
 
 	// Setup router
 	s.router = gin.New()
-	
+
 	// Auth routes
 	s.router.POST("/api/auth/register", s.authHandler.Register)
 	s.router.POST("/api/auth/login", s.authHandler.Login)
+	s.router.PUT("/api/auth/preferences", middleware.AuthMiddleware(s.jwtManager), s.authHandler.UpdatePreferences)
+	s.router.POST("/api/auth/feed-token", middleware.AuthMiddleware(s.jwtManager), s.authHandler.GenerateFeedToken)
+	s.router.DELETE("/api/auth/feed-token", middleware.AuthMiddleware(s.jwtManager), s.authHandler.RevokeFeedToken)
+	s.router.GET("/api/todos/calendar/:token", s.todoHandler.CalendarFeed)
 
 	// Protected todo routes
 	protected := s.router.Group("/api/todos")
-	protected.Use(middleware.AuthMiddleware(s.jwtManager))
+	protected.Use(middleware.AuthMiddleware(s.jwtManager), middleware.LoadUser(authService))
 	{
 		protected.POST("", s.todoHandler.Create)
 		protected.GET("", s.todoHandler.List)
+		protected.POST("/import", s.todoHandler.Import)
+		protected.POST("/exists", s.todoHandler.Exists)
+		protected.PATCH("/bulk", s.todoHandler.BulkComplete)
+		protected.DELETE("/bulk", s.todoHandler.BulkDelete)
+		protected.POST("/bulk/priority", s.todoHandler.BulkSetPriority)
 		protected.GET("/stats", s.todoHandler.GetStats)
+		protected.GET("/velocity", s.todoHandler.GetVelocity)
+		protected.GET("/completed-today", s.todoHandler.CompletedToday)
+		protected.DELETE("/completed", s.todoHandler.ClearCompleted)
+		protected.GET("/tree", s.todoHandler.Tree)
+		protected.GET("/calendar.ics", s.todoHandler.Calendar)
+		protected.GET("/external/:externalID", s.todoHandler.GetByExternalID)
+		protected.PUT("/external/:externalID", s.todoHandler.UpsertByExternalID)
 		protected.GET("/:id", s.todoHandler.GetByID)
 		protected.PUT("/:id", s.todoHandler.Update)
 		protected.DELETE("/:id", s.todoHandler.Delete)
+		protected.POST("/:id/archive", s.todoHandler.Archive)
+		protected.POST("/:id/unarchive", s.todoHandler.Unarchive)
+		protected.POST("/:id/restore", s.todoHandler.Restore)
+		protected.GET("/:id/history", s.todoHandler.History)
+		protected.GET("/:id/history/diff", s.todoHandler.HistoryDiff)
 	}
 
 	// Register and login to get auth token
 	s.setupTestUser()
 }
 
+// newTodoService builds a todo service with a custom configuration
+func (s *TodoTestSuite) newTodoService(cfg config.TodoConfig) *services.TodoService {
+	return services.NewTodoService(repository.NewTodoRepository(s.db), repository.NewUserRepository(s.db), cfg)
+}
+
 // setupTestUser creates a test user and gets auth token
 func (s *TodoTestSuite) setupTestUser() {
+	s.authToken, _ = s.registerUser("todotest@example.com")
+}
+
+// registerUser registers a user and returns its auth token and ID
+func (s *TodoTestSuite) registerUser(email string) (string, uint) {
 	body := map[string]string{
-		"email":    "todotest@example.com",
+		"email":    email,
 		"password": "password123",
 	}
 	jsonBody, _ := json.Marshal(body)
@@ -96,11 +138,14 @@ func (s *TodoTestSuite) setupTestUser() {
 
 	var response struct {
 		Data struct {
+			User struct {
+				ID uint `json:"id"`
+			} `json:"user"`
 			Token string `json:"token"`
 		} `json:"data"`
 	}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	s.authToken = response.Data.Token
+	return response.Data.Token, response.Data.User.ID
 }
 
 // TestCreateTodo tests creating a new todo
@@ -127,6 +172,279 @@ func (s *TodoTestSuite) TestCreateTodo() {
 	assert.True(s.T(), response.Success)
 }
 
+// TestCreateTodoReportsAppliedDefaults tests the defaults header when priority is omitted
+func (s *TodoTestSuite) TestCreateTodoReportsAppliedDefaults() {
+	jsonBody, _ := json.Marshal(models.CreateTodoRequest{Title: "Defaults Test"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/todos", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.authToken)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusCreated, w.Code)
+	assert.Equal(s.T(), "priority,completed", w.Header().Get("X-Applied-Defaults"))
+
+	var response struct {
+		Data models.TodoResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(s.T(), models.DefaultPriority, response.Data.Priority)
+	assert.False(s.T(), response.Data.Completed)
+}
+
+// TestCreateTodoWithPriorityOmitsPriorityDefault tests that a supplied priority isn't reported as defaulted
+func (s *TodoTestSuite) TestCreateTodoWithPriorityOmitsPriorityDefault() {
+	jsonBody, _ := json.Marshal(models.CreateTodoRequest{Title: "No Defaults Test", Priority: "low"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/todos", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.authToken)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusCreated, w.Code)
+	assert.Equal(s.T(), "completed", w.Header().Get("X-Applied-Defaults"))
+	assert.NotContains(s.T(), w.Header().Get("X-Applied-Defaults"), "priority")
+}
+
+// TestCreateTodoWithExternalID tests creating and fetching a todo by external ID
+func (s *TodoTestSuite) TestCreateTodoWithExternalID() {
+	token, _ := s.registerUser("external-id@example.com")
+	otherToken, _ := s.registerUser("external-id-other@example.com")
+	externalID := "jira-123"
+
+	create := func(token string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(models.CreateTodoRequest{Title: "Mirrored", ExternalID: &externalID})
+		req := httptest.NewRequest(http.MethodPost, "/api/todos", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/todos/external/"+externalID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := create(token)
+	s.Require().Equal(http.StatusCreated, w.Code)
+
+	w = get(token)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	var response struct {
+		Data models.TodoResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(s.T(), "Mirrored", response.Data.Title)
+	s.Require().NotNil(response.Data.ExternalID)
+	assert.Equal(s.T(), externalID, *response.Data.ExternalID)
+
+	// Duplicate for the same user is rejected
+	assert.Equal(s.T(), http.StatusConflict, create(token).Code)
+
+	// Other users can neither see it nor are blocked from reusing the ID
+	assert.Equal(s.T(), http.StatusNotFound, get(otherToken).Code)
+	assert.Equal(s.T(), http.StatusCreated, create(otherToken).Code)
+}
+
+// TestUpsertByExternalID tests the create and update paths of the upsert
+func (s *TodoTestSuite) TestUpsertByExternalID() {
+	token, _ := s.registerUser("upsert@example.com")
+
+	upsert := func(body models.UpsertTodoRequest) (int, models.TodoResponse) {
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPut, "/api/todos/external/sync-1", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+
+		var response struct {
+			Data models.TodoResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response.Data
+	}
+
+	code, created := upsert(models.UpsertTodoRequest{Title: "Synced", Priority: "low"})
+	assert.Equal(s.T(), http.StatusCreated, code)
+	assert.Equal(s.T(), "low", created.Priority)
+
+	code, updated := upsert(models.UpsertTodoRequest{Title: "Synced again", Completed: true})
+	assert.Equal(s.T(), http.StatusOK, code)
+	assert.Equal(s.T(), created.ID, updated.ID)
+	assert.Equal(s.T(), "Synced again", updated.Title)
+	assert.Equal(s.T(), models.DefaultPriority, updated.Priority)
+	assert.True(s.T(), updated.Completed)
+	assert.NotNil(s.T(), updated.CompletedAt)
+}
+
+// TestExternalIDReusedAfterDelete tests that a deleted todo's external ID
+// can be upserted or created again, and that restoring it then conflicts
+func (s *TodoTestSuite) TestExternalIDReusedAfterDelete() {
+	token, _ := s.registerUser("external-id-reuse@example.com")
+
+	send := func(method, path string, body interface{}) (int, models.TodoResponse) {
+		var reader io.Reader
+		if body != nil {
+			jsonBody, _ := json.Marshal(body)
+			reader = bytes.NewBuffer(jsonBody)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+
+		var response struct {
+			Data models.TodoResponse `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	code, first := send(http.MethodPut, "/api/todos/external/reuse-1", models.UpsertTodoRequest{Title: "First"})
+	s.Require().Equal(http.StatusCreated, code)
+	code, _ = send(http.MethodDelete, fmt.Sprintf("/api/todos/%d", first.ID), nil)
+	s.Require().Equal(http.StatusNoContent, code)
+
+	code, second := send(http.MethodPut, "/api/todos/external/reuse-1", models.UpsertTodoRequest{Title: "Second"})
+	s.Require().Equal(http.StatusCreated, code)
+	assert.NotEqual(s.T(), first.ID, second.ID)
+
+	// The deleted todo can't come back while its ID is in use again
+	code, _ = send(http.MethodPost, fmt.Sprintf("/api/todos/%d/restore", first.ID), nil)
+	assert.Equal(s.T(), http.StatusConflict, code)
+
+	code, _ = send(http.MethodDelete, fmt.Sprintf("/api/todos/%d", second.ID), nil)
+	s.Require().Equal(http.StatusNoContent, code)
+	externalID := "reuse-1"
+	code, third := send(http.MethodPost, "/api/todos", models.CreateTodoRequest{Title: "Third", ExternalID: &externalID})
+	s.Require().Equal(http.StatusCreated, code)
+	assert.Equal(s.T(), "Third", third.Title)
+}
+
+// TestUpsertByExternalIDConcurrent tests that concurrent upserts never create duplicates
+func (s *TodoTestSuite) TestUpsertByExternalIDConcurrent() {
+	_, userID := s.registerUser("upsert-concurrent@example.com")
+	todoService := s.newTodoService(config.TodoConfig{})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := &models.UpsertTodoRequest{Title: fmt.Sprintf("Writer %d", i)}
+			_, _, err := todoService.UpsertByExternalID(context.Background(), userID, "race-1", req)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(s.T(), err)
+	}
+
+	var count int64
+	s.Require().NoError(s.db.Model(&models.Todo{}).Where("user_id = ? AND external_id = ?", userID, "race-1").Count(&count).Error)
+	assert.Equal(s.T(), int64(1), count)
+}
+
+// TestDueSoonFlag tests flagging incomplete todos due within the user's threshold
+func (s *TodoTestSuite) TestDueSoonFlag() {
+	token, userID := s.registerUser("due-soon@example.com")
+	inside := time.Now().Add(2 * time.Hour)
+	outside := time.Now().Add(48 * time.Hour)
+	past := time.Now().Add(-2 * time.Hour)
+
+	todos := []models.Todo{
+		{Title: "Inside", DueDate: &inside, UserID: userID},
+		{Title: "Outside", DueDate: &outside, UserID: userID},
+		{Title: "Overdue", DueDate: &past, UserID: userID},
+		{Title: "Done inside", DueDate: &inside, Completed: true, UserID: userID},
+		{Title: "No due date", UserID: userID},
+	}
+	s.Require().NoError(s.db.Create(&todos).Error)
+
+	dueSoon := func() map[string]bool {
+		req := httptest.NewRequest(http.MethodGet, "/api/todos?per_page=100", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusOK, w.Code)
+
+		var response struct {
+			Data models.TodoListResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		flags := make(map[string]bool)
+		for _, todo := range response.Data.Todos {
+			flags[todo.Title] = todo.DueSoon
+		}
+		return flags
+	}
+
+	// Default threshold is 24 hours
+	assert.Equal(s.T(), map[string]bool{
+		"Inside": true, "Outside": false, "Overdue": false, "Done inside": false, "No due date": false,
+	}, dueSoon())
+
+	// Widening the threshold to 3 days includes the 48h todo
+	threshold := 3 * 24 * 60 * 60
+	jsonBody, _ := json.Marshal(models.UpdatePreferencesRequest{DueSoonThreshold: &threshold})
+	req := httptest.NewRequest(http.MethodPut, "/api/auth/preferences", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	flags := dueSoon()
+	assert.True(s.T(), flags["Inside"])
+	assert.True(s.T(), flags["Outside"])
+
+	// The single-todo endpoints carry the flag too
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/todos/%d", todos[1].ID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	var response struct {
+		Data models.TodoResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(s.T(), response.Data.DueSoon)
+}
+
+// TestCreateTodoDuplicateGuard tests double-submission detection with the guard on and off
+func (s *TodoTestSuite) TestCreateTodoDuplicateGuard() {
+	_, userID := s.registerUser("duplicate-guard@example.com")
+	ctx := context.Background()
+
+	create := func(todoService *services.TodoService, title, description string) uint {
+		todo, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: title, Description: description})
+		s.Require().NoError(err)
+		return todo.ID
+	}
+
+	guarded := s.newTodoService(config.TodoConfig{DuplicateWindow: 5 * time.Second})
+	first := create(guarded, "Double click", "details")
+	assert.Equal(s.T(), first, create(guarded, "Double click", "details"))
+	assert.NotEqual(s.T(), first, create(guarded, "Double click", "other details"))
+
+	unguarded := s.newTodoService(config.TodoConfig{})
+	second := create(unguarded, "Double click off", "")
+	assert.NotEqual(s.T(), second, create(unguarded, "Double click off", ""))
+}
+
 // TestCreateTodoWithoutAuth tests creating todo without authentication
 func (s *TodoTestSuite) TestCreateTodoWithoutAuth() {
 	body := models.CreateTodoRequest{
@@ -170,6 +488,240 @@ func (s *TodoTestSuite) TestListTodosWithPagination() {
 	assert.Equal(s.T(), http.StatusOK, w.Code)
 }
 
+// TestListTodosOffsetPagination tests that offset/limit and page/per_page select the same todos
+func (s *TodoTestSuite) TestListTodosOffsetPagination() {
+	token, userID := s.registerUser("offset-pagination@example.com")
+	for _, title := range []string{"A", "B", "C", "D", "E"} {
+		s.Require().NoError(s.db.Create(&models.Todo{Title: title, UserID: userID}).Error)
+	}
+
+	list := func(query string) models.TodoListResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/todos?sort=title&order=asc&"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusOK, w.Code, query)
+
+		var response struct {
+			Data models.TodoListResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+	titles := func(result models.TodoListResponse) []string {
+		var titles []string
+		for _, todo := range result.Todos {
+			titles = append(titles, todo.Title)
+		}
+		return titles
+	}
+
+	// page/per_page
+	result := list("page=2&per_page=2")
+	assert.Equal(s.T(), []string{"C", "D"}, titles(result))
+	assert.Equal(s.T(), 2, result.Page)
+	assert.Equal(s.T(), int64(5), result.Total)
+
+	// offset/limit need not align with a page
+	result = list("offset=1&limit=3")
+	assert.Equal(s.T(), []string{"B", "C", "D"}, titles(result))
+	assert.Equal(s.T(), 1, result.Page)
+	assert.Equal(s.T(), 3, result.PerPage)
+	assert.Equal(s.T(), int64(5), result.Total)
+
+	assert.Equal(s.T(), []string{"E"}, titles(list("offset=4")))
+	assert.Equal(s.T(), []string{"A", "B"}, titles(list("limit=2")))
+}
+
+// TestListTodosInvalidOffsetPagination tests rejecting mixed or out-of-range pagination params
+func (s *TodoTestSuite) TestListTodosInvalidOffsetPagination() {
+	for _, query := range []string{
+		"offset=0&page=1",
+		"limit=5&per_page=5",
+		"offset=-1",
+		"offset=abc",
+		"limit=0",
+		"limit=101",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/todos?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+s.authToken)
+		w := httptest.NewRecorder()
+
+		s.router.ServeHTTP(w, req)
+
+		assert.Equal(s.T(), http.StatusBadRequest, w.Code, query)
+	}
+}
+
+// TestListTodosSortedByPriority tests that priority sorts logically rather than alphabetically
+func (s *TodoTestSuite) TestListTodosSortedByPriority() {
+	token, userID := s.registerUser("sort-priority@example.com")
+	for _, priority := range []string{"medium", "high", "low", "medium", "high"} {
+		s.Require().NoError(s.db.Create(&models.Todo{Title: priority, Priority: priority, UserID: userID}).Error)
+	}
+
+	assert.Equal(s.T(), []string{"high", "high", "medium", "medium", "low"},
+		s.listPriorities(token, "/api/todos?sort=priority&order=desc"))
+	assert.Equal(s.T(), []string{"low", "medium", "medium", "high", "high"},
+		s.listPriorities(token, "/api/todos?sort=priority&order=asc"))
+}
+
+// TestListTodosIncludeSummary tests that the summary covers the filtered set, not the page
+func (s *TodoTestSuite) TestListTodosIncludeSummary() {
+	token, userID := s.registerUser("list-summary@example.com")
+	yesterday := time.Now().Add(-24 * time.Hour)
+	tomorrow := time.Now().Add(24 * time.Hour)
+
+	todos := []models.Todo{
+		{Title: "Done 1", Completed: true, UserID: userID},
+		{Title: "Done late", Completed: true, DueDate: &yesterday, UserID: userID},
+		{Title: "Overdue", DueDate: &yesterday, UserID: userID},
+		{Title: "Upcoming", DueDate: &tomorrow, UserID: userID},
+		{Title: "Someday", UserID: userID},
+	}
+	s.Require().NoError(s.db.Create(&todos).Error)
+
+	list := func(path string) models.TodoListResponse {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusOK, w.Code)
+
+		var response struct {
+			Data models.TodoListResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	result := list("/api/todos?per_page=2&include_summary=true")
+	assert.Len(s.T(), result.Todos, 2)
+	s.Require().NotNil(result.Summary)
+	assert.Equal(s.T(), models.TodoSummary{Completed: 2, Pending: 3, Overdue: 1}, *result.Summary)
+
+	// Summary follows the filter
+	result = list("/api/todos?per_page=1&completed=false&include_summary=true")
+	s.Require().NotNil(result.Summary)
+	assert.Equal(s.T(), models.TodoSummary{Completed: 0, Pending: 3, Overdue: 1}, *result.Summary)
+
+	// Omitted unless requested
+	assert.Nil(s.T(), list("/api/todos").Summary)
+}
+
+// TestListTodosConfiguredDefaultSort tests that the configured default applies when no sort is given
+func (s *TodoTestSuite) TestListTodosConfiguredDefaultSort() {
+	_, userID := s.registerUser("default-sort@example.com")
+	ctx := context.Background()
+	todoService := s.newTodoService(config.TodoConfig{DefaultSort: "title", DefaultOrder: "asc"})
+
+	for _, title := range []string{"Bravo", "Charlie", "Alpha"} {
+		_, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: title})
+		s.Require().NoError(err)
+	}
+
+	titles := func(opts models.TodoListOptions) []string {
+		result, err := todoService.List(ctx, userID, opts)
+		s.Require().NoError(err)
+		var titles []string
+		for _, todo := range result.Todos {
+			titles = append(titles, todo.Title)
+		}
+		return titles
+	}
+
+	assert.Equal(s.T(), []string{"Alpha", "Bravo", "Charlie"}, titles(models.TodoListOptions{}))
+	// Explicit params still win
+	assert.Equal(s.T(), []string{"Charlie", "Bravo", "Alpha"}, titles(models.TodoListOptions{Order: "desc"}))
+}
+
+// TestListTodosSortBy tests every sort field, in both directions, through the sort_by alias
+func (s *TodoTestSuite) TestListTodosSortBy() {
+	token, userID := s.registerUser("sort-by@example.com")
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	due := func(days int) *time.Time {
+		d := base.AddDate(0, 0, days)
+		return &d
+	}
+
+	todos := []models.Todo{
+		{Title: "Alpha", Priority: "high", DueDate: due(3), CreatedAt: base.Add(2 * time.Minute), UpdatedAt: base.Add(time.Minute), UserID: userID},
+		{Title: "Bravo", Priority: "low", DueDate: due(1), CreatedAt: base, UpdatedAt: base.Add(2 * time.Minute), UserID: userID},
+		{Title: "Charlie", Priority: "medium", DueDate: due(2), CreatedAt: base.Add(time.Minute), UpdatedAt: base, UserID: userID},
+	}
+	s.Require().NoError(s.db.Create(&todos).Error)
+
+	titles := func(query string) []string {
+		req := httptest.NewRequest(http.MethodGet, "/api/todos?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusOK, w.Code, query)
+
+		var response struct {
+			Data models.TodoListResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		var titles []string
+		for _, todo := range response.Data.Todos {
+			titles = append(titles, todo.Title)
+		}
+		return titles
+	}
+
+	ascending := map[string][]string{
+		"created_at": {"Bravo", "Charlie", "Alpha"},
+		"updated_at": {"Charlie", "Alpha", "Bravo"},
+		"due_date":   {"Bravo", "Charlie", "Alpha"},
+		"priority":   {"Bravo", "Charlie", "Alpha"},
+		"title":      {"Alpha", "Bravo", "Charlie"},
+	}
+	for _, field := range models.TodoSortFields {
+		want := ascending[field]
+		assert.Equal(s.T(), want, titles("sort_by="+field+"&order=asc"), field)
+
+		reversed := slices.Clone(want)
+		slices.Reverse(reversed)
+		assert.Equal(s.T(), reversed, titles("sort_by="+field+"&order=desc"), field)
+	}
+
+	// Repeating the same field under both names is fine
+	assert.Equal(s.T(), ascending["title"], titles("sort=title&sort_by=title&order=asc"))
+}
+
+// TestListTodosInvalidSort tests rejecting unknown sort fields and directions
+func (s *TodoTestSuite) TestListTodosInvalidSort() {
+	for _, query := range []string{"sort=password", "sort=priority&order=sideways", "sort_by=password", "sort_by=title%20desc", "sort=title&sort_by=priority"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/todos?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+s.authToken)
+		w := httptest.NewRecorder()
+
+		s.router.ServeHTTP(w, req)
+
+		assert.Equal(s.T(), http.StatusBadRequest, w.Code, query)
+	}
+}
+
+// listPriorities lists todos at path and returns their priorities in order
+func (s *TodoTestSuite) listPriorities(token, path string) []string {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	var response struct {
+		Data models.TodoListResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+
+	priorities := make([]string, len(response.Data.Todos))
+	for i, todo := range response.Data.Todos {
+		priorities[i] = todo.Priority
+	}
+	return priorities
+}
+
 // TestGetTodoByID tests getting a specific todo
 func (s *TodoTestSuite) TestGetTodoByID() {
 	// First create a todo
@@ -239,6 +791,41 @@ func (s *TodoTestSuite) TestUpdateTodo() {
 	assert.Equal(s.T(), http.StatusOK, w.Code)
 }
 
+// TestDescriptionSerialization tests that descriptions are always strings, never null
+func (s *TodoTestSuite) TestDescriptionSerialization() {
+	token, _ := s.registerUser("description-test@example.com")
+
+	send := func(method, path string, body interface{}) map[string]interface{} {
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.Require().Less(w.Code, 300, w.Body.String())
+
+		var response struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	// Empty description serializes as ""
+	empty := send(http.MethodPost, "/api/todos", map[string]string{"title": "No description"})
+	s.Require().Contains(empty, "description")
+	assert.Equal(s.T(), "", empty["description"])
+
+	// Set description serializes as its value
+	set := send(http.MethodPost, "/api/todos", map[string]string{"title": "With description", "description": "details"})
+	assert.Equal(s.T(), "details", set["description"])
+
+	// Updating to "" clears it back to an empty string
+	cleared := send(http.MethodPut, fmt.Sprintf("/api/todos/%v", set["id"]), map[string]string{"description": ""})
+	s.Require().Contains(cleared, "description")
+	assert.Equal(s.T(), "", cleared["description"])
+}
+
 // TestDeleteTodo tests deleting a todo
 func (s *TodoTestSuite) TestDeleteTodo() {
 	// Create a todo first
@@ -270,29 +857,1721 @@ func (s *TodoTestSuite) TestDeleteTodo() {
 	assert.Equal(s.T(), http.StatusNoContent, w.Code)
 }
 
-// TestGetTodoStats tests getting todo statistics
-func (s *TodoTestSuite) TestGetTodoStats() {
-	req := httptest.NewRequest(http.MethodGet, "/api/todos/stats", nil)
-	req.Header.Set("Authorization", "Bearer "+s.authToken)
-	w := httptest.NewRecorder()
+// TestDeleteResponses tests that single deletes stay 204 unless asked for a
+// TestListTodosDueRange tests filtering by due_after, due_before and both
+func (s *TodoTestSuite) TestListTodosDueRange() {
+	token, userID := s.registerUser("due-range@example.com")
+	day := func(d int) *time.Time {
+		t := time.Date(2030, 1, d, 12, 0, 0, 0, time.UTC)
+		return &t
+	}
+	todos := []models.Todo{
+		{Title: "Monday", DueDate: day(7), UserID: userID},
+		{Title: "Wednesday", DueDate: day(9), UserID: userID},
+		{Title: "Friday", DueDate: day(11), UserID: userID},
+		{Title: "Someday", UserID: userID},
+	}
+	s.Require().NoError(s.db.Create(&todos).Error)
 
-	s.router.ServeHTTP(w, req)
+	list := func(query string) (int, []string) {
+		req := httptest.NewRequest(http.MethodGet, "/api/todos?sort=due_date&order=asc&"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
 
-	assert.Equal(s.T(), http.StatusOK, w.Code)
+		var response struct {
+			Data models.TodoListResponse `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		var titles []string
+		for _, todo := range response.Data.Todos {
+			titles = append(titles, todo.Title)
+		}
+		return w.Code, titles
+	}
+
+	code, titles := list("due_after=2030-01-09T12:00:00Z")
+	s.Require().Equal(http.StatusOK, code)
+	assert.Equal(s.T(), []string{"Wednesday", "Friday"}, titles)
+
+	code, titles = list("due_before=2030-01-09T12:00:00Z")
+	s.Require().Equal(http.StatusOK, code)
+	assert.Equal(s.T(), []string{"Monday", "Wednesday"}, titles)
+
+	// Offsets are honored: 13:00+02:00 is 11:00 UTC
+	code, titles = list("due_after=2030-01-08T00:00:00Z&due_before=2030-01-11T13:00:00%2B02:00")
+	s.Require().Equal(http.StatusOK, code)
+	assert.Equal(s.T(), []string{"Wednesday"}, titles)
+
+	for _, query := range []string{
+		"due_after=tomorrow",
+		"due_before=2030-01-09",
+		"due_after=2030-01-10T00:00:00Z&due_before=2030-01-08T00:00:00Z",
+	} {
+		code, _ = list(query)
+		assert.Equal(s.T(), http.StatusBadRequest, code, query)
+	}
 }
 
-// TestGetNonExistentTodo tests getting a todo that doesn't exist
-func (s *TodoTestSuite) TestGetNonExistentTodo() {
-	req := httptest.NewRequest(http.MethodGet, "/api/todos/99999", nil)
-	req.Header.Set("Authorization", "Bearer "+s.authToken)
-	w := httptest.NewRecorder()
+// count, while clearing completed todos always returns one
+func (s *TodoTestSuite) TestDeleteResponses() {
+	token, userID := s.registerUser("delete-responses@example.com")
+	todoService := s.newTodoService(config.TodoConfig{})
+	ctx := context.Background()
 
-	s.router.ServeHTTP(w, req)
+	deleteAt := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	deletedCount := func(w *httptest.ResponseRecorder) int64 {
+		var response struct {
+			Data models.BulkDeleteResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data.Deleted
+	}
 
-	assert.Equal(s.T(), http.StatusNotFound, w.Code)
+	var ids []uint
+	for i := 0; i < 5; i++ {
+		todo, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: fmt.Sprintf("Delete response %d", i)})
+		s.Require().NoError(err)
+		ids = append(ids, todo.ID)
+	}
+	completed := true
+	for _, id := range ids[:3] {
+		_, err := todoService.Update(ctx, id, userID, &models.UpdateTodoRequest{Completed: &completed}, nil)
+		s.Require().NoError(err)
+	}
+
+	w := deleteAt(fmt.Sprintf("/api/todos/%d", ids[4]))
+	assert.Equal(s.T(), http.StatusNoContent, w.Code)
+	assert.Empty(s.T(), w.Body.String())
+
+	w = deleteAt(fmt.Sprintf("/api/todos/%d?return=true", ids[3]))
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Equal(s.T(), int64(1), deletedCount(w))
+
+	assert.Equal(s.T(), http.StatusBadRequest, deleteAt(fmt.Sprintf("/api/todos/%d?return=maybe", ids[0])).Code)
+
+	w = deleteAt("/api/todos/completed")
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Equal(s.T(), int64(3), deletedCount(w))
+
+	w = deleteAt("/api/todos/completed")
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Equal(s.T(), int64(0), deletedCount(w))
 }
 
-// TestTodoTestSuite runs the test suite
-func TestTodoTestSuite(t *testing.T) {
-	suite.Run(t, new(TodoTestSuite))
+// TestTodoTags tests creating todos with tags, filtering by tag and clearing tags
+func (s *TodoTestSuite) TestTodoTags() {
+	token, _ := s.registerUser("tags@example.com")
+
+	send := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			jsonBody, _ := json.Marshal(body)
+			buf.Write(jsonBody)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	create := func(title string, tags ...string) models.TodoResponse {
+		w := send(http.MethodPost, "/api/todos", models.CreateTodoRequest{Title: title, Tags: tags})
+		s.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+		var response struct {
+			Data models.TodoResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+	titles := func(query string) []string {
+		w := send(http.MethodGet, "/api/todos?sort=title&order=asc&"+query, nil)
+		s.Require().Equal(http.StatusOK, w.Code)
+		var response struct {
+			Data models.TodoListResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		var titles []string
+		for _, todo := range response.Data.Todos {
+			titles = append(titles, todo.Title)
+		}
+		return titles
+	}
+
+	report := create("Write report", " Work", "urgent", "work", "")
+	assert.Equal(s.T(), []string{"urgent", "work"}, report.Tags)
+	create("Book flights", "travel", "work")
+	create("Water plants")
+
+	assert.Equal(s.T(), []string{"Book flights", "Write report"}, titles("tag=work"))
+	assert.Equal(s.T(), []string{"Write report"}, titles("tag=URGENT"))
+	assert.Empty(s.T(), titles("tag=missing"))
+
+	w := send(http.MethodGet, fmt.Sprintf("/api/todos/%d", report.ID), nil)
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Contains(s.T(), w.Body.String(), `"tags":["urgent","work"]`)
+
+	// Updates without tags leave them alone; an empty list removes them
+	title := "Write final report"
+	w = send(http.MethodPut, fmt.Sprintf("/api/todos/%d", report.ID), models.UpdateTodoRequest{Title: &title})
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Contains(s.T(), w.Body.String(), `"tags":["urgent","work"]`)
+
+	w = send(http.MethodPut, fmt.Sprintf("/api/todos/%d", report.ID), map[string]interface{}{"tags": []string{}})
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.NotContains(s.T(), w.Body.String(), `"tags"`)
+	assert.Equal(s.T(), []string{"Book flights"}, titles("tag=work"))
+	assert.Empty(s.T(), titles("tag=urgent"))
+}
+
+// TestRecurringTodoRegenerates tests that completing a recurring todo creates
+// TestRecurringTodoRegeneratesOnBulkAndUpsert tests that completing a
+// recurring todo through a bulk update or an upsert schedules it again too
+func (s *TodoTestSuite) TestRecurringTodoRegeneratesOnBulkAndUpsert() {
+	_, userID := s.registerUser("recurring-bulk@example.com")
+	todoService := s.newTodoService(config.TodoConfig{})
+	ctx := context.Background()
+
+	occurrences := func(title string) int64 {
+		var count int64
+		s.Require().NoError(s.db.Model(&models.Todo{}).Where("user_id = ? AND title = ?", userID, title).Count(&count).Error)
+		return count
+	}
+
+	bulk, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: "Bulk recurring", Recurrence: models.RecurrenceDaily})
+	s.Require().NoError(err)
+	result, err := todoService.BulkUpdateCompleted(ctx, userID, []uint{bulk.ID}, true)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), int64(1), result.Updated)
+	assert.Equal(s.T(), int64(2), occurrences("Bulk recurring"))
+
+	externalID := "upsert-recurring"
+	upserted, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{
+		Title: "Upsert recurring", ExternalID: &externalID, Recurrence: models.RecurrenceWeekly, Tags: []string{"chores"},
+	})
+	s.Require().NoError(err)
+	_, _, err = todoService.UpsertByExternalID(ctx, userID, externalID, &models.UpsertTodoRequest{Title: "Upsert recurring", Completed: true})
+	s.Require().NoError(err)
+	assert.Equal(s.T(), int64(2), occurrences("Upsert recurring"))
+
+	var next models.Todo
+	s.Require().NoError(s.db.Where("user_id = ? AND title = ? AND id <> ?", userID, "Upsert recurring", upserted.ID).First(&next).Error)
+	assert.False(s.T(), next.Completed)
+	assert.Nil(s.T(), next.ExternalID)
+	response, err := todoService.GetByID(ctx, next.ID, userID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), []string{"chores"}, response.Tags)
+
+	// Upserting the completed todo again doesn't schedule another
+	_, _, err = todoService.UpsertByExternalID(ctx, userID, externalID, &models.UpsertTodoRequest{Title: "Upsert recurring", Completed: true})
+	s.Require().NoError(err)
+	assert.Equal(s.T(), int64(2), occurrences("Upsert recurring"))
+}
+
+// its next occurrence one interval later
+func (s *TodoTestSuite) TestRecurringTodoRegenerates() {
+	_, userID := s.registerUser("recurring@example.com")
+	todoService := s.newTodoService(config.TodoConfig{})
+	ctx := context.Background()
+
+	tests := []struct {
+		recurrence string
+		due        time.Time
+		next       time.Time
+	}{
+		{models.RecurrenceDaily, time.Date(2030, 3, 9, 17, 0, 0, 0, time.UTC), time.Date(2030, 3, 10, 17, 0, 0, 0, time.UTC)},
+		{models.RecurrenceWeekly, time.Date(2030, 3, 9, 17, 0, 0, 0, time.UTC), time.Date(2030, 3, 16, 17, 0, 0, 0, time.UTC)},
+		{models.RecurrenceMonthly, time.Date(2030, 3, 9, 17, 0, 0, 0, time.UTC), time.Date(2030, 4, 9, 17, 0, 0, 0, time.UTC)},
+		{models.RecurrenceMonthly, time.Date(2030, 1, 31, 17, 0, 0, 0, time.UTC), time.Date(2030, 2, 28, 17, 0, 0, 0, time.UTC)},
+	}
+
+	completed := true
+	for _, tt := range tests {
+		title := fmt.Sprintf("Recurring %s from %s", tt.recurrence, tt.due.Format(time.DateOnly))
+		due := tt.due
+		created, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{
+			Title:      title,
+			DueDate:    &due,
+			Recurrence: tt.recurrence,
+			Tags:       []string{"chores"},
+		})
+		s.Require().NoError(err)
+		assert.Equal(s.T(), tt.recurrence, created.Recurrence)
+
+		updated, err := todoService.Update(ctx, created.ID, userID, &models.UpdateTodoRequest{Completed: &completed}, nil)
+		s.Require().NoError(err)
+		assert.True(s.T(), updated.Completed)
+
+		var next models.Todo
+		s.Require().NoError(s.db.Where("user_id = ? AND title = ? AND id <> ?", userID, title, created.ID).First(&next).Error)
+		assert.False(s.T(), next.Completed, tt.recurrence)
+		assert.Equal(s.T(), tt.recurrence, next.Recurrence)
+		s.Require().NotNil(next.DueDate)
+		assert.True(s.T(), tt.next.Equal(*next.DueDate), "%s: got %s, want %s", title, next.DueDate, tt.next)
+
+		response, err := todoService.GetByID(ctx, next.ID, userID)
+		s.Require().NoError(err)
+		assert.Equal(s.T(), []string{"chores"}, response.Tags)
+
+		// Completing the original again doesn't create another occurrence
+		_, err = todoService.Update(ctx, created.ID, userID, &models.UpdateTodoRequest{Completed: &completed}, nil)
+		s.Require().NoError(err)
+		var count int64
+		s.Require().NoError(s.db.Model(&models.Todo{}).Where("user_id = ? AND title = ?", userID, title).Count(&count).Error)
+		assert.Equal(s.T(), int64(2), count)
+	}
+
+	// Clearing the recurrence makes completion final
+	oneOff, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: "No longer recurring", Recurrence: models.RecurrenceDaily})
+	s.Require().NoError(err)
+	none := ""
+	_, err = todoService.Update(ctx, oneOff.ID, userID, &models.UpdateTodoRequest{Recurrence: &none, Completed: &completed}, nil)
+	s.Require().NoError(err)
+	var count int64
+	s.Require().NoError(s.db.Model(&models.Todo{}).Where("user_id = ? AND title = ?", userID, "No longer recurring").Count(&count).Error)
+	assert.Equal(s.T(), int64(1), count)
+}
+
+// TestArchiveTodo tests that archived todos leave the default list and come
+// back with include_archived or once unarchived
+func (s *TodoTestSuite) TestArchiveTodo() {
+	token, userID := s.registerUser("archive@example.com")
+	_, otherUserID := s.registerUser("archive-other@example.com")
+	todoService := s.newTodoService(config.TodoConfig{})
+	ctx := context.Background()
+
+	kept, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: "Kept"})
+	s.Require().NoError(err)
+	archived, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: "Archived"})
+	s.Require().NoError(err)
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	titles := func(query string) []string {
+		w := send(http.MethodGet, "/api/todos?sort=title&order=asc&"+query)
+		s.Require().Equal(http.StatusOK, w.Code)
+		var response struct {
+			Data models.TodoListResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		var titles []string
+		for _, todo := range response.Data.Todos {
+			titles = append(titles, todo.Title)
+		}
+		return titles
+	}
+
+	// Archiving twice is the same as archiving once
+	archivePath := fmt.Sprintf("/api/todos/%d/archive", archived.ID)
+	for i := 0; i < 2; i++ {
+		w := send(http.MethodPost, archivePath)
+		s.Require().Equal(http.StatusOK, w.Code)
+		var response struct {
+			Data models.TodoResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		assert.True(s.T(), response.Data.Archived)
+	}
+	history, err := todoService.History(ctx, archived.ID, userID)
+	s.Require().NoError(err)
+	assert.Len(s.T(), history, 2, "a repeated archive records no new version")
+
+	assert.Equal(s.T(), []string{"Kept"}, titles(""))
+	assert.Equal(s.T(), []string{"Archived", "Kept"}, titles("include_archived=true"))
+
+	// Archived todos can still be fetched directly
+	assert.Equal(s.T(), http.StatusOK, send(http.MethodGet, fmt.Sprintf("/api/todos/%d", archived.ID)).Code)
+
+	w := send(http.MethodPost, fmt.Sprintf("/api/todos/%d/unarchive", archived.ID))
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Equal(s.T(), []string{"Archived", "Kept"}, titles(""))
+
+	// Other users' todos and missing todos are not found
+	_, err = todoService.SetArchived(ctx, kept.ID, otherUserID, true)
+	assert.ErrorIs(s.T(), err, services.ErrTodoNotFound)
+	assert.Equal(s.T(), http.StatusNotFound, send(http.MethodPost, "/api/todos/999999/archive").Code)
+	assert.Equal(s.T(), http.StatusBadRequest, send(http.MethodPost, "/api/todos/abc/archive").Code)
+}
+
+// TestUpdateValidatesFieldsInService tests that updates are validated by the
+// service itself, not just by request binding
+func (s *TodoTestSuite) TestUpdateValidatesFieldsInService() {
+	token, userID := s.registerUser("update-validation@example.com")
+	todoService := s.newTodoService(config.TodoConfig{})
+	ctx := context.Background()
+
+	todo, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: "Valid title"})
+	s.Require().NoError(err)
+
+	empty := ""
+	blank := "   "
+	tooLong := strings.Repeat("a", models.MaxTitleLength+1)
+	longest := strings.Repeat("é", models.MaxTitleLength) // counted in characters, not bytes
+	urgent := "urgent"
+
+	for name, req := range map[string]*models.UpdateTodoRequest{
+		"empty title":      {Title: &empty},
+		"blank title":      {Title: &blank},
+		"too long title":   {Title: &tooLong},
+		"unknown priority": {Priority: &urgent},
+	} {
+		_, err := todoService.Update(ctx, todo.ID, userID, req, nil)
+		assert.ErrorIs(s.T(), err, services.ErrInvalidTodo, name)
+	}
+
+	updated, err := todoService.Update(ctx, todo.ID, userID, &models.UpdateTodoRequest{Title: &longest}, nil)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), longest, updated.Title)
+
+	// A blank title gets past binding but not the service
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/todos/%d", todo.ID), strings.NewReader(`{"title": "   "}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(s.T(), w.Body.String(), "title must not be empty")
+}
+
+// TestOwnershipChecks tests that todo operations find only the user's own
+// todos, reporting anything else as ErrTodoNotFound
+func (s *TodoTestSuite) TestOwnershipChecks() {
+	_, userID := s.registerUser("ownership@example.com")
+	_, otherUserID := s.registerUser("ownership-other@example.com")
+	todoService := s.newTodoService(config.TodoConfig{})
+	ctx := context.Background()
+
+	todo, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: "Mine"})
+	s.Require().NoError(err)
+	title := "Not yours"
+
+	for _, id := range []uint{todo.ID, 999999} {
+		_, err = todoService.GetByID(ctx, id, otherUserID)
+		assert.ErrorIs(s.T(), err, services.ErrTodoNotFound)
+		_, err = todoService.Update(ctx, id, otherUserID, &models.UpdateTodoRequest{Title: &title}, nil)
+		assert.ErrorIs(s.T(), err, services.ErrTodoNotFound)
+		assert.ErrorIs(s.T(), todoService.Delete(ctx, id, otherUserID), services.ErrTodoNotFound)
+	}
+
+	// The owner still gets the untouched todo
+	found, err := todoService.GetByID(ctx, todo.ID, userID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), "Mine", found.Title)
+	title = "Still mine"
+	updated, err := todoService.Update(ctx, todo.ID, userID, &models.UpdateTodoRequest{Title: &title}, nil)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), "Still mine", updated.Title)
+	s.Require().NoError(todoService.Delete(ctx, todo.ID, userID))
+	_, err = todoService.GetByID(ctx, todo.ID, userID)
+	assert.ErrorIs(s.T(), err, services.ErrTodoNotFound)
+}
+
+// TestDeleteTodoModes tests soft deletes by default and hard deletes when configured
+func (s *TodoTestSuite) TestDeleteTodoModes() {
+	_, userID := s.registerUser("delete-modes@example.com")
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		hardDelete bool
+		retained   int64
+	}{
+		{"soft delete", false, 1},
+		{"hard delete", true, 0},
+	}
+
+	for _, tt := range tests {
+		todoService := s.newTodoService(config.TodoConfig{HardDeleteTodos: tt.hardDelete})
+		todo, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: tt.name})
+		s.Require().NoError(err)
+
+		s.Require().NoError(todoService.Delete(ctx, todo.ID, userID))
+
+		_, err = todoService.GetByID(ctx, todo.ID, userID)
+		assert.Error(s.T(), err, tt.name)
+
+		var retained int64
+		s.Require().NoError(s.db.Unscoped().Model(&models.Todo{}).Where("id = ?", todo.ID).Count(&retained).Error)
+		assert.Equal(s.T(), tt.retained, retained, tt.name)
+	}
+}
+
+// TestGetPurgedTodo tests that fetching a permanently deleted todo returns
+// 410 Gone when tombstones are enabled, and 404 otherwise
+func (s *TodoTestSuite) TestGetPurgedTodo() {
+	ctx := context.Background()
+	token, userID := s.registerUser("purged-todo@example.com")
+
+	tests := []struct {
+		name       string
+		tombstones bool
+		expected   int
+	}{
+		{name: "tombstones", tombstones: true, expected: http.StatusGone},
+		{name: "no tombstones", tombstones: false, expected: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		var opts []repository.Option
+		if tt.tombstones {
+			opts = append(opts, repository.WithTombstones())
+		}
+		cfg := config.TodoConfig{HardDeleteTodos: true, Tombstones: tt.tombstones}
+		todoService := services.NewTodoService(repository.NewTodoRepository(s.db, opts...), repository.NewUserRepository(s.db), cfg)
+		engine := gin.New()
+		engine.GET("/api/todos/:id", middleware.AuthMiddleware(s.jwtManager), handlers.NewTodoHandler(todoService, cfg).GetByID)
+
+		todo, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: tt.name})
+		s.Require().NoError(err)
+		s.Require().NoError(todoService.Delete(ctx, todo.ID, userID))
+
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/todos/%d", todo.ID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(s.T(), tt.expected, w.Code, tt.name)
+
+		// IDs that never existed are still not found
+		req = httptest.NewRequest(http.MethodGet, "/api/todos/999999", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(s.T(), http.StatusNotFound, w.Code, tt.name)
+	}
+}
+
+// TestGetTodoStats tests getting todo statistics
+func (s *TodoTestSuite) TestGetTodoStats() {
+	req := httptest.NewRequest(http.MethodGet, "/api/todos/stats", nil)
+	req.Header.Set("Authorization", "Bearer "+s.authToken)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+}
+
+// TestGetTodoStatsAverageCompletionTime tests the average time-to-complete metric
+func (s *TodoTestSuite) TestGetTodoStatsAverageCompletionTime() {
+	token, userID := s.registerUser("avg-completion@example.com")
+
+	// Completed after 1h and 3h, averaging 2h; the pending todo is ignored
+	created := time.Now().Add(-24 * time.Hour)
+	for _, d := range []time.Duration{time.Hour, 3 * time.Hour} {
+		completedAt := created.Add(d)
+		s.Require().NoError(s.db.Create(&models.Todo{
+			Title: "Done", UserID: userID, Completed: true, CreatedAt: created, CompletedAt: &completedAt,
+		}).Error)
+	}
+	s.Require().NoError(s.db.Create(&models.Todo{Title: "Pending", UserID: userID}).Error)
+
+	stats := s.getStats(token)
+	assert.Equal(s.T(), "PT2H", stats["average_completion_time"])
+	assert.Equal(s.T(), float64(3), stats["total"])
+	assert.Equal(s.T(), float64(2), stats["completed"])
+}
+
+// TestGetTodoStatsWithoutCompletions tests the average is null when nothing is completed
+func (s *TodoTestSuite) TestGetTodoStatsWithoutCompletions() {
+	token, userID := s.registerUser("avg-none@example.com")
+	s.Require().NoError(s.db.Create(&models.Todo{Title: "Pending", UserID: userID}).Error)
+
+	stats := s.getStats(token)
+	assert.Contains(s.T(), stats, "average_completion_time")
+	assert.Nil(s.T(), stats["average_completion_time"])
+}
+
+// TestGetTodoStatsIncludeDeleted tests that deleted todos only count when asked for
+func (s *TodoTestSuite) TestGetTodoStatsIncludeDeleted() {
+	token, userID := s.registerUser("stats-deleted@example.com")
+	yesterday := time.Now().Add(-24 * time.Hour)
+	todos := []models.Todo{
+		{Title: "Kept", UserID: userID},
+		{Title: "Deleted done", Completed: true, CompletedAt: &yesterday, UserID: userID},
+		{Title: "Deleted overdue", DueDate: &yesterday, UserID: userID},
+	}
+	s.Require().NoError(s.db.Create(&todos).Error)
+	s.Require().NoError(s.db.Delete(&models.Todo{}, []uint{todos[1].ID, todos[2].ID}).Error)
+
+	stats := s.getStatsAt(token, "/api/todos/stats")
+	assert.Equal(s.T(), float64(1), stats["total"])
+	assert.Equal(s.T(), float64(0), stats["completed"])
+	assert.Equal(s.T(), float64(0), stats["overdue"])
+	assert.Nil(s.T(), stats["average_completion_time"])
+
+	stats = s.getStatsAt(token, "/api/todos/stats?include_deleted=true")
+	assert.Equal(s.T(), float64(3), stats["total"])
+	assert.Equal(s.T(), float64(1), stats["completed"])
+	assert.Equal(s.T(), float64(2), stats["pending"])
+	assert.Equal(s.T(), float64(1), stats["overdue"])
+	assert.NotNil(s.T(), stats["average_completion_time"])
+}
+
+// TestGetTodoStatsByPriority tests the per-priority breakdown alongside the
+// existing counts
+func (s *TodoTestSuite) TestGetTodoStatsByPriority() {
+	token, userID := s.registerUser("stats-priority@example.com")
+	yesterday := time.Now().Add(-24 * time.Hour)
+	tomorrow := time.Now().Add(24 * time.Hour)
+	todos := []models.Todo{
+		{Title: "High overdue", Priority: "high", DueDate: &yesterday, UserID: userID},
+		{Title: "High done late", Priority: "high", DueDate: &yesterday, Completed: true, UserID: userID},
+		{Title: "Low overdue", Priority: "low", DueDate: &yesterday, UserID: userID},
+		{Title: "Low upcoming", Priority: "low", DueDate: &tomorrow, UserID: userID},
+		{Title: "High undated", Priority: "high", UserID: userID},
+	}
+	s.Require().NoError(s.db.Create(&todos).Error)
+
+	stats := s.getStats(token)
+	assert.Equal(s.T(), map[string]interface{}{"low": float64(2), "medium": float64(0), "high": float64(3)}, stats["by_priority"])
+	assert.Equal(s.T(), float64(2), stats["overdue"])
+	assert.Equal(s.T(), float64(5), stats["total"])
+	assert.Equal(s.T(), float64(1), stats["completed"])
+	assert.Equal(s.T(), float64(4), stats["pending"])
+
+	stats = s.getStatsAt(token, "/api/todos/stats?metrics=by_priority")
+	assert.Len(s.T(), stats, 1)
+	assert.Contains(s.T(), stats, "by_priority")
+}
+
+// TestGetTodoStatsMetricsSubset tests requesting only some metrics
+func (s *TodoTestSuite) TestGetTodoStatsMetricsSubset() {
+	token, userID := s.registerUser("stats-subset@example.com")
+	yesterday := time.Now().Add(-24 * time.Hour)
+	todos := []models.Todo{
+		{Title: "Overdue", DueDate: &yesterday, UserID: userID},
+		{Title: "Done", Completed: true, UserID: userID},
+	}
+	s.Require().NoError(s.db.Create(&todos).Error)
+
+	stats := s.getStatsAt(token, "/api/todos/stats?metrics=total,overdue")
+	assert.Equal(s.T(), map[string]interface{}{"total": float64(2), "overdue": float64(1)}, stats)
+
+	// Unknown metrics are rejected
+	req := httptest.NewRequest(http.MethodGet, "/api/todos/stats?metrics=total,velocity", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+// TestGetTodoStatsRunsOnlyRequestedQueries tests that unrequested metrics cost no queries
+func (s *TodoTestSuite) TestGetTodoStatsRunsOnlyRequestedQueries() {
+	_, userID := s.registerUser("stats-queries@example.com")
+
+	db, err := database.Connect(&config.DatabaseConfig{Host: "sqlite", DBName: ":memory:", CountQueries: true})
+	s.Require().NoError(err)
+	todoService := services.NewTodoService(repository.NewTodoRepository(db), repository.NewUserRepository(db), config.TodoConfig{})
+
+	queries := func(metrics ...string) int64 {
+		ctx, counter := database.WithQueryCounter(context.Background())
+		_, err := todoService.GetStats(ctx, userID, metrics, false)
+		s.Require().NoError(err)
+		return counter.Count()
+	}
+
+	assert.Equal(s.T(), int64(1), queries("total"))
+	// pending shares the total and completed counts
+	assert.Equal(s.T(), int64(2), queries("total", "completed", "pending"))
+	assert.Equal(s.T(), int64(5), queries())
+}
+
+// getStats fetches the stats map for a user
+func (s *TodoTestSuite) getStats(token string) map[string]interface{} {
+	return s.getStatsAt(token, "/api/todos/stats")
+}
+
+// getStatsAt fetches the stats map from path
+func (s *TodoTestSuite) getStatsAt(token, path string) map[string]interface{} {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Data
+}
+
+// TestGetNonExistentTodo tests getting a todo that doesn't exist
+func (s *TodoTestSuite) TestGetNonExistentTodo() {
+	req := httptest.NewRequest(http.MethodGet, "/api/todos/99999", nil)
+	req.Header.Set("Authorization", "Bearer "+s.authToken)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+// TestUpdateTodoSetsCompletedAt tests that completing a todo records when it happened
+func (s *TodoTestSuite) TestUpdateTodoSetsCompletedAt() {
+	token, userID := s.registerUser("completedat@example.com")
+	todo := models.Todo{Title: "Completed At Test", UserID: userID}
+	s.Require().NoError(s.db.Create(&todo).Error)
+
+	completed := true
+	jsonBody, _ := json.Marshal(models.UpdateTodoRequest{Completed: &completed})
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/todos/%d", todo.ID), bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	var response struct {
+		Data models.TodoResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	s.Require().NotNil(response.Data.CompletedAt)
+	assert.WithinDuration(s.T(), time.Now(), response.Data.CompletedAt.Time, time.Minute)
+}
+
+// TestGetVelocity tests the completion velocity and projection math
+func (s *TodoTestSuite) TestGetVelocity() {
+	token, userID := s.registerUser("velocity@example.com")
+
+	// 7 completions spread over the last week, one outside the window, 3 pending
+	now := time.Now()
+	for i := 0; i < 7; i++ {
+		completedAt := now.AddDate(0, 0, -i).Add(-time.Hour)
+		s.Require().NoError(s.db.Create(&models.Todo{
+			Title: "Done", UserID: userID, Completed: true, CompletedAt: &completedAt,
+		}).Error)
+	}
+	old := now.AddDate(0, 0, -20)
+	s.Require().NoError(s.db.Create(&models.Todo{
+		Title: "Old", UserID: userID, Completed: true, CompletedAt: &old,
+	}).Error)
+	for i := 0; i < 3; i++ {
+		s.Require().NoError(s.db.Create(&models.Todo{Title: "Pending", UserID: userID}).Error)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/todos/velocity?days=14", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	var response struct {
+		Data models.VelocityResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(s.T(), 14, response.Data.Days)
+	assert.Equal(s.T(), int64(7), response.Data.Completed)
+	assert.InDelta(s.T(), 0.5, response.Data.AveragePerDay, 0.0001)
+	assert.Equal(s.T(), int64(3), response.Data.Pending)
+	s.Require().NotNil(response.Data.ProjectedDaysToClear)
+	assert.InDelta(s.T(), 6.0, *response.Data.ProjectedDaysToClear, 0.0001)
+}
+
+// TestGetVelocityWithoutCompletions tests the zero-completion case
+func (s *TodoTestSuite) TestGetVelocityWithoutCompletions() {
+	token, userID := s.registerUser("velocity-zero@example.com")
+	s.Require().NoError(s.db.Create(&models.Todo{Title: "Pending", UserID: userID}).Error)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/todos/velocity", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	var response struct {
+		Data models.VelocityResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(s.T(), int64(0), response.Data.Completed)
+	assert.Equal(s.T(), 0.0, response.Data.AveragePerDay)
+	assert.Equal(s.T(), int64(1), response.Data.Pending)
+	assert.Nil(s.T(), response.Data.ProjectedDaysToClear)
+}
+
+// TestCompletedToday tests that only todos completed on the day in the requested timezone are returned
+func (s *TodoTestSuite) TestCompletedToday() {
+	token, userID := s.registerUser("completed-today@example.com")
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	s.Require().NoError(err)
+
+	at := func(day, hour, minute int) *time.Time {
+		t := time.Date(2026, time.March, day, hour, minute, 0, 0, tokyo).UTC()
+		return &t
+	}
+	todos := []models.Todo{
+		// Still the 9th in UTC, but already today in Tokyo
+		{Title: "Early", Completed: true, CompletedAt: at(10, 0, 30), UserID: userID},
+		{Title: "Late", Completed: true, CompletedAt: at(10, 23, 30), UserID: userID},
+		{Title: "Yesterday", Completed: true, CompletedAt: at(9, 23, 30), UserID: userID},
+		{Title: "Tomorrow", Completed: true, CompletedAt: at(11, 0, 0), UserID: userID},
+		{Title: "Pending", UserID: userID},
+	}
+	s.Require().NoError(s.db.Create(&todos).Error)
+
+	result, err := s.newTodoService(config.TodoConfig{}).CompletedOnDay(context.Background(), userID, time.Date(2026, time.March, 10, 12, 0, 0, 0, tokyo))
+	s.Require().NoError(err)
+	assert.Equal(s.T(), "2026-03-10", result.Date)
+	assert.Equal(s.T(), "Asia/Tokyo", result.Timezone)
+	s.Require().Len(result.Todos, 2)
+	assert.Equal(s.T(), "Early", result.Todos[0].Title)
+	assert.Equal(s.T(), "Late", result.Todos[1].Title)
+
+	// The same instant is still the 9th in UTC
+	result, err = s.newTodoService(config.TodoConfig{}).CompletedOnDay(context.Background(), userID, time.Date(2026, time.March, 9, 20, 0, 0, 0, time.UTC))
+	s.Require().NoError(err)
+	s.Require().Len(result.Todos, 2)
+	assert.Equal(s.T(), "Yesterday", result.Todos[0].Title)
+	assert.Equal(s.T(), "Early", result.Todos[1].Title)
+
+	for query, status := range map[string]int{
+		"":                 http.StatusOK,
+		"?tz=Asia/Tokyo":   http.StatusOK,
+		"?tz=Mars/Olympus": http.StatusBadRequest,
+		"?tz=Local":        http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/todos/completed-today"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		assert.Equal(s.T(), status, w.Code, query)
+	}
+}
+
+// TestGetVelocityInvalidDays tests rejecting an out-of-range window
+func (s *TodoTestSuite) TestGetVelocityInvalidDays() {
+	req := httptest.NewRequest(http.MethodGet, "/api/todos/velocity?days=0", nil)
+	req.Header.Set("Authorization", "Bearer "+s.authToken)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+// TestTodosExist tests the batch existence check with existing, deleted and foreign IDs
+func (s *TodoTestSuite) TestTodosExist() {
+	token, userID := s.registerUser("exists@example.com")
+	_, otherUserID := s.registerUser("exists-other@example.com")
+
+	kept := models.Todo{Title: "Kept", UserID: userID}
+	deleted := models.Todo{Title: "Deleted", UserID: userID}
+	foreign := models.Todo{Title: "Foreign", UserID: otherUserID}
+	s.Require().NoError(s.db.Create(&kept).Error)
+	s.Require().NoError(s.db.Create(&deleted).Error)
+	s.Require().NoError(s.db.Create(&foreign).Error)
+	s.Require().NoError(s.db.Delete(&deleted).Error)
+
+	jsonBody, _ := json.Marshal(models.TodoExistsRequest{
+		IDs: []uint{deleted.ID, kept.ID, foreign.ID, 999999, kept.ID},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/todos/exists", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	var response struct {
+		Data models.TodoExistsResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(s.T(), []uint{kept.ID}, response.Data.Existing)
+	assert.Equal(s.T(), []uint{deleted.ID, foreign.ID, 999999}, response.Data.Missing)
+}
+
+// TestBulkSetPriority tests that a mixed-ownership batch only changes owned
+// todos, and only counts those whose priority changed
+func (s *TodoTestSuite) TestBulkSetPriority() {
+	token, userID := s.registerUser("bulk-priority@example.com")
+	_, otherUserID := s.registerUser("bulk-priority-other@example.com")
+
+	first := models.Todo{Title: "First", Priority: "low", UserID: userID}
+	second := models.Todo{Title: "Second", Priority: "medium", UserID: userID}
+	already := models.Todo{Title: "Already", Priority: "high", UserID: userID}
+	foreign := models.Todo{Title: "Foreign", Priority: "low", UserID: otherUserID}
+	s.Require().NoError(s.db.Create(&first).Error)
+	s.Require().NoError(s.db.Create(&second).Error)
+	s.Require().NoError(s.db.Create(&already).Error)
+	s.Require().NoError(s.db.Create(&foreign).Error)
+
+	jsonBody, _ := json.Marshal(models.BulkPriorityRequest{
+		IDs:      []uint{first.ID, second.ID, already.ID, foreign.ID, 999999},
+		Priority: "high",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/todos/bulk/priority", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	var response struct {
+		Data models.BulkUpdateResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(s.T(), int64(2), response.Data.Updated)
+
+	for _, todo := range []*models.Todo{&first, &second, &already, &foreign} {
+		s.Require().NoError(s.db.First(todo, todo.ID).Error)
+	}
+	assert.Equal(s.T(), "high", first.Priority)
+	assert.Equal(s.T(), "high", second.Priority)
+	assert.Equal(s.T(), "high", already.Priority)
+	assert.Equal(s.T(), "low", foreign.Priority)
+}
+
+// TestBulkComplete tests that a mixed-ownership batch only completes owned todos
+func (s *TodoTestSuite) TestBulkComplete() {
+	token, userID := s.registerUser("bulk-complete@example.com")
+	_, otherUserID := s.registerUser("bulk-complete-other@example.com")
+
+	earlier := time.Now().Add(-time.Hour).Truncate(time.Second)
+	first := models.Todo{Title: "First", UserID: userID}
+	done := models.Todo{Title: "Done", Completed: true, CompletedAt: &earlier, UserID: userID}
+	foreign := models.Todo{Title: "Foreign", UserID: otherUserID}
+	s.Require().NoError(s.db.Create(&first).Error)
+	s.Require().NoError(s.db.Create(&done).Error)
+	s.Require().NoError(s.db.Create(&foreign).Error)
+
+	patch := func(body interface{}) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPatch, "/api/todos/bulk", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+	updated := func(w *httptest.ResponseRecorder) int64 {
+		var response struct {
+			Data models.BulkUpdateResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data.Updated
+	}
+
+	ids := []uint{first.ID, done.ID, foreign.ID, 999999}
+	w := patch(map[string]interface{}{"ids": ids, "completed": true})
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Equal(s.T(), int64(1), updated(w))
+
+	for _, todo := range []*models.Todo{&first, &done, &foreign} {
+		s.Require().NoError(s.db.First(todo, todo.ID).Error)
+	}
+	assert.True(s.T(), first.Completed)
+	assert.NotNil(s.T(), first.CompletedAt)
+	assert.True(s.T(), done.CompletedAt.Equal(earlier), "already completed todos keep their completion time")
+	assert.False(s.T(), foreign.Completed)
+
+	w = patch(map[string]interface{}{"ids": ids, "completed": false})
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Equal(s.T(), int64(2), updated(w))
+	var reopened models.Todo
+	s.Require().NoError(s.db.First(&reopened, first.ID).Error)
+	assert.False(s.T(), reopened.Completed)
+	assert.Nil(s.T(), reopened.CompletedAt)
+
+	assert.Equal(s.T(), http.StatusBadRequest, patch(map[string]interface{}{"ids": ids}).Code)
+	assert.Equal(s.T(), http.StatusBadRequest, patch(map[string]interface{}{"ids": []uint{}, "completed": true}).Code)
+}
+
+// TestBulkDelete tests that a mixed-ownership batch only deletes owned todos
+func (s *TodoTestSuite) TestBulkDelete() {
+	token, userID := s.registerUser("bulk-delete@example.com")
+	_, otherUserID := s.registerUser("bulk-delete-other@example.com")
+
+	first := models.Todo{Title: "First", UserID: userID}
+	second := models.Todo{Title: "Second", UserID: userID}
+	kept := models.Todo{Title: "Kept", UserID: userID}
+	foreign := models.Todo{Title: "Foreign", UserID: otherUserID}
+	for _, todo := range []*models.Todo{&first, &second, &kept, &foreign} {
+		s.Require().NoError(s.db.Create(todo).Error)
+	}
+
+	bulkDelete := func(ids []uint) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(map[string]interface{}{"ids": ids})
+		req := httptest.NewRequest(http.MethodDelete, "/api/todos/bulk", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := bulkDelete([]uint{first.ID, second.ID, foreign.ID, 999999})
+	s.Require().Equal(http.StatusOK, w.Code)
+	var response struct {
+		Data models.BulkDeleteResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(s.T(), int64(2), response.Data.Deleted)
+
+	var remaining []string
+	s.Require().NoError(s.db.Model(&models.Todo{}).
+		Where("id IN ?", []uint{first.ID, second.ID, kept.ID, foreign.ID}).
+		Order("id").Pluck("title", &remaining).Error)
+	assert.Equal(s.T(), []string{"Kept", "Foreign"}, remaining)
+
+	tooMany := make([]uint, 101)
+	for i := range tooMany {
+		tooMany[i] = kept.ID
+	}
+	assert.Equal(s.T(), http.StatusBadRequest, bulkDelete([]uint{}).Code)
+	assert.Equal(s.T(), http.StatusBadRequest, bulkDelete(tooMany).Code)
+	s.Require().NoError(s.db.First(&kept, kept.ID).Error)
+}
+
+// TestBulkSetPriorityRejectsInvalidPriority tests priority validation
+func (s *TodoTestSuite) TestBulkSetPriorityRejectsInvalidPriority() {
+	jsonBody, _ := json.Marshal(models.BulkPriorityRequest{IDs: []uint{1}, Priority: "urgent"})
+	req := httptest.NewRequest(http.MethodPost, "/api/todos/bulk/priority", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.authToken)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+// TestTodosExistRejectsOversizedBatch tests the input size cap
+func (s *TodoTestSuite) TestTodosExistRejectsOversizedBatch() {
+	ids := make([]uint, 501)
+	for i := range ids {
+		ids[i] = uint(i + 1)
+	}
+	jsonBody, _ := json.Marshal(models.TodoExistsRequest{IDs: ids})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/todos/exists", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.authToken)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+// TestConditionalUpdate tests If-Unmodified-Since on update
+func (s *TodoTestSuite) TestConditionalUpdate() {
+	token, userID := s.registerUser("conditional@example.com")
+	todo := models.Todo{Title: "Conditional", UserID: userID}
+	s.Require().NoError(s.db.Create(&todo).Error)
+	path := fmt.Sprintf("/api/todos/%d", todo.ID)
+
+	// Fetch to learn the current Last-Modified
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	lastModified := w.Header().Get("Last-Modified")
+	s.Require().NotEmpty(lastModified)
+
+	// Unchanged since fetch: update succeeds
+	title := "Conditional updated"
+	jsonBody, _ := json.Marshal(models.UpdateTodoRequest{Title: &title})
+	req = httptest.NewRequest(http.MethodPut, path, bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Unmodified-Since", lastModified)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	// Someone else modified it after our snapshot
+	s.Require().NoError(s.db.Model(&todo).UpdateColumn("updated_at", time.Now().Add(time.Hour)).Error)
+
+	title = "Stale write"
+	jsonBody, _ = json.Marshal(models.UpdateTodoRequest{Title: &title})
+	req = httptest.NewRequest(http.MethodPut, path, bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Unmodified-Since", lastModified)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusPreconditionFailed, w.Code)
+
+	var stored models.Todo
+	s.Require().NoError(s.db.First(&stored, todo.ID).Error)
+	assert.Equal(s.T(), "Conditional updated", stored.Title)
+}
+
+// TestImportTodos tests importing a JSON array of todos
+func (s *TodoTestSuite) TestImportTodos() {
+	token, userID := s.registerUser("import@example.com")
+
+	body := `[{"title": "First"}, {"title": "Second", "priority": "high"}, {"title": "Third"}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/todos/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusCreated, w.Code)
+
+	var count int64
+	s.db.Model(&models.Todo{}).Where("user_id = ?", userID).Count(&count)
+	assert.Equal(s.T(), int64(3), count)
+}
+
+// TestImportTodosRejectsInvalidItem tests that one invalid item fails the whole import
+func (s *TodoTestSuite) TestImportTodosRejectsInvalidItem() {
+	token, userID := s.registerUser("import-invalid@example.com")
+
+	body := `[{"title": "Valid"}, {"title": "Bad", "priority": "urgent"}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/todos/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+
+	var count int64
+	s.db.Model(&models.Todo{}).Where("user_id = ?", userID).Count(&count)
+	assert.Equal(s.T(), int64(0), count)
+}
+
+// TestImportTodosStopsAtLimit tests that an oversized array is rejected mid-stream.
+// The body never ends, so the request only completes if decoding fails fast.
+func (s *TodoTestSuite) TestImportTodosStopsAtLimit() {
+	token, userID := s.registerUser("import-limit@example.com")
+
+	body := io.MultiReader(strings.NewReader("["), endlessTodoArray{})
+	req := httptest.NewRequest(http.MethodPost, "/api/todos/import", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusRequestEntityTooLarge, w.Code)
+
+	var count int64
+	s.db.Model(&models.Todo{}).Where("user_id = ?", userID).Count(&count)
+	assert.Equal(s.T(), int64(0), count)
+}
+
+// endlessTodoArray yields todo array elements forever
+type endlessTodoArray struct{}
+
+func (endlessTodoArray) Read(p []byte) (int, error) {
+	const item = `{"title": "Again"},`
+	n := 0
+	for n+len(item) <= len(p) {
+		n += copy(p[n:], item)
+	}
+	return n, nil
+}
+
+// TestTodoTestSuite runs the test suite
+func TestTodoTestSuite(t *testing.T) {
+	suite.Run(t, new(TodoTestSuite))
+}
+
+// TestCalendarFeed tests the iCalendar output for due-dated todos
+func (s *TodoTestSuite) TestCalendarFeed() {
+	token, userID := s.registerUser("calendar@example.com")
+	due := time.Date(2030, 3, 14, 9, 30, 0, 0, time.UTC)
+	todos := []models.Todo{
+		{Title: "Pay rent; landlord, flat 2", Description: "Line one\nLine two", DueDate: &due, UserID: userID},
+		{Title: "Done thing", DueDate: &due, Completed: true, UserID: userID},
+		{Title: "No due date", UserID: userID},
+	}
+	s.Require().NoError(s.db.Create(&todos).Error)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/todos/calendar.ics", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.Equal(s.T(), "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+
+	// Unfold continuation lines and split into properties per event
+	body := strings.ReplaceAll(w.Body.String(), "\r\n ", "")
+	lines := strings.Split(strings.TrimSuffix(body, "\r\n"), "\r\n")
+	assert.Equal(s.T(), "BEGIN:VCALENDAR", lines[0])
+	assert.Equal(s.T(), "END:VCALENDAR", lines[len(lines)-1])
+
+	var events []map[string]string
+	for _, line := range lines {
+		switch {
+		case line == "BEGIN:VEVENT":
+			events = append(events, map[string]string{})
+		case line == "END:VEVENT":
+		case len(events) > 0:
+			name, value, _ := strings.Cut(line, ":")
+			events[len(events)-1][name] = value
+		}
+	}
+
+	s.Require().Len(events, 2)
+	assert.Equal(s.T(), `Pay rent\; landlord\, flat 2`, events[0]["SUMMARY"])
+	assert.Equal(s.T(), `Line one\nLine two`, events[0]["DESCRIPTION"])
+	assert.Equal(s.T(), "20300314T093000Z", events[0]["DTSTART"])
+	assert.Equal(s.T(), "Pending", events[0]["CATEGORIES"])
+	assert.Equal(s.T(), fmt.Sprintf("todo-%d@todo-api", todos[0].ID), events[0]["UID"])
+	assert.Equal(s.T(), "Completed", events[1]["CATEGORIES"])
+}
+
+// TestCalendarFeedToken tests the token-authenticated feed and its revocation
+func (s *TodoTestSuite) TestCalendarFeedToken() {
+	token, userID := s.registerUser("feedtoken@example.com")
+	due := time.Date(2030, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.Require().NoError(s.db.Create(&models.Todo{Title: "Feed item", DueDate: &due, UserID: userID}).Error)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/feed-token", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusCreated, w.Code)
+
+	var response struct {
+		Data models.FeedTokenResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	feed := response.Data
+	assert.Equal(s.T(), "/api/todos/calendar/"+feed.Token+".ics", feed.Path)
+
+	// Only the hash is stored
+	var user models.User
+	s.Require().NoError(s.db.First(&user, userID).Error)
+	s.Require().NotNil(user.FeedTokenHash)
+	assert.Equal(s.T(), utils.HashToken(feed.Token), *user.FeedTokenHash)
+
+	req = httptest.NewRequest(http.MethodGet, feed.Path, nil)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.Equal(s.T(), "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(s.T(), w.Body.String(), "SUMMARY:Feed item")
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/auth/feed-token", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, feed.Path, nil)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
+}
+
+// TestTodoTree tests that subtasks are nested under their parents and that
+// nesting stops at the requested depth
+func (s *TodoTestSuite) TestTodoTree() {
+	token, _ := s.registerUser("tree@example.com")
+
+	create := func(title string, parentID *uint) uint {
+		jsonBody, _ := json.Marshal(models.CreateTodoRequest{Title: title, ParentID: parentID})
+		req := httptest.NewRequest(http.MethodPost, "/api/todos", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+		var response struct {
+			Data models.TodoResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data.ID
+	}
+
+	root := create("Root", nil)
+	child := create("Child", &root)
+	create("Grandchild", &child)
+	create("Standalone", nil)
+
+	tree := func(query string) []models.TodoTreeNode {
+		req := httptest.NewRequest(http.MethodGet, "/api/todos/tree"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+		var response struct {
+			Data []models.TodoTreeNode `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	nodes := tree("")
+	s.Require().Len(nodes, 2)
+	assert.Equal(s.T(), "Root", nodes[0].Title)
+	assert.Equal(s.T(), "Standalone", nodes[1].Title)
+	s.Require().Len(nodes[0].Subtasks, 1)
+	assert.Equal(s.T(), "Child", nodes[0].Subtasks[0].Title)
+	s.Require().Len(nodes[0].Subtasks[0].Subtasks, 1)
+	assert.Equal(s.T(), "Grandchild", nodes[0].Subtasks[0].Subtasks[0].Title)
+	assert.False(s.T(), nodes[0].Truncated)
+
+	// At depth 2 the grandchild is cut off and its parent flagged
+	nodes = tree("?depth=2")
+	s.Require().Len(nodes[0].Subtasks, 1)
+	assert.Empty(s.T(), nodes[0].Subtasks[0].Subtasks)
+	assert.True(s.T(), nodes[0].Subtasks[0].Truncated)
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/todos/tree?depth=%d", services.MaxTreeDepth+1), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+
+	// Parents must belong to the user
+	missing := uint(1 << 30)
+	jsonBody, _ := json.Marshal(models.CreateTodoRequest{Title: "Orphan", ParentID: &missing})
+	req = httptest.NewRequest(http.MethodPost, "/api/todos", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.authToken)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+// TestDefaultExpansion tests that the configured default expansion is applied
+// to single-todo fetches and can be turned off per request
+func (s *TodoTestSuite) TestDefaultExpansion() {
+	_, userID := s.registerUser("expand@example.com")
+	token, err := s.jwtManager.GenerateToken(userID, "expand@example.com")
+	s.Require().NoError(err)
+
+	parent := models.Todo{Title: "Parent", UserID: userID}
+	s.Require().NoError(s.db.Create(&parent).Error)
+	s.Require().NoError(s.db.Create(&models.Todo{Title: "Subtask", ParentID: &parent.ID, UserID: userID}).Error)
+
+	cfg := config.TodoConfig{DefaultExpand: []string{"subtasks"}}
+	router := gin.New()
+	router.GET("/api/todos/:id", middleware.AuthMiddleware(s.jwtManager), handlers.NewTodoHandler(s.newTodoService(cfg), cfg).GetByID)
+
+	get := func(query string) (int, models.TodoResponse) {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/todos/%d%s", parent.ID, query), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Data models.TodoResponse `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	code, todo := get("")
+	s.Require().Equal(http.StatusOK, code)
+	s.Require().Len(todo.Subtasks, 1)
+	assert.Equal(s.T(), "Subtask", todo.Subtasks[0].Title)
+
+	code, todo = get("?expand=none")
+	s.Require().Equal(http.StatusOK, code)
+	assert.Empty(s.T(), todo.Subtasks)
+
+	code, _ = get("?expand=owner")
+	assert.Equal(s.T(), http.StatusBadRequest, code)
+
+	// Without a configured default, nothing is expanded unless asked for
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/todos/%d", parent.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.NotContains(s.T(), w.Body.String(), "subtasks")
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/todos/%d?expand=subtasks", parent.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Contains(s.T(), w.Body.String(), `"subtasks":[`)
+}
+
+// TestTimeFormats tests that response times serialize as RFC3339 by default
+// and as epoch milliseconds when configured
+func (s *TodoTestSuite) TestTimeFormats() {
+	created := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	todo := models.Todo{Title: "Timed", DueDate: &created, UserID: 1, CreatedAt: created, UpdatedAt: created}
+	user := models.User{Email: "timed@example.com", CreatedAt: created}
+
+	fields := func() (map[string]interface{}, map[string]interface{}) {
+		var todoJSON, userJSON map[string]interface{}
+		body, err := json.Marshal(todo.ToResponse())
+		s.Require().NoError(err)
+		s.Require().NoError(json.Unmarshal(body, &todoJSON))
+		body, err = json.Marshal(user.ToResponse())
+		s.Require().NoError(err)
+		s.Require().NoError(json.Unmarshal(body, &userJSON))
+		return todoJSON, userJSON
+	}
+
+	todoJSON, userJSON := fields()
+	for _, name := range []string{"created_at", "updated_at", "due_date"} {
+		assert.Equal(s.T(), "2030-01-02T03:04:05Z", todoJSON[name], name)
+	}
+	assert.Equal(s.T(), "2030-01-02T03:04:05Z", userJSON["created_at"])
+
+	models.SetTimeFormat(models.TimeFormatEpochMillis)
+	s.T().Cleanup(func() { models.SetTimeFormat(models.TimeFormatRFC3339) })
+
+	millis := float64(created.UnixMilli())
+	todoJSON, userJSON = fields()
+	for _, name := range []string{"created_at", "updated_at", "due_date"} {
+		assert.Equal(s.T(), millis, todoJSON[name], name)
+	}
+	assert.Equal(s.T(), millis, userJSON["created_at"])
+
+	// Responses decode in either format
+	body, _ := json.Marshal(todo.ToResponse())
+	var decoded models.TodoResponse
+	s.Require().NoError(json.Unmarshal(body, &decoded))
+	assert.True(s.T(), created.Equal(decoded.DueDate.Time))
+}
+
+// TestDueDateNormalizedToUTC tests that due dates sent with an offset are
+// stored and returned in UTC on create and update
+func (s *TodoTestSuite) TestDueDateNormalizedToUTC() {
+	send := func(method, path, body string) models.TodoResponse {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+s.authToken)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.Require().Less(w.Code, 300, w.Body.String())
+		assert.Contains(s.T(), w.Body.String(), `"due_date":"`)
+
+		var response struct {
+			Data models.TodoResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	created := send(http.MethodPost, "/api/todos", `{"title": "Offset due", "due_date": "2030-06-01T09:00:00+05:30"}`)
+	s.Require().NotNil(created.DueDate)
+	assert.Equal(s.T(), time.UTC, created.DueDate.Location())
+	assert.Equal(s.T(), "2030-06-01T03:30:00Z", created.DueDate.Format(time.RFC3339))
+
+	var stored models.Todo
+	s.Require().NoError(s.db.First(&stored, created.ID).Error)
+	_, offset := stored.DueDate.Zone()
+	assert.Zero(s.T(), offset, "stored due date keeps the client's offset")
+	assert.Equal(s.T(), "2030-06-01T03:30:00Z", stored.DueDate.Format(time.RFC3339))
+
+	updated := send(http.MethodPut, fmt.Sprintf("/api/todos/%d", created.ID), `{"due_date": "2030-06-01T20:00:00-04:00"}`)
+	assert.Equal(s.T(), "2030-06-02T00:00:00Z", updated.DueDate.Format(time.RFC3339))
+}
+
+// TestDeletedUserTokenRejected tests that a still-valid token for a deleted
+// account cannot list or create todos
+func (s *TodoTestSuite) TestDeletedUserTokenRejected() {
+	token, userID := s.registerUser("deleted-user@example.com")
+	s.Require().NoError(s.db.Delete(&models.User{}, userID).Error)
+
+	_, err := s.jwtManager.ValidateToken(token)
+	s.Require().NoError(err, "token should still parse")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/todos", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(s.T(), w.Body.String(), "Account no longer exists")
+
+	req = httptest.NewRequest(http.MethodPost, "/api/todos", strings.NewReader(`{"title": "Orphan"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
+
+	var count int64
+	s.Require().NoError(s.db.Model(&models.Todo{}).Where("user_id = ?", userID).Count(&count).Error)
+	assert.Zero(s.T(), count)
+}
+
+// TestTodoReminder tests setting a reminder and rejecting one after the due date
+func (s *TodoTestSuite) TestTodoReminder() {
+	token, _ := s.registerUser("reminder@example.com")
+	send := func(method, path string, body map[string]interface{}) (*httptest.ResponseRecorder, models.TodoResponse) {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+
+		var response struct {
+			Data models.TodoResponse `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response.Data
+	}
+
+	w, todo := send(http.MethodPost, "/api/todos", map[string]interface{}{
+		"title":     "Renew passport",
+		"due_date":  "2030-06-01T12:00:00Z",
+		"remind_at": "2030-05-25T11:00:00+02:00",
+	})
+	s.Require().Equal(http.StatusCreated, w.Code)
+	s.Require().NotNil(todo.RemindAt)
+	assert.Equal(s.T(), time.Date(2030, time.May, 25, 9, 0, 0, 0, time.UTC), todo.RemindAt.Time)
+	path := fmt.Sprintf("/api/todos/%d", todo.ID)
+
+	// A reminder equal to the due date is allowed; a later one is not
+	w, _ = send(http.MethodPost, "/api/todos", map[string]interface{}{
+		"title": "On time", "due_date": "2030-06-01T12:00:00Z", "remind_at": "2030-06-01T12:00:00Z",
+	})
+	assert.Equal(s.T(), http.StatusCreated, w.Code)
+	w, _ = send(http.MethodPost, "/api/todos", map[string]interface{}{
+		"title": "Too late", "due_date": "2030-06-01T12:00:00Z", "remind_at": "2030-06-02T12:00:00Z",
+	})
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+
+	// Updates are checked against the stored due date and reminder
+	w, _ = send(http.MethodPut, path, map[string]interface{}{"remind_at": "2030-06-03T00:00:00Z"})
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+	w, _ = send(http.MethodPut, path, map[string]interface{}{"due_date": "2030-05-20T00:00:00Z"})
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+	w, todo = send(http.MethodPut, path, map[string]interface{}{"remind_at": "2030-05-31T08:00:00Z"})
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Equal(s.T(), time.Date(2030, time.May, 31, 8, 0, 0, 0, time.UTC), todo.RemindAt.Time)
+
+	// Without a due date any reminder goes
+	w, _ = send(http.MethodPost, "/api/todos", map[string]interface{}{
+		"title": "Call back", "remind_at": "2030-06-02T12:00:00Z",
+	})
+	assert.Equal(s.T(), http.StatusCreated, w.Code)
+}
+
+// TestReminderWorkerScan tests that a scan emits one event per due reminder and marks it reminded
+func (s *TodoTestSuite) TestReminderWorkerScan() {
+	_, userID := s.registerUser("reminder-worker@example.com")
+	now := time.Now().UTC()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	todos := []models.Todo{
+		{Title: "Due", RemindAt: &past, UserID: userID},
+		{Title: "Later", RemindAt: &future, UserID: userID},
+		{Title: "Done", RemindAt: &past, Completed: true, UserID: userID},
+		{Title: "Sent", RemindAt: &past, RemindedAt: &past, UserID: userID},
+	}
+	s.Require().NoError(s.db.Create(&todos).Error)
+
+	var received []events.Event
+	bus := events.NewBus()
+	bus.Subscribe(events.TodoReminder, func(_ context.Context, event events.Event) {
+		if event.UserID == userID {
+			received = append(received, event)
+		}
+	})
+	worker := services.NewReminderWorker(repository.NewTodoRepository(s.db), bus, time.Minute)
+
+	_, err := worker.Scan(context.Background(), now)
+	s.Require().NoError(err)
+	s.Require().Len(received, 1)
+	assert.Equal(s.T(), events.TodoReminder, received[0].Type)
+	assert.Equal(s.T(), todos[0].ID, received[0].Payload.(models.TodoResponse).ID)
+
+	var due models.Todo
+	s.Require().NoError(s.db.First(&due, todos[0].ID).Error)
+	s.Require().NotNil(due.RemindedAt)
+
+	// Already reminded todos are not sent again
+	_, err = worker.Scan(context.Background(), now)
+	s.Require().NoError(err)
+	assert.Len(s.T(), received, 1)
+}
+
+// TestTodoHistoryRecordsEveryWrite tests that each way of changing a todo
+// records a version of it
+func (s *TodoTestSuite) TestTodoHistoryRecordsEveryWrite() {
+	_, userID := s.registerUser("history-writes@example.com")
+	ctx := context.Background()
+	todoService := s.newTodoService(config.TodoConfig{})
+
+	externalID := "history-writes"
+	imported, err := todoService.Import(ctx, userID, []models.CreateTodoRequest{{Title: "Imported", ExternalID: &externalID}})
+	s.Require().NoError(err)
+	s.Require().Equal(1, imported.Imported)
+	todo, err := todoService.GetByExternalID(ctx, externalID, userID)
+	s.Require().NoError(err)
+
+	versions := func() []models.TodoHistoryEntry {
+		history, err := todoService.History(ctx, todo.ID, userID)
+		s.Require().NoError(err)
+		return history
+	}
+	s.Require().Len(versions(), 1)
+	assert.Equal(s.T(), models.AuditActionTodoCreated, versions()[0].Action)
+
+	_, _, err = todoService.UpsertByExternalID(ctx, userID, externalID, &models.UpsertTodoRequest{Title: "Upserted"})
+	s.Require().NoError(err)
+	_, err = todoService.BulkUpdateCompleted(ctx, userID, []uint{todo.ID}, true)
+	s.Require().NoError(err)
+	_, err = todoService.SetPriority(ctx, userID, &models.BulkPriorityRequest{IDs: []uint{todo.ID}, Priority: "high"})
+	s.Require().NoError(err)
+	s.Require().NoError(todoService.Delete(ctx, todo.ID, userID))
+	_, err = todoService.Restore(ctx, todo.ID, userID)
+	s.Require().NoError(err)
+
+	history := versions()
+	s.Require().Len(history, 5)
+	assert.Equal(s.T(), "Upserted", history[1].State.Title)
+	assert.True(s.T(), history[2].State.Completed)
+	assert.Equal(s.T(), "high", history[3].State.Priority)
+
+	// Setting a priority the todo already has records nothing
+	_, err = todoService.SetPriority(ctx, userID, &models.BulkPriorityRequest{IDs: []uint{todo.ID}, Priority: "high"})
+	s.Require().NoError(err)
+	assert.Len(s.T(), versions(), 5)
+}
+
+// TestTodoHistoryDiff tests recording versions and diffing two of them
+func (s *TodoTestSuite) TestTodoHistoryDiff() {
+	token, userID := s.registerUser("history@example.com")
+	otherToken, otherID := s.registerUser("history-other@example.com")
+	ctx := context.Background()
+	todoService := s.newTodoService(config.TodoConfig{})
+
+	todo, err := todoService.Create(ctx, userID, &models.CreateTodoRequest{Title: "Draft", Priority: "low"})
+	s.Require().NoError(err)
+	title, priority, completed := "Final", "high", true
+	_, err = todoService.Update(ctx, todo.ID, userID, &models.UpdateTodoRequest{Title: &title}, nil)
+	s.Require().NoError(err)
+	_, err = todoService.Update(ctx, todo.ID, userID, &models.UpdateTodoRequest{Priority: &priority, Completed: &completed}, nil)
+	s.Require().NoError(err)
+	other, err := todoService.Create(ctx, otherID, &models.CreateTodoRequest{Title: "Other"})
+	s.Require().NoError(err)
+
+	get := func(token, path string) (int, []byte) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w.Code, w.Body.Bytes()
+	}
+
+	code, body := get(token, fmt.Sprintf("/api/todos/%d/history", todo.ID))
+	s.Require().Equal(http.StatusOK, code)
+	var history struct {
+		Data []models.TodoHistoryEntry `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(body, &history))
+	s.Require().Len(history.Data, 3)
+	assert.Equal(s.T(), models.AuditActionTodoCreated, history.Data[0].Action)
+	assert.Equal(s.T(), "Final", history.Data[2].State.Title)
+	first, second, last := history.Data[0].ID, history.Data[1].ID, history.Data[2].ID
+
+	diffPath := func(todoID, from, to uint) string {
+		return fmt.Sprintf("/api/todos/%d/history/diff?from=%d&to=%d", todoID, from, to)
+	}
+	code, body = get(token, diffPath(todo.ID, second, last))
+	s.Require().Equal(http.StatusOK, code)
+	var diff struct {
+		Data models.TodoVersionDiff `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(body, &diff))
+	assert.Equal(s.T(), []models.FieldChange{
+		{Field: "completed", From: false, To: true},
+		{Field: "priority", From: "low", To: "high"},
+	}, diff.Data.Changes)
+
+	code, body = get(token, diffPath(todo.ID, first, last))
+	s.Require().Equal(http.StatusOK, code)
+	s.Require().NoError(json.Unmarshal(body, &diff))
+	assert.Len(s.T(), diff.Data.Changes, 3)
+
+	// Versions of another todo, other users' todos and bad IDs are rejected
+	otherHistory, err := todoService.History(ctx, other.ID, otherID)
+	s.Require().NoError(err)
+	code, _ = get(token, diffPath(todo.ID, first, otherHistory[0].ID))
+	assert.Equal(s.T(), http.StatusNotFound, code)
+	code, _ = get(otherToken, diffPath(todo.ID, first, last))
+	assert.Equal(s.T(), http.StatusNotFound, code)
+	code, _ = get(token, fmt.Sprintf("/api/todos/%d/history/diff?from=%d", todo.ID, first))
+	assert.Equal(s.T(), http.StatusBadRequest, code)
+}
+
+// TestTodoColor tests setting a color label, filtering by it and rejecting
+// invalid colors
+func (s *TodoTestSuite) TestTodoColor() {
+	token, _ := s.registerUser("color@example.com")
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost, "/api/todos", `{"title": "Red one", "color": "red"}`)
+	s.Require().Equal(http.StatusCreated, w.Code)
+	assert.Contains(s.T(), w.Body.String(), `"color":"red"`)
+
+	w = send(http.MethodPost, "/api/todos", `{"title": "Hex one", "color": "#FF8800"}`)
+	s.Require().Equal(http.StatusCreated, w.Code)
+	var response struct {
+		Data models.TodoResponse `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(s.T(), "#ff8800", response.Data.Color)
+	s.Require().Equal(http.StatusCreated, send(http.MethodPost, "/api/todos", `{"title": "Plain"}`).Code)
+
+	list := func(query string) []models.TodoResponse {
+		w := send(http.MethodGet, "/api/todos"+query, "")
+		s.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+		var response struct {
+			Data models.TodoListResponse `json:"data"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data.Todos
+	}
+
+	red := list("?color=red")
+	s.Require().Len(red, 1)
+	assert.Equal(s.T(), "Red one", red[0].Title)
+	hex := list("?color=%23ff8800")
+	s.Require().Len(hex, 1)
+	assert.Equal(s.T(), "Hex one", hex[0].Title)
+
+	// Updates can change or clear the color
+	w = send(http.MethodPut, fmt.Sprintf("/api/todos/%d", response.Data.ID), `{"color": "blue"}`)
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Len(s.T(), list("?color=blue"), 1)
+	w = send(http.MethodPut, fmt.Sprintf("/api/todos/%d", response.Data.ID), `{"color": ""}`)
+	s.Require().Equal(http.StatusOK, w.Code)
+	assert.Empty(s.T(), list("?color=blue"))
+
+	assert.Equal(s.T(), http.StatusBadRequest, send(http.MethodPost, "/api/todos", `{"title": "Bad", "color": "chartreuse"}`).Code)
+	assert.Equal(s.T(), http.StatusBadRequest, send(http.MethodPost, "/api/todos", `{"title": "Bad", "color": "#12345"}`).Code)
+	assert.Equal(s.T(), http.StatusBadRequest, send(http.MethodPut, fmt.Sprintf("/api/todos/%d", response.Data.ID), `{"color": "nope"}`).Code)
+	assert.Equal(s.T(), http.StatusBadRequest, send(http.MethodGet, "/api/todos?color=nope", "").Code)
 }
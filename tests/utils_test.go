@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bhaskar/todo-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFormatISODuration tests ISO 8601 duration formatting
+func TestFormatISODuration(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{0, "PT0S"},
+		{90 * time.Minute, "PT1H30M"},
+		{26*time.Hour + 5*time.Second, "P1DT2H5S"},
+		{48 * time.Hour, "P2D"},
+		{1500 * time.Millisecond, "PT2S"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, utils.FormatISODuration(tt.in), tt.in.String())
+	}
+}
+
+// TestValidateTokenPinsAlgorithm tests that tokens signed with another HMAC variant are rejected
+func TestValidateTokenPinsAlgorithm(t *testing.T) {
+	hs256 := utils.NewJWTManagerWithAlgorithm("test-secret", time.Hour, "test", "HS256")
+	hs384 := utils.NewJWTManagerWithAlgorithm("test-secret", time.Hour, "test", "HS384")
+
+	token, err := hs384.GenerateToken(1, "alg@example.com")
+	assert.NoError(t, err)
+
+	_, err = hs256.ValidateToken(token)
+	assert.Error(t, err)
+
+	claims, err := hs384.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), claims.UserID)
+}
+
+// TestValidateTokenIssuer tests that issuers are trimmed and then compared exactly
+func TestValidateTokenIssuer(t *testing.T) {
+	token, err := utils.NewJWTManager("test-secret", time.Hour, "todo-api").GenerateToken(1, "issuer@example.com")
+	assert.NoError(t, err)
+
+	// A trailing space from env config still matches the clean claim
+	claims, err := utils.NewJWTManager("test-secret", time.Hour, "todo-api ").ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "todo-api", claims.Issuer)
+
+	for _, issuer := range []string{"other-api", "Todo-API"} {
+		_, err = utils.NewJWTManager("test-secret", time.Hour, issuer).ValidateToken(token)
+		assert.ErrorIs(t, err, utils.ErrIssuerMismatch, issuer)
+		assert.Contains(t, err.Error(), issuer)
+	}
+}
+
+// TestTokenAudience tests issuing tokens scoped to a client and requiring
+// an accepted audience
+func TestTokenAudience(t *testing.T) {
+	manager := utils.NewJWTManager("test-secret", time.Hour, "test")
+	manager.UseAudiences([]string{"web", "mobile"}, false)
+
+	_, err := manager.GenerateTokenForAudience(1, "aud@example.com", "desktop")
+	assert.ErrorIs(t, err, utils.ErrUnknownAudience)
+
+	scoped, err := manager.GenerateTokenForAudience(1, "aud@example.com", "mobile")
+	assert.NoError(t, err)
+	unscoped, err := manager.GenerateToken(1, "aud@example.com")
+	assert.NoError(t, err)
+
+	// Refreshing keeps the audience
+	claims, err := manager.ValidateToken(scoped)
+	assert.NoError(t, err)
+	refreshed, err := manager.RefreshToken(claims)
+	assert.NoError(t, err)
+	claims, err = manager.ValidateToken(refreshed)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mobile"}, []string(claims.Audience))
+
+	// Unscoped tokens are only accepted while no audience is required
+	_, err = manager.ValidateToken(unscoped)
+	assert.NoError(t, err)
+	manager.UseAudiences([]string{"web", "mobile"}, true)
+	_, err = manager.ValidateToken(unscoped)
+	assert.ErrorIs(t, err, utils.ErrAudienceMismatch)
+	_, err = manager.ValidateToken(scoped)
+	assert.NoError(t, err)
+
+	manager.UseAudiences([]string{"web"}, true)
+	_, err = manager.ValidateToken(scoped)
+	assert.ErrorIs(t, err, utils.ErrAudienceMismatch)
+}
+
+// TestUnsupportedJWTAlgorithmFailsClosed tests that an unknown algorithm neither issues nor accepts tokens
+func TestUnsupportedJWTAlgorithmFailsClosed(t *testing.T) {
+	manager := utils.NewJWTManagerWithAlgorithm("test-secret", time.Hour, "test", "none")
+
+	_, err := manager.GenerateToken(1, "alg@example.com")
+	assert.ErrorIs(t, err, utils.ErrUnsupportedAlgorithm)
+
+	token, err := utils.NewJWTManager("test-secret", time.Hour, "test").GenerateToken(1, "alg@example.com")
+	assert.NoError(t, err)
+	_, err = manager.ValidateToken(token)
+	assert.Error(t, err)
+}
+
+// TestWriteICalendarFoldsLongLines tests that content lines are folded at 75 octets
+func TestWriteICalendarFoldsLongLines(t *testing.T) {
+	var buf bytes.Buffer
+	summary := strings.Repeat("é", 100)
+	err := utils.WriteICalendar(&buf, "-//test//EN", "Test", []utils.ICalEvent{
+		{UID: "1", Summary: summary, Start: time.Now(), Stamp: time.Now()},
+	})
+	assert.NoError(t, err)
+
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+		assert.True(t, utf8.ValidString(line), line)
+	}
+	assert.Contains(t, strings.ReplaceAll(buf.String(), "\r\n ", ""), "SUMMARY:"+summary)
+}